@@ -2,7 +2,6 @@ package klinkregistry
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/go-playground/validator"
@@ -30,10 +29,12 @@ type RPCResponse struct {
 	Error  *RPCError   `json:"error,omitempty"`
 }
 
-// KlinkResponse wraps the klink entries in the klinks array
+// KlinkResponse wraps the klink entries in the klinks array, including the
+// permissions the application holds inside the klink
 type KlinkResponse struct {
-	ID   string `json:"id"`
-	Name string `json:"name"`
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Permissions []string `json:"permissions"`
 }
 
 // writeRPCResponse is a helper function to write the response object to the client
@@ -52,34 +53,57 @@ func stringInSlice(a string, list []string) bool {
 	return false
 }
 
-func checkAccess(app *Application, permissions []string) error {
-	if app == nil {
-		return ErrUndefinedApplication
+// effectiveApplication returns a copy of the application, where the
+// application permissions and the permissions of every grant are replaced by
+// their effective set, based on the catalogue
+func effectiveApplication(app *Application, catalogue []*Permission) *Application {
+	effective := *app
+	effective.Permissions = ExpandPermissions(app.Permissions, catalogue)
+
+	grants := make([]KlinkGrant, 0, len(app.Grants))
+	for _, grant := range app.Grants {
+		grants = append(grants, KlinkGrant{
+			Klink:       grant.Klink,
+			Permissions: ExpandPermissions(grant.Permissions, catalogue),
+		})
 	}
+	effective.SetGrants(grants)
 
-	for _, permissionName := range permissions {
-		if !stringInSlice(permissionName, app.Permissions) {
-			return ErrInvalidPermissions
-		}
-	}
-	return nil
+	return &effective
 }
 
-// MapToKlink maps a list of ids to the corresponding K-Link instance
-func (s *Server) MapToKlink(vs []string) []KlinkResponse {
+// MapToKlink maps a list of grants to the corresponding K-Link instance.
+// The K-Links are loaded in a single query; unknown ones are skipped.
+func (s *Server) MapToKlink(grants []KlinkGrant) []KlinkResponse {
 	vsm := make([]KlinkResponse, 0)
-	for _, v := range vs {
 
-		if v != "" {
-			klink, err := s.store.GetKlinkByIdentifier(v)
+	identifiers := make([]string, 0, len(grants))
+	for _, grant := range grants {
+		if grant.Klink != "" {
+			identifiers = append(identifiers, grant.Klink)
+		}
+	}
+
+	klinks, err := s.klinksByIdentifier(identifiers)
+	if err != nil {
+		s.logger.WithError(err).Error("Error loading K-Links")
+		return vsm
+	}
 
-			if err == nil {
-				model := new(KlinkResponse)
-				model.ID = klink.Identifier
-				model.Name = klink.Name
-				vsm = append(vsm, *model)
-			}
+	for _, grant := range grants {
+		klink, ok := klinks[grant.Klink]
+		if !ok {
+			continue
 		}
+
+		model := new(KlinkResponse)
+		model.ID = klink.Identifier
+		model.Name = klink.Name
+		model.Permissions = grant.Permissions
+		if model.Permissions == nil {
+			model.Permissions = []string{}
+		}
+		vsm = append(vsm, *model)
 	}
 	return vsm
 }
@@ -95,6 +119,7 @@ func (s *Server) handleAuthenticate() http.HandlerFunc {
 			AppSecret   string   `json:"app_secret"`
 			AppURL      string   `json:"app_url"`
 			Permissions []string `json:"permissions"`
+			KlinkID     string   `json:"klink_id"`
 		} `json:"params"`
 	}
 
@@ -106,6 +131,10 @@ func (s *Server) handleAuthenticate() http.HandlerFunc {
 		Permissions []string        `json:"permissions"`
 		Klinks      []KlinkResponse `json:"klinks"`
 		OwnerEmail  string          `json:"email"`
+		Description string          `json:"description"`
+		Tags        []string        `json:"tags"`
+		LogoURL     string          `json:"logo_url"`
+		Environment string          `json:"environment"`
 	}
 
 	// Common errors we will encounter
@@ -125,12 +154,13 @@ func (s *Server) handleAuthenticate() http.HandlerFunc {
 
 		if err := decoder.Decode(&request); err != nil {
 			response.Error = &APIErrInvalidJSON
-			log.Println("v1-application validation malformed request payload")
+			s.requestLogger(req).WithError(err).Info("v1-application validation malformed request payload")
 			writeRPCResponse(w, response)
 			return
 		}
 
-		log.Printf("v1-application validation [%s]", request.Parameters.AppURL)
+		logger := s.requestLogger(req).WithField("application", request.Parameters.AppURL)
+		logger.Debug("v1-application validation")
 
 		// ResponseID should be the same as the request ID
 		response.ID = request.ID
@@ -141,41 +171,34 @@ func (s *Server) handleAuthenticate() http.HandlerFunc {
 			return
 		}
 
-		app, err := s.store.GetApplicationByDomain(request.Parameters.AppURL)
-		if err != nil {
-			response.Error = &APIErrPermissionDenied
-			writeRPCResponse(w, response)
-			return
-		}
-
-		// Check if the secret token matches
-		if app.Token != request.Parameters.AppSecret {
-			response.Error = &APIErrPermissionDenied
-			writeRPCResponse(w, response)
-			return
-		}
-
-		if err := checkAccess(app, request.Parameters.Permissions); err != nil {
-			response.Error = &APIErrPermissionDenied
-			writeRPCResponse(w, response)
-			return
-		}
+		auth := s.authorize(AuthorizationRequest{
+			AppURL:      request.Parameters.AppURL,
+			AppSecret:   request.Parameters.AppSecret,
+			Permissions: request.Parameters.Permissions,
+			KlinkID:     request.Parameters.KlinkID,
+		})
+		s.observeAuthentication(auth.Reason)
+		if !auth.Granted() {
+			logger.WithField("reason", auth.Reason).Info("v1-application validation denied")
+			s.auditDenial(auth, request.Parameters.AppURL)
 
-		// fetch the Application owner
-		owner, error := s.store.GetRegistrantByID(app.OwnerID)
-		if error != nil {
 			response.Error = &APIErrPermissionDenied
 			writeRPCResponse(w, response)
 			return
 		}
+		app, owner := auth.App, auth.Owner
 
 		response.Result = AppResponse{
 			Name:        app.Name,
 			AppURL:      app.URL,
 			AppID:       app.ID,
 			Permissions: app.Permissions,
-			Klinks:      s.MapToKlink(app.Klinks),
+			Klinks:      s.MapToKlink(app.Grants),
 			OwnerEmail:  owner.Email,
+			Description: app.Description,
+			Tags:        app.Tags,
+			LogoURL:     app.LogoURL,
+			Environment: app.Environment,
 		}
 
 		writeRPCResponse(w, response)
@@ -0,0 +1,113 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+)
+
+// authenticate calls application.authenticate with the credentials of the
+// application of Alice
+func authenticate(t *testing.T, s *Server, store *memStore, klink string, permissions ...string) RPCResponse {
+	params, _ := json.Marshal(permissions)
+	body := fmt.Sprintf(`{"id":"1","params":{"app_url":"https://alice.example.com","app_secret":"alice","klink_id":%q,"permissions":%s}}`,
+		klink, params)
+
+	rec := serve(t, s, store, 0, "POST", "/api/1.0/application.authenticate", body)
+
+	var response RPCResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+	}
+	return response
+}
+
+func TestAuthenticateKlinkPermissions(t *testing.T) {
+	s, store := newTestServer(t)
+
+	// the application may add data, but not inside the klink. Clients that
+	// pass no klink are checked against the application permissions.
+	app, _ := store.GetApplicationByID(testAliceAppID)
+	app.Permissions = []string{"data-search", "data-add"}
+	store.ReplaceApplication(app)
+
+	cases := []struct {
+		klink       string
+		permissions []string
+		granted     bool
+	}{
+		{"", []string{"data-search"}, true},
+		{"", []string{"data-add"}, true},
+		{testKlinkIdentifier, []string{"data-search"}, true},
+		{testKlinkIdentifier, []string{"data-add"}, false},
+		{"k-unknown", []string{"data-search"}, false},
+	}
+
+	for _, c := range cases {
+		response := authenticate(t, s, store, c.klink, c.permissions...)
+		if granted := response.Error == nil; granted != c.granted {
+			t.Errorf("klink %q with %v: expected granted %v, got error %v",
+				c.klink, c.permissions, c.granted, response.Error)
+		}
+	}
+
+	response := authenticate(t, s, store, "")
+	result, _ := json.Marshal(response.Result)
+	var authenticated struct {
+		Permissions []string        `json:"permissions"`
+		Klinks      []KlinkResponse `json:"klinks"`
+	}
+	json.Unmarshal(result, &authenticated)
+
+	if len(authenticated.Permissions) != 2 {
+		t.Errorf("expected the application permissions to be unchanged, got %v", authenticated.Permissions)
+	}
+	if len(authenticated.Klinks) != 1 || len(authenticated.Klinks[0].Permissions) != 1 || authenticated.Klinks[0].Permissions[0] != "data-search" {
+		t.Errorf("expected the klink entry to list its own permissions, got %+v", authenticated.Klinks)
+	}
+}
+
+func TestAuthenticateImpliedPermissions(t *testing.T) {
+	s, store := newTestServer(t)
+	ReconcilePermissions(store, DefaultPermissions)
+
+	app, _ := store.GetApplicationByID(testAliceAppID)
+	app.Permissions = []string{"data-remove-*"}
+	app.SetGrants([]KlinkGrant{{Klink: testKlinkIdentifier, Permissions: []string{"data-edit", "data-remove-*"}}})
+	store.ReplaceApplication(app)
+
+	cases := []struct {
+		klink       string
+		permissions []string
+		granted     bool
+	}{
+		{"", []string{"data-remove-all", "data-remove-own"}, true},
+		{"", []string{"data-view"}, false},
+		{testKlinkIdentifier, []string{"data-edit", "data-view"}, true},
+		{testKlinkIdentifier, []string{"data-remove-own"}, true},
+		{testKlinkIdentifier, []string{"data-add"}, false},
+	}
+
+	for _, c := range cases {
+		response := authenticate(t, s, store, c.klink, c.permissions...)
+		if granted := response.Error == nil; granted != c.granted {
+			t.Errorf("klink %q with %v: expected granted %v, got error %v",
+				c.klink, c.permissions, c.granted, response.Error)
+		}
+	}
+
+	response := authenticate(t, s, store, "")
+	result, _ := json.Marshal(response.Result)
+	var authenticated struct {
+		Permissions []string        `json:"permissions"`
+		Klinks      []KlinkResponse `json:"klinks"`
+	}
+	json.Unmarshal(result, &authenticated)
+
+	if len(authenticated.Permissions) != 2 {
+		t.Errorf("expected the wildcard to be expanded, got %v", authenticated.Permissions)
+	}
+	if len(authenticated.Klinks) != 1 || !isSubset([]string{"data-edit", "data-view"}, authenticated.Klinks[0].Permissions) {
+		t.Errorf("expected the klink entry to list the effective permissions, got %+v", authenticated.Klinks)
+	}
+}
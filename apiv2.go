@@ -3,7 +3,6 @@ package klinkregistry
 import (
 	"encoding/json"
 	"fmt"
-	"log"
 	"net/http"
 	"strings"
 	"time"
@@ -32,11 +31,41 @@ var (
 	API2ErrUnauthorized             = Error{401, "Unauthorized", ""}
 	API2ErrInvalidCredentials       = Error{403, "Invalid Credentials", ""}
 	API2ErrAccountDisabled          = Error{403, "Account disabled", ""}
+	API2ErrForbidden                = Error{403, "Insufficient privileges", ""}
 	API2ErrInvalidURL               = Error{403, "URL could not be understood", ""}
 	API2ErrNotFound                 = Error{404, "Resource not found", ""}
 	API2ErrTokenExpired             = Error{404, "Token has expired", ""}
 	API2ErrUserNotAdmin             = Error{422, "The specified user is not existing or is not an administrator", ""}
 	API2ErrUserRegistrationDisabled = Error{409, "User registration is disabled", ""}
+	API2ErrInvalidRole              = Error{422, "The specified role does not exist or cannot be assigned", ""}
+	API2ErrInvalidKlinkRole         = Error{422, "The specified K-Link role does not exist", ""}
+	API2ErrLastKlinkManager         = Error{409, "A K-Link needs at least one manager", ""}
+	API2ErrInvalidKlink             = Error{422, "The specified K-Link does not exist or is not active", ""}
+	API2ErrInvalidPermissions       = Error{422, "The specified permissions do not exist", ""}
+	API2ErrRequestPending           = Error{409, "A request is already pending", ""}
+	API2ErrRequestDecided           = Error{409, "The request has already been decided", ""}
+	API2ErrGrantRequired            = Error{403, "Permissions and K-Links can only be added through an access request", ""}
+	API2ErrInvalidPermissionName    = Error{422, "Permission names may only contain lowercase letters, digits, dots and dashes", ""}
+	API2ErrPermissionExists         = Error{409, "The permission already exists", ""}
+	API2ErrPermissionBuiltIn        = Error{409, "Built-in permissions cannot be deleted", ""}
+	API2ErrPermissionGranted        = Error{409, "The permission is still granted to applications", ""}
+	API2ErrInvalidImplies           = Error{422, "A permission can only imply other existing permissions", ""}
+	API2ErrInvalidValidity          = Error{422, "The validity period is invalid", ""}
+	API2ErrInvalidOrigin            = Error{422, "The origin is not a valid http(s) URL or wildcard pattern", ""}
+	API2ErrOriginTaken              = Error{409, "The origin is already used by another application", ""}
+	API2ErrVerificationFailed       = Error{422, "The domain of the application could not be verified", ""}
+	API2ErrInvalidOwner             = Error{422, "The new owner is not an active registrant", ""}
+	API2ErrTransferExpired          = Error{422, "The transfer has expired", ""}
+	API2ErrAlreadyMember            = Error{409, "The registrant is already a member of the K-Link", ""}
+	API2ErrInvalidMetadata          = Error{422, "The description of the application is invalid", ""}
+	API2ErrInvalidHealthURL         = Error{422, "The health-check URL is not a valid http(s) URL", ""}
+	API2ErrFederated                = Error{409, "The record is managed by the registry it was imported from", ""}
+	API2ErrInvalidPeer              = Error{422, "The peer needs a name and a valid http(s) URL", ""}
+	API2ErrPeerExists               = Error{409, "A peer with this key already exists", ""}
+	API2ErrSyncFailed               = Error{502, "The changes of the peer could not be synchronised", ""}
+	API2ErrInvalidWebhook           = Error{422, "The webhook needs a valid http(s) URL and known event types", ""}
+	API2ErrInvalidLastEventID       = Error{400, "The Last-Event-ID is not a valid event id", ""}
+	API2ErrRateLimited              = Error{429, "Too many requests, please retry later", ""}
 )
 
 // RegistrationRequest contains all information to start the registtation
@@ -52,14 +81,10 @@ type API2EmptyResponse struct{}
 
 // SessionResponse contains information about a user session
 type SessionResponse struct {
-	UserID int64  `json:"user_id"`
-	Role   string `json:"role"`
-	Token  string `json:"token"`
-}
-
-// PermissionModel is the JSON representation of a Permission
-type PermissionModel struct {
-	Name string `json:"name"`
+	UserID       int64    `json:"user_id"`
+	Role         string   `json:"role"`
+	Capabilities []string `json:"capabilities"`
+	Token        string   `json:"token"`
 }
 
 // EmailVerificationModel contains additional information about
@@ -77,9 +102,14 @@ func jsonResponse(w http.ResponseWriter, obj interface{}) {
 
 	var status = 200
 
-	// If the returned object is an error, set status accordingly
+	// If the returned object is an error, set status accordingly, and add
+	// the request ID so that it can be found in the logs
 	if apiErr, ok := obj.(Error); ok {
 		status = apiErr.Status
+		obj = struct {
+			Error
+			RequestID string `json:"request_id,omitempty"`
+		}{apiErr, w.Header().Get(HeaderRequestID)}
 	}
 
 	bytes, err := json.Marshal(obj)
@@ -94,29 +124,6 @@ func jsonResponse(w http.ResponseWriter, obj interface{}) {
 	w.Write(bytes)
 }
 
-// handleListPermissions provides an endpoint that returns a list of all
-// permissions inside the database
-func (s *Server) handleListPermissions() http.HandlerFunc {
-	return func(w http.ResponseWriter, req *http.Request) {
-		var responses []PermissionModel
-
-		permissions, err := s.store.ListPermissions()
-		if s.store.IsNotFound(err) {
-			jsonResponse(w, responses)
-			return
-		} else if err != nil {
-			jsonResponse(w, API2ErrDatabase)
-			return
-		}
-
-		for _, permission := range permissions {
-			responses = append(responses, PermissionModel(*permission))
-		}
-
-		jsonResponse(w, responses)
-	}
-}
-
 // handlePostRegistration provides an endpoint that allows creation of new
 // registrations.
 // This handler will create an Registrant and an emailVerification.
@@ -150,7 +157,7 @@ func (s *Server) handlePostRegistration() http.HandlerFunc {
 				jsonResponse(w, API2ErrDuplicateUser)
 				return
 			} else {
-				fmt.Println(err)
+				s.requestLogger(req).WithError(err).Error("Error creating registrant")
 				jsonResponse(w, API2ErrGeneric)
 				return
 			}
@@ -227,7 +234,7 @@ func (s *Server) handleGetVerifyEmail() http.HandlerFunc {
 		// fetch User
 		user, err := s.store.GetRegistrantByID(verification.RegistrantID)
 		if s.store.IsNotFound(err) {
-			log.Printf("Verification: Registrant %d No longer exists", verification.RegistrantID)
+			s.requestLogger(req).WithField("registrant", verification.RegistrantID).Warn("Verification: Registrant no longer exists")
 			jsonResponse(w, API2ErrNotFound)
 			return
 		} else if err != nil {
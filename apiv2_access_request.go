@@ -0,0 +1,379 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// AccessRequestModel is the JSON representation of an AccessRequest
+type AccessRequestModel struct {
+	ID            int64    `json:"id"`
+	ApplicationID int64    `json:"application_id"`
+	Klink         string   `json:"klink"`
+	Permissions   []string `json:"permissions"`
+	Status        string   `json:"status"`
+	Reason        string   `json:"reason"`
+	RequestedBy   int64    `json:"requested_by"`
+	DecidedBy     int64    `json:"decided_by"`
+	CreatedAt     int64    `json:"created_at"`
+	DecidedAt     int64    `json:"decided_at"`
+}
+
+// DecisionRequest contains the optional explanation of a decision
+type DecisionRequest struct {
+	Reason string `json:"reason"`
+}
+
+func newAccessRequestModel(r *AccessRequest, klink *Klink) AccessRequestModel {
+	return AccessRequestModel{
+		ID:            r.ID,
+		ApplicationID: r.ApplicationID,
+		Klink:         klink.Identifier,
+		Permissions:   r.Permissions,
+		Status:        r.Status,
+		Reason:        r.Reason,
+		RequestedBy:   r.RequestedBy,
+		DecidedBy:     r.DecidedBy,
+		CreatedAt:     r.CreatedAt,
+		DecidedAt:     r.DecidedAt,
+	}
+}
+
+// mergeStrings returns the entries of a followed by all entries of b that are
+// not part of a yet
+func mergeStrings(a, b []string) []string {
+	merged := append([]string{}, a...)
+	for _, s := range b {
+		if s != "" && !stringInSlice(s, merged) {
+			merged = append(merged, s)
+		}
+	}
+	return merged
+}
+
+// isSubset returns true if every entry of a is also part of b
+func isSubset(a, b []string) bool {
+	for _, s := range a {
+		if !stringInSlice(s, b) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPermissionNames returns false if any of the names is not part of the
+// permissions inside the database, or is deprecated. Wildcards have to match
+// at least one permission that is not deprecated.
+func (s *Server) checkPermissionNames(names []string) (bool, error) {
+	permissions, err := s.store.ListPermissions()
+	if err != nil && !s.store.IsNotFound(err) {
+		return false, err
+	}
+
+	for _, name := range names {
+		matched := false
+		for _, permission := range permissions {
+			if !permission.Deprecated && matchPermission(name, permission.Name) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// applicationFromURL returns the application identified in the URL, if the
+// user may act on its behalf. Otherwise an error is sent to the client and
+// nil is returned.
+func (s *Server) applicationFromURL(w http.ResponseWriter, req *http.Request, capability string) *Application {
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		jsonResponse(w, API2ErrInvalidURL)
+		return nil
+	}
+
+	app, err := s.store.GetApplicationByID(id)
+	if s.store.IsNotFound(err) {
+		jsonResponse(w, API2ErrNotFound)
+		return nil
+	} else if err != nil {
+		jsonResponse(w, API2ErrDatabase)
+		return nil
+	}
+
+	user := s.sessions.GetUser(req)
+	if user.ID != app.OwnerID && !s.can(user, capability) {
+		jsonResponse(w, API2ErrForbidden)
+		return nil
+	}
+
+	// imported applications can only be viewed
+	if app.PeerID != 0 && capability != CapApplicationView {
+		jsonResponse(w, API2ErrFederated)
+		return nil
+	}
+
+	return app
+}
+
+// handleCreateAccessRequest provides an endpoint that allows the owner of an
+// application to request access to a klink. The managers of the klink are
+// notified by email.
+func (s *Server) handleCreateAccessRequest() http.HandlerFunc {
+	type Request struct {
+		Klink       string   `json:"klink"`
+		Permissions []string `json:"permissions"`
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request Request
+
+		app := s.applicationFromURL(w, req, CapApplicationUpdate)
+		if app == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		klink, err := s.store.GetKlinkByIdentifier(request.Klink)
+		if s.store.IsNotFound(err) || (err == nil && !klink.Active) {
+			jsonResponse(w, API2ErrInvalidKlink)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if len(request.Permissions) == 0 {
+			jsonResponse(w, API2ErrInvalidPermissions)
+			return
+		}
+		if ok, err := s.checkPermissionNames(request.Permissions); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		} else if !ok {
+			jsonResponse(w, API2ErrInvalidPermissions)
+			return
+		}
+
+		// only one request per klink may be pending
+		existing, err := s.store.ListAccessRequestsByApplication(app.ID)
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		for _, r := range existing {
+			if r.KlinkID == klink.ID && r.Status == RequestPending {
+				jsonResponse(w, API2ErrRequestPending)
+				return
+			}
+		}
+
+		accessRequest := &AccessRequest{
+			ApplicationID: app.ID,
+			KlinkID:       klink.ID,
+			Permissions:   request.Permissions,
+			Status:        RequestPending,
+			RequestedBy:   s.sessions.GetUser(req).ID,
+			CreatedAt:     time.Now().UTC().Unix(),
+		}
+		if err := s.store.CreateAccessRequest(accessRequest); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		s.notifyKlinkMembers(klink, CapKlinkApplicationApprove,
+			"Access to "+klink.Name+" requested",
+			fmt.Sprintf("The application %q (%s) requests access to the K-Link %q with the permissions: %s\n\nPlease approve or reject the request: %s",
+				app.Name, app.URL, klink.Name,
+				strings.Join(accessRequest.Permissions, ", "),
+				s.link("klinks/%s", klink.Identifier)),
+		)
+
+		jsonResponse(w, newAccessRequestModel(accessRequest, klink))
+	}
+}
+
+// handleListApplicationAccessRequests provides an endpoint that returns the
+// access requests of an application
+func (s *Server) handleListApplicationAccessRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []AccessRequestModel
+
+		app := s.applicationFromURL(w, req, CapApplicationView)
+		if app == nil {
+			return
+		}
+
+		requests, err := s.store.ListAccessRequestsByApplication(app.ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		klinks := make(map[int64]*Klink)
+		for _, r := range requests {
+			klink, ok := klinks[r.KlinkID]
+			if !ok {
+				klink, err = s.store.GetKlinkByPrimaryKey(r.KlinkID)
+				if err != nil {
+					jsonResponse(w, API2ErrDatabase)
+					return
+				}
+				klinks[r.KlinkID] = klink
+			}
+
+			responses = append(responses, newAccessRequestModel(r, klink))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleListKlinkAccessRequests provides an endpoint that returns the access
+// requests for a klink. The list can be filtered by the `status` query
+// parameter.
+func (s *Server) handleListKlinkAccessRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []AccessRequestModel
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if !s.canInKlink(s.sessions.GetUser(req), klink, CapKlinkApplicationApprove) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		requests, err := s.store.ListAccessRequestsByKlink(klink.ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		status := req.URL.Query().Get("status")
+		for _, r := range requests {
+			if status != "" && r.Status != status {
+				continue
+			}
+			responses = append(responses, newAccessRequestModel(r, klink))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleDecideAccessRequest provides an endpoint that allows the managers of
+// a klink to approve or reject an access request. On approval, the requested
+// permissions are granted inside the klink. They are also added to the
+// application permissions, which are still used by clients that do not
+// check permissions per klink. The owner of the application is notified by
+// email.
+func (s *Server) handleDecideAccessRequest(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request DecisionRequest
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		user := s.sessions.GetUser(req)
+		if !s.canInKlink(user, klink, CapKlinkApplicationApprove) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(req, "request"), 10, 64)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidURL)
+			return
+		}
+
+		accessRequest, err := s.store.GetAccessRequestByID(id)
+		if s.store.IsNotFound(err) || (err == nil && accessRequest.KlinkID != klink.ID) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if accessRequest.Status != RequestPending {
+			jsonResponse(w, API2ErrRequestDecided)
+			return
+		}
+
+		// the reason is optional, so an empty body is accepted
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil && err != io.EOF {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		app, err := s.store.GetApplicationByID(accessRequest.ApplicationID)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		accessRequest.Status = RequestRejected
+		if approve {
+			accessRequest.Status = RequestApproved
+
+			app.AddGrant(klink.Identifier, accessRequest.Permissions)
+			app.Permissions = mergeStrings(app.Permissions, accessRequest.Permissions)
+			if err := s.store.ReplaceApplication(app); err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+			s.emitApplication(EventApplicationUpdated, app)
+		}
+
+		accessRequest.Reason = request.Reason
+		accessRequest.DecidedBy = user.ID
+		accessRequest.DecidedAt = time.Now().UTC().Unix()
+		if err := s.store.UpdateAccessRequest(accessRequest); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		text := fmt.Sprintf("The request of your application %q to access the K-Link %q has been %s.",
+			app.Name, klink.Name, accessRequest.Status)
+		if accessRequest.Reason != "" {
+			text += "\n\nReason: " + accessRequest.Reason
+		}
+		s.notifyRegistrant(app.OwnerID, "Access to "+klink.Name+" "+accessRequest.Status, text)
+
+		jsonResponse(w, newAccessRequestModel(accessRequest, klink))
+	}
+}
@@ -11,18 +11,98 @@ import (
 
 // ApplicationModel is the JSON representation of an Application
 type ApplicationModel struct {
-	ID          int64    `json:"id"`
-	OwnerID     int64    `json:"owner_id"`
-	Name        string   `json:"name"`
-	URL         string   `json:"app_domain"`
-	Token       string   `json:"token"`
-	Permissions []string `json:"permissions"`
-	Klinks      []string `json:"klinks"`
-	Active      bool     `json:"active"`
+	ID               int64        `json:"id"`
+	OwnerID          int64        `json:"owner_id"`
+	Name             string       `json:"name"`
+	URL              string       `json:"app_domain"`
+	Origins          []string     `json:"origins"`
+	Token            string       `json:"token"`
+	Permissions      []string     `json:"permissions"`
+	Klinks           []string     `json:"klinks"`
+	Grants           []KlinkGrant `json:"grants"`
+	Active           bool         `json:"active"`
+	ValidFrom        int64        `json:"valid_from"`
+	ValidUntil       int64        `json:"valid_until"`
+	ReminderSentFor  int64        `json:"-"`
+	ChallengeToken   string       `json:"challenge_token"`
+	VerifiedAt       int64        `json:"verified_at"`
+	Description      string       `json:"description"`
+	Tags             []string     `json:"tags"`
+	TechnicalContact string       `json:"technical_contact"`
+	SecurityContact  string       `json:"security_contact"`
+	LogoURL          string       `json:"logo_url"`
+	Environment      string       `json:"environment"`
+	PeerID           int64        `json:"peer_id"`
+	RemoteID         int64        `json:"-"`
+}
+
+// requestedGrants returns the grants of an application create or update
+// request. Clients that only send the list of klinks keep the permissions of
+// the current grants, while new klinks are granted the application
+// permissions.
+func requestedGrants(request ApplicationModel, current *Application) []KlinkGrant {
+	if request.Grants != nil {
+		return request.Grants
+	}
+
+	var grants []KlinkGrant
+	for _, klink := range request.Klinks {
+		if grant := current.GetGrant(klink); grant != nil {
+			grants = append(grants, *grant)
+			continue
+		}
+		grants = append(grants, KlinkGrant{Klink: klink, Permissions: request.Permissions})
+	}
+	return grants
+}
+
+// grantsCovered returns true if each of the grants is part of the current
+// grants of the application, with at most the same permissions
+func grantsCovered(grants []KlinkGrant, current *Application) bool {
+	for _, grant := range grants {
+		currentGrant := current.GetGrant(grant.Klink)
+		if currentGrant == nil || !isSubset(grant.Permissions, currentGrant.Permissions) {
+			return false
+		}
+	}
+	return true
+}
+
+// klinkIdentifiersWith returns the identifiers of all klinks in which the
+// user holds the capability through a membership
+func (s *Server) klinkIdentifiersWith(u *User, capability string) (map[string]bool, error) {
+	identifiers := make(map[string]bool)
+
+	ids, err := s.klinksWith(u, capability)
+	if err != nil {
+		return nil, err
+	}
+
+	for id := range ids {
+		klink, err := s.store.GetKlinkByPrimaryKey(id)
+		if s.store.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		identifiers[klink.Identifier] = true
+	}
+	return identifiers, nil
+}
+
+// publishesTo returns true if the application publishes to any of the klinks
+func publishesTo(app *Application, identifiers map[string]bool) bool {
+	for _, identifier := range app.Klinks {
+		if identifiers[identifier] {
+			return true
+		}
+	}
+	return false
 }
 
 // handleListApplications provides an endpoint that returns a list of all
-// applications inside the database
+// applications inside the database. The list can be filtered by the `tag`,
+// `environment` and `q` query parameters.
 func (s *Server) handleListApplications() http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
 		var responses []ApplicationModel
@@ -38,10 +118,23 @@ func (s *Server) handleListApplications() http.HandlerFunc {
 
 		user := s.sessions.GetUser(req)
 
+		// applications are also visible to the members of the klinks
+		// they publish to
+		klinks, err := s.klinkIdentifiersWith(user, CapKlinkApplicationView)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		query := req.URL.Query()
 		for _, application := range applications {
-			// remove all applications not owned by the registrant,
-			// if the registrant is an USER (not ADMIN or OWNER)
-			if user.Role == RoleUser && application.OwnerID != user.ID {
+			// remove all applications not owned by the registrant, unless
+			// the registrant may view every application
+			if !s.can(user, CapApplicationView) && application.OwnerID != user.ID && !publishesTo(application, klinks) {
+				continue
+			}
+
+			if !matchesFilter(application, query) {
 				continue
 			}
 
@@ -69,16 +162,24 @@ func (s *Server) handleGetApplication() http.HandlerFunc {
 			jsonResponse(w, API2ErrNotFound)
 			return
 		} else if err != nil {
-			fmt.Println(err)
+			s.requestLogger(req).WithError(err).Error("Error loading application")
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
 
 		user := s.sessions.GetUser(req)
-		// do not show unowned applications if the registrant is an USER
-		// (not ADMIN or OWNER)
-		if user.Role == RoleUser && application.OwnerID != user.ID {
-			jsonResponse(w, API2ErrUnauthorized)
+
+		klinks, err := s.klinkIdentifiersWith(user, CapKlinkApplicationView)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		// do not show unowned applications, unless the registrant may view
+		// every application or the application publishes to a klink the
+		// registrant is a member of
+		if !s.can(user, CapApplicationView) && application.OwnerID != user.ID && !publishesTo(application, klinks) {
+			jsonResponse(w, API2ErrForbidden)
 			return
 		}
 
@@ -103,21 +204,62 @@ func (s *Server) handleCreateApplication() http.HandlerFunc {
 
 		u := s.sessions.GetUser(req)
 
+		if !s.can(u, CapApplicationCreate) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
 		app := Application(request)
 
 		app.ID = 0                  // ID will be autogenerated by the database
 		app.Token = generateToken() // Token set by user will be ignored
+		app.ReminderSentFor = 0
+		app.ChallengeToken = generateToken() // the domain has to be verified
+		app.VerifiedAt = 0
+		app.PeerID = 0 // only the synchronisation imports applications
+		app.RemoteID = 0
+
+		// Without the renew capability, the validity period can only be
+		// changed through a renewal request
+		if !s.can(u, CapApplicationRenew) {
+			app.ValidFrom = 0
+			app.ValidUntil = 0
+		}
 
-		// If user is in the user role, it is not possible to change application
-		// ownership
-		if u.Role == RoleUser {
+		// Without the set-owner capability, it is not possible to create
+		// applications for somebody else
+		if !s.can(u, CapApplicationSetOwner) || app.OwnerID == 0 {
 			app.OwnerID = u.ID
+		} else if s.activeRegistrant(w, app.OwnerID) == nil {
+			return
+		}
+
+		// Without the grant capability, permissions and klinks have to be
+		// requested through an access request
+		if s.can(u, CapApplicationGrant) {
+			app.SetGrants(requestedGrants(request, &Application{}))
+		} else {
+			app.Permissions = []string{}
+			app.SetGrants(nil)
+		}
+
+		if err := normalizeMetadata(&app); err != nil {
+			apiErr := API2ErrInvalidMetadata
+			apiErr.Context = err.Error()
+			jsonResponse(w, apiErr)
+			return
+		}
+
+		if apiErr := s.checkOrigins(&app); apiErr != nil {
+			jsonResponse(w, *apiErr)
+			return
 		}
 
 		if err := s.store.CreateApplication(&app); err != nil {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitApplication(EventApplicationCreated, &app)
 
 		response = ApplicationModel(app)
 
@@ -153,11 +295,16 @@ func (s *Server) handleUpdateApplication() http.HandlerFunc {
 		// check if we have permission to edit this application
 		if user.ID == app.OwnerID {
 			// we must either be the owner of this application ..
-		} else if user.Role == RoleOwner || user.Role == RoleAdmin {
-			// .. or have a role of admin or owner.
+		} else if s.can(user, CapApplicationUpdate) {
+			// .. or be allowed to edit every application.
 		} else {
 			// otherwise we can strop processing here
-			jsonResponse(w, API2ErrInvalidCredentials)
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if app.PeerID != 0 {
+			jsonResponse(w, API2ErrFederated)
 			return
 		}
 
@@ -166,21 +313,66 @@ func (s *Server) handleUpdateApplication() http.HandlerFunc {
 			return
 		}
 
+		// Without the grant capability, permissions and klinks can only be
+		// removed. New ones have to be requested through an access request.
+		grants := requestedGrants(request, app)
+		if !s.can(user, CapApplicationGrant) {
+			if !isSubset(request.Permissions, app.Permissions) || !grantsCovered(grants, app) {
+				jsonResponse(w, API2ErrGrantRequired)
+				return
+			}
+		}
+
+		previousURL, previousOrigins := app.URL, app.Origins
+
 		// use the application as a base to apply our request to:
 		// app.ID must stay the same.
 		app.Active = request.Active
 		app.Name = request.Name
 		app.Permissions = request.Permissions
-		app.Klinks = request.Klinks
+		app.SetGrants(grants)
 		app.URL = request.URL
+		app.Origins = request.Origins
+		app.Description = request.Description
+		app.Tags = request.Tags
+		app.TechnicalContact = request.TechnicalContact
+		app.SecurityContact = request.SecurityContact
+		app.LogoURL = request.LogoURL
+		app.Environment = request.Environment
+
+		if err := normalizeMetadata(app); err != nil {
+			apiErr := API2ErrInvalidMetadata
+			apiErr.Context = err.Error()
+			jsonResponse(w, apiErr)
+			return
+		}
+
+		if apiErr := s.checkOrigins(app); apiErr != nil {
+			jsonResponse(w, *apiErr)
+			return
+		}
+
+		// a new domain or new origins have to be verified again, removing
+		// origins keeps the verification
+		if !sameDomain(previousURL, app.URL) || !isSubset(app.Origins, previousOrigins) {
+			app.ChallengeToken = generateToken()
+			app.VerifiedAt = 0
+		}
 
-		// allow change of owner, if user is admin or owner
-		if user.Role == RoleOwner || user.Role == RoleAdmin {
+		// allow change of owner, if user may set application owners. The new
+		// owner has to be an active registrant. Owners without this
+		// capability transfer their applications via an ownership transfer.
+		previousOwnerID := app.OwnerID
+		if s.can(user, CapApplicationSetOwner) && request.OwnerID != 0 && request.OwnerID != app.OwnerID {
+			if s.activeRegistrant(w, request.OwnerID) == nil {
+				return
+			}
 			app.OwnerID = request.OwnerID
 		}
 
 		// regenerate user token, if it is different
-		if request.Token != app.Token {
+		rotated := request.Token != app.Token
+		if rotated {
 			app.Token = generateToken()
 		}
 
@@ -188,6 +380,18 @@ func (s *Server) handleUpdateApplication() http.HandlerFunc {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitApplication(EventApplicationUpdated, app)
+		if rotated {
+			s.emit(EventApplicationTokenRotated, app.ID, newApplicationEvent(app))
+		}
+
+		if app.OwnerID != previousOwnerID {
+			s.auditTransfer(user.ID, app, previousOwnerID, app.OwnerID, AuditGranted, "direct")
+
+			text := fmt.Sprintf("The owner of the application %q has been changed by an administrator.", app.Name)
+			s.notifyRegistrant(previousOwnerID, "Transfer of "+app.Name, text)
+			s.notifyRegistrant(app.OwnerID, "Transfer of "+app.Name, text)
+		}
 
 		response = ApplicationModel(*app)
 		jsonResponse(w, response)
@@ -220,10 +424,15 @@ func (s *Server) handleDeleteApplication() http.HandlerFunc {
 
 		if user.ID == app.OwnerID {
 			// registrants can remove their own applications
-		} else if user.Role == RoleOwner || user.Role == RoleAdmin {
-			// an admin or owner role may remove everything
+		} else if s.can(user, CapApplicationDelete) {
+			// some roles may remove everything
 		} else {
-			jsonResponse(w, API2ErrUnauthorized)
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if app.PeerID != 0 {
+			jsonResponse(w, API2ErrFederated)
 			return
 		}
 
@@ -231,6 +440,7 @@ func (s *Server) handleDeleteApplication() http.HandlerFunc {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitApplication(EventApplicationDeleted, app)
 
 		jsonResponse(w, API2EmptyResponse{})
 		return
@@ -0,0 +1,58 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// AuthorizationModel is the JSON representation of an Authorization
+type AuthorizationModel struct {
+	Granted bool                 `json:"granted"`
+	Reason  string               `json:"reason,omitempty"`
+	Checks  []AuthorizationCheck `json:"checks"`
+}
+
+// handleApplicationDryRun provides an endpoint that runs the checks of
+// application.authenticate for an application, and explains the result of
+// each check. The secret is optional, as the registrant is authenticated.
+func (s *Server) handleApplicationDryRun() http.HandlerFunc {
+	type Request struct {
+		AppSecret   string   `json:"app_secret"`
+		Permissions []string `json:"permissions"`
+		KlinkID     string   `json:"klink_id"`
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request Request
+
+		app := s.applicationFromURL(w, req, CapApplicationView)
+		if app == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		auth := s.authorize(AuthorizationRequest{
+			AppURL:      app.URL,
+			AppSecret:   request.AppSecret,
+			Permissions: request.Permissions,
+			KlinkID:     request.KlinkID,
+			SkipSecret:  request.AppSecret == "",
+		})
+
+		// the domain could be registered by another application as well
+		if auth.App != nil && auth.App.ID != app.ID {
+			auth = &Authorization{}
+			auth.fail("application", DenyUnknownApplication, app.URL+" resolves to another application")
+		}
+
+		jsonResponse(w, AuthorizationModel{
+			Granted: auth.Granted(),
+			Reason:  auth.Reason,
+			Checks:  auth.Checks,
+		})
+	}
+}
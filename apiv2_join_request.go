@@ -0,0 +1,270 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// JoinRequestModel is the JSON representation of a JoinRequest
+type JoinRequestModel struct {
+	ID            int64  `json:"id"`
+	Klink         string `json:"klink"`
+	RegistrantID  int64  `json:"registrant_id"`
+	Justification string `json:"justification"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason"`
+	DecidedBy     int64  `json:"decided_by"`
+	CreatedAt     int64  `json:"created_at"`
+	DecidedAt     int64  `json:"decided_at"`
+}
+
+func newJoinRequestModel(r *JoinRequest, klink *Klink) JoinRequestModel {
+	return JoinRequestModel{
+		ID:            r.ID,
+		Klink:         klink.Identifier,
+		RegistrantID:  r.RegistrantID,
+		Justification: r.Justification,
+		Status:        r.Status,
+		Reason:        r.Reason,
+		DecidedBy:     r.DecidedBy,
+		CreatedAt:     r.CreatedAt,
+		DecidedAt:     r.DecidedAt,
+	}
+}
+
+// handleCreateJoinRequest provides an endpoint that allows registrants to
+// request the membership of an active klink. The managers of the klink are
+// notified by email.
+func (s *Server) handleCreateJoinRequest() http.HandlerFunc {
+	type Request struct {
+		Justification string `json:"justification"`
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request Request
+
+		user := s.sessions.GetUser(req)
+		if !s.can(user, CapKlinkJoin) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) || (err == nil && !klink.Active) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if _, err := s.store.GetKlinkMember(klink.ID, user.ID); err == nil {
+			jsonResponse(w, API2ErrAlreadyMember)
+			return
+		} else if !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		existing, err := s.store.ListJoinRequestsByRegistrant(user.ID)
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		for _, r := range existing {
+			if r.KlinkID == klink.ID && r.Status == RequestPending {
+				jsonResponse(w, API2ErrRequestPending)
+				return
+			}
+		}
+
+		joinRequest := &JoinRequest{
+			KlinkID:       klink.ID,
+			RegistrantID:  user.ID,
+			Justification: request.Justification,
+			Status:        RequestPending,
+			CreatedAt:     time.Now().UTC().Unix(),
+		}
+		if err := s.store.CreateJoinRequest(joinRequest); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		s.notifyKlinkMembers(klink, CapKlinkMemberManage,
+			user.DisplayName+" requests to join "+klink.Name,
+			fmt.Sprintf("%s requests to join the K-Link %q.\n\n%s\n\nPlease approve or reject the request: %s",
+				user.DisplayName, klink.Name, joinRequest.Justification,
+				s.link("klinks/%s", klink.Identifier)),
+		)
+		s.notifyRegistrant(user.ID, "Request to join "+klink.Name,
+			fmt.Sprintf("Your request to join the K-Link %q has been sent to its managers.", klink.Name))
+
+		jsonResponse(w, newJoinRequestModel(joinRequest, klink))
+	}
+}
+
+// handleListKlinkJoinRequests provides an endpoint that returns the join
+// requests of a klink, including the decided ones. The list can be filtered
+// by the `status` query parameter.
+func (s *Server) handleListKlinkJoinRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []JoinRequestModel
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if !s.canInKlink(s.sessions.GetUser(req), klink, CapKlinkMemberManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		requests, err := s.store.ListJoinRequestsByKlink(klink.ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		status := req.URL.Query().Get("status")
+		for _, r := range requests {
+			if status != "" && r.Status != status {
+				continue
+			}
+			responses = append(responses, newJoinRequestModel(r, klink))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleListOwnJoinRequests provides an endpoint that returns the join
+// requests of the registrant
+func (s *Server) handleListOwnJoinRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []JoinRequestModel
+
+		requests, err := s.store.ListJoinRequestsByRegistrant(s.sessions.GetUser(req).ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, r := range requests {
+			klink, err := s.store.GetKlinkByPrimaryKey(r.KlinkID)
+			if err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+			responses = append(responses, newJoinRequestModel(r, klink))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleDecideJoinRequest provides an endpoint that allows the managers of a
+// klink to approve or reject a join request. On approval, the registrant
+// becomes a viewer of the klink. The registrant is notified by email.
+func (s *Server) handleDecideJoinRequest(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request DecisionRequest
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		user := s.sessions.GetUser(req)
+		if !s.canInKlink(user, klink, CapKlinkMemberManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(req, "request"), 10, 64)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidURL)
+			return
+		}
+
+		joinRequest, err := s.store.GetJoinRequestByID(id)
+		if s.store.IsNotFound(err) || (err == nil && joinRequest.KlinkID != klink.ID) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if joinRequest.Status != RequestPending {
+			jsonResponse(w, API2ErrRequestDecided)
+			return
+		}
+
+		// the reason is optional, so an empty body is accepted
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil && err != io.EOF {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		joinRequest.Status = RequestRejected
+		if approve {
+			joinRequest.Status = RequestApproved
+
+			// keep the role of registrants that have been added meanwhile
+			_, err := s.store.GetKlinkMember(klink.ID, joinRequest.RegistrantID)
+			if s.store.IsNotFound(err) {
+				err = s.store.SaveKlinkMember(&KlinkMember{
+					KlinkID:      klink.ID,
+					RegistrantID: joinRequest.RegistrantID,
+					Role:         KlinkRoleViewer,
+				})
+			}
+			if err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+		}
+
+		joinRequest.Reason = request.Reason
+		joinRequest.DecidedBy = user.ID
+		joinRequest.DecidedAt = time.Now().UTC().Unix()
+		if err := s.store.UpdateJoinRequest(joinRequest); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		text := fmt.Sprintf("Your request to join the K-Link %q has been %s.", klink.Name, joinRequest.Status)
+		if joinRequest.Reason != "" {
+			text += "\n\nReason: " + joinRequest.Reason
+		}
+		s.notifyRegistrant(joinRequest.RegistrantID, "Request to join "+klink.Name+" "+joinRequest.Status, text)
+
+		jsonResponse(w, newJoinRequestModel(joinRequest, klink))
+	}
+}
@@ -2,8 +2,6 @@ package klinkregistry
 
 import (
 	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/go-chi/chi"
@@ -11,13 +9,18 @@ import (
 
 // KlinkModel is the JSON representation of a K-Link
 type KlinkModel struct {
-	ID          int64  `json:"-"`
-	Identifier  string `json:"id"`
-	ManagerID   int64  `json:"manager_id"`
-	Name        string `json:"name"`
-	Website     string `json:"website"`
-	Description string `json:"description"`
-	Active      bool   `json:"active"`
+	ID              int64  `json:"-"`
+	Identifier      string `json:"id"`
+	ManagerID       int64  `json:"manager_id"`
+	Name            string `json:"name"`
+	Website         string `json:"website"`
+	Description     string `json:"description"`
+	Active          bool   `json:"active"`
+	HealthURL       string `json:"health_url"`
+	HealthStatus    string `json:"health_status"`
+	HealthCheckedAt int64  `json:"health_checked_at"`
+	PeerID          int64  `json:"peer_id"`
+	RemoteID        int64  `json:"-"`
 }
 
 // handleListKlink provides an endpoint that returns a list of all
@@ -35,14 +38,20 @@ func (s *Server) handleListKlinks() http.HandlerFunc {
 			return
 		}
 
-		// user := s.sessions.GetUser(req)
+		user := s.sessions.GetUser(req)
+
+		memberOf, err := s.klinksWith(user, CapKlinkView)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
 
 		for _, klink := range klinks {
-			// // remove all klinks not owned by the registrant,
-			// // if the registrant is an USER (not ADMIN or OWNER)
-			// if user.Role == RoleUser && klink.ManagerID != user.ID {
-			// 	continue
-			// }
+			// remove all klinks the registrant is not a member of, unless
+			// the registrant may view every klink or browse active ones
+			if !s.can(user, CapKlinkView) && !memberOf[klink.ID] && !s.canBrowse(user, klink) {
+				continue
+			}
 
 			responses = append(responses, KlinkModel(*klink))
 		}
@@ -62,16 +71,16 @@ func (s *Server) handleGetKlink() http.HandlerFunc {
 			jsonResponse(w, API2ErrNotFound)
 			return
 		} else if err != nil {
-			fmt.Println(err)
+			s.requestLogger(req).WithError(err).Error("Error loading K-Link")
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
 
 		user := s.sessions.GetUser(req)
-		// do not show unowned applications if the registrant is an USER
-		// (not ADMIN or OWNER)
-		if user.Role == RoleUser && application.ManagerID != user.ID {
-			jsonResponse(w, API2ErrUnauthorized)
+		// do not show klinks the registrant is not a member of, unless the
+		// registrant may view every klink or browse active ones
+		if !s.canInKlink(user, application, CapKlinkView) && !s.canBrowse(user, application) {
+			jsonResponse(w, API2ErrForbidden)
 			return
 		}
 
@@ -100,11 +109,18 @@ func (s *Server) handleCreateKlink() http.HandlerFunc {
 
 		app.ID = 0 // ID will be autogenerated by the database
 		app.Identifier = generateToken()
+		app.HealthStatus = "" // the health is only set by the prober
+		app.HealthCheckedAt = 0
+		app.PeerID = 0 // only the synchronisation imports klinks
+		app.RemoteID = 0
 
-		// If user is in the user role, it is not possible to change application
-		// ownership
-		if u.Role != RoleAdmin {
-			jsonResponse(w, API2ErrUserNotAdmin)
+		if !validHTTPURL(app.HealthURL) {
+			jsonResponse(w, API2ErrInvalidHealthURL)
+			return
+		}
+
+		if !s.can(u, CapKlinkCreate) {
+			jsonResponse(w, API2ErrForbidden)
 			return
 		}
 		app.ManagerID = u.ID
@@ -113,6 +129,14 @@ func (s *Server) handleCreateKlink() http.HandlerFunc {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitKlink(EventKlinkCreated, &app)
+
+		// the creator becomes the first manager of the klink
+		member := &KlinkMember{KlinkID: app.ID, RegistrantID: u.ID, Role: KlinkRoleManager}
+		if err := s.store.SaveKlinkMember(member); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
 
 		response = KlinkModel(app)
 
@@ -140,14 +164,15 @@ func (s *Server) handleUpdateKlink() http.HandlerFunc {
 
 		user := s.sessions.GetUser(req)
 
-		// check if we have permission to edit this application
-		if user.ID == app.ManagerID {
-			// we must either be the owner of this application ..
-		} else if user.Role == RoleOwner || user.Role == RoleAdmin {
-			// .. or have a role of admin or owner.
-		} else {
-			// otherwise we can strop processing here
-			jsonResponse(w, API2ErrInvalidCredentials)
+		// check if we have permission to edit this klink, either as a
+		// member or because we may edit every klink
+		if !s.canInKlink(user, app, CapKlinkUpdate) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if app.PeerID != 0 {
+			jsonResponse(w, API2ErrFederated)
 			return
 		}
 
@@ -163,17 +188,30 @@ func (s *Server) handleUpdateKlink() http.HandlerFunc {
 		app.Website = request.Website
 		app.Description = request.Description
 
-		log.Println("Updating Klink", app)
+		if !validHTTPURL(request.HealthURL) {
+			jsonResponse(w, API2ErrInvalidHealthURL)
+			return
+		}
 
-		// allow change of owner, if user is admin or owner
-		// if user.Role == RoleOwner || user.Role == RoleAdmin {
-		// 	app.OwnerID = request.OwnerID
-		// }
+		// the health of the previous URL says nothing about the new one
+		if request.HealthURL != app.HealthURL {
+			app.HealthURL = request.HealthURL
+			app.HealthStatus = ""
+			app.HealthCheckedAt = 0
+			if err := s.store.SetKlinkHealth(app.ID, "", 0); err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+		}
+
+		s.requestLogger(req).WithField("klink", app.Identifier).Debug("Updating K-Link")
 
 		if err := s.store.UpdateKlink(app); err != nil {
+			s.requestLogger(req).WithError(err).Error("Error updating K-Link")
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitKlink(EventKlinkUpdated, app)
 
 		response = KlinkModel(*app)
 		jsonResponse(w, response)
@@ -199,12 +237,13 @@ func (s *Server) handleDeleteKlink() http.HandlerFunc {
 
 		user := s.sessions.GetUser(req)
 
-		if user.ID == app.ManagerID {
-			// registrants can remove their own klinks
-		} else if user.Role == RoleOwner || user.Role == RoleAdmin {
-			// an admin or owner role may remove everything
-		} else {
-			jsonResponse(w, API2ErrUnauthorized)
+		if !s.canInKlink(user, app, CapKlinkDelete) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if app.PeerID != 0 {
+			jsonResponse(w, API2ErrFederated)
 			return
 		}
 
@@ -212,6 +251,7 @@ func (s *Server) handleDeleteKlink() http.HandlerFunc {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitKlink(EventKlinkDeleted, app)
 
 		jsonResponse(w, API2EmptyResponse{})
 		return
@@ -0,0 +1,217 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// KlinkMemberModel is the JSON representation of a K-Link membership
+type KlinkMemberModel struct {
+	RegistrantID int64  `json:"registrant_id"`
+	Email        string `json:"email"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+}
+
+// countKlinkManagers returns the number of managers among the members
+func countKlinkManagers(members []*KlinkMember) int {
+	count := 0
+	for _, member := range members {
+		if member.Role == KlinkRoleManager {
+			count++
+		}
+	}
+	return count
+}
+
+// handleListKlinkMembers provides an endpoint that returns all members of a
+// klink
+func (s *Server) handleListKlinkMembers() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []KlinkMemberModel
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if !s.canInKlink(s.sessions.GetUser(req), klink, CapKlinkView) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		members, err := s.store.ListKlinkMembers(klink.ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, member := range members {
+			registrant, err := s.store.GetRegistrantByID(member.RegistrantID)
+			if err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+
+			responses = append(responses, KlinkMemberModel{
+				RegistrantID: registrant.ID,
+				Email:        registrant.Email,
+				Name:         registrant.Name,
+				Role:         member.Role,
+			})
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleSaveKlinkMember provides an endpoint that adds a registrant to a
+// klink, or changes the role of a member. The registrant can be identified
+// by ID or email address.
+func (s *Server) handleSaveKlinkMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request KlinkMemberModel
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if !s.canInKlink(s.sessions.GetUser(req), klink, CapKlinkMemberManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if !s.policy.IsKlinkRole(request.Role) {
+			jsonResponse(w, API2ErrInvalidKlinkRole)
+			return
+		}
+
+		var registrant *Registrant
+		if request.RegistrantID != 0 {
+			registrant, err = s.store.GetRegistrantByID(request.RegistrantID)
+		} else {
+			registrant, err = s.store.GetRegistrantByEmail(request.Email)
+		}
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		// demoting the last manager would leave the klink without anyone
+		// able to administer it
+		if request.Role != KlinkRoleManager {
+			members, err := s.store.ListKlinkMembers(klink.ID)
+			if err != nil && !s.store.IsNotFound(err) {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+
+			current, err := s.store.GetKlinkMember(klink.ID, registrant.ID)
+			if err == nil && current.Role == KlinkRoleManager && countKlinkManagers(members) <= 1 {
+				jsonResponse(w, API2ErrLastKlinkManager)
+				return
+			}
+		}
+
+		member := &KlinkMember{
+			KlinkID:      klink.ID,
+			RegistrantID: registrant.ID,
+			Role:         request.Role,
+		}
+		if err := s.store.SaveKlinkMember(member); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, KlinkMemberModel{
+			RegistrantID: registrant.ID,
+			Email:        registrant.Email,
+			Name:         registrant.Name,
+			Role:         member.Role,
+		})
+	}
+}
+
+// handleDeleteKlinkMember provides an endpoint that removes a registrant
+// from a klink. Members may always leave a klink on their own.
+func (s *Server) handleDeleteKlinkMember() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		registrantID, err := strconv.ParseInt(chi.URLParam(req, "registrant"), 10, 64)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidURL)
+			return
+		}
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		user := s.sessions.GetUser(req)
+
+		if user.ID == registrantID {
+			// members can leave a klink
+		} else if s.canInKlink(user, klink, CapKlinkMemberManage) {
+			// managers can remove everyone
+		} else {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		member, err := s.store.GetKlinkMember(klink.ID, registrantID)
+		if s.store.IsNotFound(err) {
+			// deletion should succeed if entry does not exist
+			jsonResponse(w, API2EmptyResponse{})
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if member.Role == KlinkRoleManager {
+			members, err := s.store.ListKlinkMembers(klink.ID)
+			if err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+			if countKlinkManagers(members) <= 1 {
+				jsonResponse(w, API2ErrLastKlinkManager)
+				return
+			}
+		}
+
+		if err := s.store.DeleteKlinkMember(klink.ID, registrantID); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, API2EmptyResponse{})
+	}
+}
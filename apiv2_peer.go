@@ -0,0 +1,213 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi"
+)
+
+// PeerModel is the JSON representation of a Peer. The secret is only
+// returned when the peer is created.
+type PeerModel struct {
+	ID         int64  `json:"id"`
+	Name       string `json:"name"`
+	URL        string `json:"url"`
+	Key        string `json:"key"`
+	Secret     string `json:"secret,omitempty"`
+	OwnerID    int64  `json:"owner_id"`
+	Active     bool   `json:"active"`
+	Cursor     int64  `json:"cursor"`
+	LastSyncAt int64  `json:"last_sync_at"`
+	LastError  string `json:"last_error"`
+}
+
+func newPeerModel(peer *Peer) PeerModel {
+	model := PeerModel(*peer)
+	model.Secret = ""
+	return model
+}
+
+// peerFromURL returns the peer referenced by the `id` URL parameter, if the
+// user may manage peers. Otherwise an error is written and nil returned.
+func (s *Server) peerFromURL(w http.ResponseWriter, req *http.Request) *Peer {
+	if !s.can(s.sessions.GetUser(req), CapPeerManage) {
+		jsonResponse(w, API2ErrForbidden)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		jsonResponse(w, API2ErrInvalidURL)
+		return nil
+	}
+
+	peer, err := s.store.GetPeerByID(id)
+	if s.store.IsNotFound(err) {
+		jsonResponse(w, API2ErrNotFound)
+		return nil
+	} else if err != nil {
+		jsonResponse(w, API2ErrDatabase)
+		return nil
+	}
+
+	return peer
+}
+
+// handleListPeers provides an endpoint that returns all peer registries
+func (s *Server) handleListPeers() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		responses := []PeerModel{}
+
+		if !s.can(s.sessions.GetUser(req), CapPeerManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		peers, err := s.store.ListPeers()
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, peer := range peers {
+			responses = append(responses, newPeerModel(peer))
+		}
+		jsonResponse(w, responses)
+	}
+}
+
+// handleCreatePeer provides an endpoint that adds a peer registry. The key
+// and secret are generated, unless they were issued by the peer. The
+// response contains the secret, which has to be shared with the peer.
+func (s *Server) handleCreatePeer() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request PeerModel
+
+		user := s.sessions.GetUser(req)
+		if !s.can(user, CapPeerManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		peer := Peer{
+			Name:    request.Name,
+			URL:     request.URL,
+			Key:     request.Key,
+			Secret:  request.Secret,
+			OwnerID: user.ID,
+			Active:  request.Active,
+		}
+		if peer.Name == "" || !validHTTPURL(peer.URL) {
+			jsonResponse(w, API2ErrInvalidPeer)
+			return
+		}
+		if peer.Key == "" || peer.Secret == "" {
+			peer.Key = generateToken()
+			peer.Secret = generateToken()
+		}
+
+		if _, err := s.store.GetPeerByKey(peer.Key); err == nil {
+			jsonResponse(w, API2ErrPeerExists)
+			return
+		} else if !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if err := s.store.CreatePeer(&peer); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, PeerModel(peer))
+	}
+}
+
+// handleUpdatePeer provides an endpoint that updates the name, URL and
+// status of a peer registry. A new URL starts the synchronisation from the
+// beginning.
+func (s *Server) handleUpdatePeer() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request PeerModel
+
+		peer := s.peerFromURL(w, req)
+		if peer == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if request.Name == "" || !validHTTPURL(request.URL) {
+			jsonResponse(w, API2ErrInvalidPeer)
+			return
+		}
+
+		if request.URL != peer.URL {
+			peer.Cursor = 0
+		}
+		peer.Name = request.Name
+		peer.URL = request.URL
+		peer.Active = request.Active
+
+		if err := s.store.UpdatePeer(peer); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, newPeerModel(peer))
+	}
+}
+
+// handleDeletePeer provides an endpoint that removes a peer registry,
+// together with the K-Links and applications imported from it
+func (s *Server) handleDeletePeer() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		peer := s.peerFromURL(w, req)
+		if peer == nil {
+			return
+		}
+
+		if err := s.store.DeletePeer(peer.ID); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, API2EmptyResponse{})
+	}
+}
+
+// handleSyncPeer provides an endpoint that pulls the changes of a peer
+// registry right away, instead of waiting for the background
+// synchronisation
+func (s *Server) handleSyncPeer() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		peer := s.peerFromURL(w, req)
+		if peer == nil {
+			return
+		}
+
+		if !peer.Active || peer.URL == "" {
+			jsonResponse(w, API2ErrInvalidPeer)
+			return
+		}
+
+		if err := s.syncPeer(peer); err != nil {
+			apiErr := API2ErrSyncFailed
+			apiErr.Context = err.Error()
+			jsonResponse(w, apiErr)
+			return
+		}
+
+		jsonResponse(w, newPeerModel(peer))
+	}
+}
@@ -0,0 +1,184 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-chi/chi"
+)
+
+// PermissionModel is the JSON representation of a Permission
+type PermissionModel struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Implies     []string `json:"implies"`
+	Deprecated  bool     `json:"deprecated"`
+}
+
+// handleListPermissions provides an endpoint that returns a list of all
+// permissions inside the database
+func (s *Server) handleListPermissions() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []PermissionModel
+
+		if !s.can(s.sessions.GetUser(req), CapPermissionView) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		permissions, err := s.store.ListPermissions()
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, permission := range permissions {
+			responses = append(responses, PermissionModel(*permission))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleCreatePermission provides an endpoint that adds a new permission to
+// the catalogue
+func (s *Server) handleCreatePermission() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request PermissionModel
+
+		if !s.can(s.sessions.GetUser(req), CapPermissionCreate) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if !IsValidPermissionName(request.Name) {
+			jsonResponse(w, API2ErrInvalidPermissionName)
+			return
+		}
+
+		if ok, err := CheckImplies(s.store, request.Name, request.Implies); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		} else if !ok {
+			jsonResponse(w, API2ErrInvalidImplies)
+			return
+		}
+
+		_, err := s.store.GetPermission(request.Name)
+		if err == nil {
+			jsonResponse(w, API2ErrPermissionExists)
+			return
+		} else if !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		permission := Permission(request)
+		if err := s.store.CreatePermission(&permission); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, PermissionModel(permission))
+	}
+}
+
+// handleUpdatePermission provides an endpoint that changes the description
+// and the implied permissions of a permission, or deprecates it. Permissions
+// cannot be renamed.
+func (s *Server) handleUpdatePermission() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request PermissionModel
+
+		if !s.can(s.sessions.GetUser(req), CapPermissionUpdate) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		permission, err := s.store.GetPermission(chi.URLParam(req, "name"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if ok, err := CheckImplies(s.store, permission.Name, request.Implies); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		} else if !ok {
+			jsonResponse(w, API2ErrInvalidImplies)
+			return
+		}
+
+		permission.Description = request.Description
+		permission.Implies = request.Implies
+		permission.Deprecated = request.Deprecated
+		if err := s.store.UpdatePermission(permission); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, PermissionModel(*permission))
+	}
+}
+
+// handleDeletePermission provides an endpoint that removes a permission from
+// the catalogue. Built-in permissions and permissions that are still granted
+// to applications cannot be deleted, they can be deprecated instead.
+func (s *Server) handleDeletePermission() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		name := chi.URLParam(req, "name")
+
+		if !s.can(s.sessions.GetUser(req), CapPermissionDelete) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if IsBuiltInPermission(name) {
+			jsonResponse(w, API2ErrPermissionBuiltIn)
+			return
+		}
+
+		_, err := s.store.GetPermission(name)
+		if s.store.IsNotFound(err) {
+			// deletion should succeed if entry does not exist
+			jsonResponse(w, API2EmptyResponse{})
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		grants, err := s.store.CountPermissionGrants(name)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		if grants > 0 {
+			jsonResponse(w, API2ErrPermissionGranted)
+			return
+		}
+
+		if err := s.store.DeletePermission(name); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, API2EmptyResponse{})
+	}
+}
@@ -2,7 +2,6 @@ package klinkregistry
 
 import (
 	"encoding/json"
-	"log"
 	"net/http"
 	"strconv"
 
@@ -43,7 +42,7 @@ func (s *Server) handleListRegistrants() http.HandlerFunc {
 			jsonResponse(w, responses)
 			return
 		} else if err != nil {
-			log.Println(err.Error())
+			s.requestLogger(req).WithError(err).Error("Error listing registrants")
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
@@ -51,9 +50,8 @@ func (s *Server) handleListRegistrants() http.HandlerFunc {
 		user := s.sessions.GetUser(req)
 
 		for _, registrant := range registrants {
-			// do not list registrants  if the registrant is an USER
-			// (not ADMIN or OWNER)
-			if user.Role == RoleUser && registrant.ID != user.ID {
+			// registrants without the view capability only see themselves
+			if !s.can(user, CapRegistrantView) && registrant.ID != user.ID {
 				continue
 			}
 
@@ -76,8 +74,15 @@ func (s *Server) handleCreateRegistrant() http.HandlerFunc {
 
 		user := s.sessions.GetUser(req)
 
-		if user.Role != RoleAdmin && user.Role != RoleOwner {
-			jsonResponse(w, API2ErrUnauthorized)
+		if !s.can(user, CapRegistrantCreate) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		// registrants can not be created with more privileges than the
+		// creator holds
+		if !s.policy.IsRole(request.Role) || !s.policy.Covers(user.Role, request.Role) {
+			jsonResponse(w, API2ErrInvalidRole)
 			return
 		}
 
@@ -118,10 +123,9 @@ func (s *Server) handleGetRegistrant() http.HandlerFunc {
 		}
 
 		user := s.sessions.GetUser(req)
-		// do not show unowned applications if the registrant is an USER
-		// (not ADMIN or OWNER)
-		if user.Role == RoleUser && registrant.ID != user.ID {
-			jsonResponse(w, API2ErrUnauthorized)
+		// registrants without the view capability only see themselves
+		if !s.can(user, CapRegistrantView) && registrant.ID != user.ID {
+			jsonResponse(w, API2ErrForbidden)
 			return
 		}
 
@@ -160,11 +164,11 @@ func (s *Server) handleUpdateRegistrant() http.HandlerFunc {
 		// check if we have permission to edit this registrants
 		if user.ID == registrant.ID {
 			// we must either be the registrant itself ..
-		} else if user.Role == RoleOwner || user.Role == RoleAdmin {
-			// .. or have a role of admin or owner.
+		} else if s.can(user, CapRegistrantUpdate) && s.policy.Covers(user.Role, registrant.Role) {
+			// .. or be allowed to edit registrants of this role.
 		} else {
 			// otherwise we can strop processing here
-			jsonResponse(w, API2ErrInvalidCredentials)
+			jsonResponse(w, API2ErrForbidden)
 			return
 		}
 
@@ -175,11 +179,20 @@ func (s *Server) handleUpdateRegistrant() http.HandlerFunc {
 
 		// use the registrant as a base to apply our request to:
 		// registrant.ID must stay the same.
+		wasActive := registrant.Active
 		registrant.Name = request.Name
 		registrant.Email = request.Email
 
-		// allow change of some attributes, if user is admin or owner
-		if user.Role == RoleOwner || user.Role == RoleAdmin {
+		// allow change of some attributes, if user may update registrants.
+		// The assigned role may not exceed the privileges of the user.
+		if s.can(user, CapRegistrantUpdate) {
+			if request.Role != registrant.Role {
+				if !s.policy.IsRole(request.Role) || !s.policy.Covers(user.Role, request.Role) {
+					jsonResponse(w, API2ErrInvalidRole)
+					return
+				}
+			}
+
 			registrant.Active = request.Active
 			registrant.Email = request.Email
 			registrant.Role = request.Role
@@ -189,6 +202,9 @@ func (s *Server) handleUpdateRegistrant() http.HandlerFunc {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		if wasActive && !registrant.Active {
+			s.emitRegistrant(EventRegistrantDeactivated, registrant)
+		}
 
 		response = RegistrantModel(*registrant)
 		jsonResponse(w, response)
@@ -219,12 +235,10 @@ func (s *Server) handleDeleteRegistrant() http.HandlerFunc {
 
 		user := s.sessions.GetUser(req)
 
-		if registrant.Role == RoleUser || user.Role != RoleUser {
-			// allow admins to remove simple users
-		} else if user.Role == "ROLE_OWNER" {
-			// an owner role may remove everything
-		} else {
-			jsonResponse(w, API2ErrUnauthorized)
+		// registrants may only be removed by users that hold at least the
+		// same privileges
+		if !s.can(user, CapRegistrantDelete) || !s.policy.Covers(user.Role, registrant.Role) {
+			jsonResponse(w, API2ErrForbidden)
 			return
 		}
 
@@ -232,6 +246,7 @@ func (s *Server) handleDeleteRegistrant() http.HandlerFunc {
 			jsonResponse(w, API2ErrDatabase)
 			return
 		}
+		s.emitRegistrant(EventRegistrantDeleted, registrant)
 
 		jsonResponse(w, API2EmptyResponse{})
 		return
@@ -0,0 +1,273 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// RenewalRequestModel is the JSON representation of a RenewalRequest
+type RenewalRequestModel struct {
+	ID            int64  `json:"id"`
+	ApplicationID int64  `json:"application_id"`
+	ValidUntil    int64  `json:"valid_until"`
+	Justification string `json:"justification"`
+	Status        string `json:"status"`
+	Reason        string `json:"reason"`
+	RequestedBy   int64  `json:"requested_by"`
+	DecidedBy     int64  `json:"decided_by"`
+	CreatedAt     int64  `json:"created_at"`
+	DecidedAt     int64  `json:"decided_at"`
+}
+
+// ValidityModel contains the validity period of an application
+type ValidityModel struct {
+	ValidFrom  int64 `json:"valid_from"`
+	ValidUntil int64 `json:"valid_until"`
+}
+
+// handleCreateRenewalRequest provides an endpoint that allows the owner of an
+// application to request an extension of its validity period. Registrants
+// that may approve renewals are notified by email.
+func (s *Server) handleCreateRenewalRequest() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request RenewalRequestModel
+
+		app := s.applicationFromURL(w, req, CapApplicationUpdate)
+		if app == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		// 0 requests an unbounded validity, otherwise the new end has to be
+		// in the future and after the current one
+		if request.ValidUntil != 0 && (request.ValidUntil <= time.Now().Unix() ||
+			(app.ValidUntil != 0 && request.ValidUntil <= app.ValidUntil)) {
+			jsonResponse(w, API2ErrInvalidValidity)
+			return
+		}
+
+		existing, err := s.store.ListRenewalRequestsByApplication(app.ID)
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		for _, r := range existing {
+			if r.Status == RequestPending {
+				jsonResponse(w, API2ErrRequestPending)
+				return
+			}
+		}
+
+		renewal := &RenewalRequest{
+			ApplicationID: app.ID,
+			ValidUntil:    request.ValidUntil,
+			Justification: request.Justification,
+			Status:        RequestPending,
+			RequestedBy:   s.sessions.GetUser(req).ID,
+			CreatedAt:     time.Now().UTC().Unix(),
+		}
+		if err := s.store.CreateRenewalRequest(renewal); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		s.notifyCapable(CapApplicationRenew,
+			"Renewal of "+app.Name+" requested",
+			fmt.Sprintf("The owner of the application %q (%s) requests a renewal.\n\n%s\n\nPlease approve or reject the request: %s",
+				app.Name, app.URL, renewal.Justification,
+				s.link("applications/%d", app.ID)),
+		)
+
+		jsonResponse(w, RenewalRequestModel(*renewal))
+	}
+}
+
+// handleListApplicationRenewalRequests provides an endpoint that returns the
+// renewal requests of an application
+func (s *Server) handleListApplicationRenewalRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []RenewalRequestModel
+
+		app := s.applicationFromURL(w, req, CapApplicationView)
+		if app == nil {
+			return
+		}
+
+		renewals, err := s.store.ListRenewalRequestsByApplication(app.ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, r := range renewals {
+			responses = append(responses, RenewalRequestModel(*r))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleListRenewalRequests provides an endpoint that returns the renewal
+// requests of all applications. The list can be filtered by the `status`
+// query parameter.
+func (s *Server) handleListRenewalRequests() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []RenewalRequestModel
+
+		if !s.can(s.sessions.GetUser(req), CapApplicationRenew) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		renewals, err := s.store.ListRenewalRequests()
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		status := req.URL.Query().Get("status")
+		for _, r := range renewals {
+			if status != "" && r.Status != status {
+				continue
+			}
+			responses = append(responses, RenewalRequestModel(*r))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleDecideRenewalRequest provides an endpoint that allows administrators
+// to approve or reject a renewal request. On approval, the validity of the
+// application is extended. The owner of the application is notified by
+// email.
+func (s *Server) handleDecideRenewalRequest(approve bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request DecisionRequest
+
+		user := s.sessions.GetUser(req)
+		if !s.can(user, CapApplicationRenew) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		appID, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidURL)
+			return
+		}
+		id, err := strconv.ParseInt(chi.URLParam(req, "renewal"), 10, 64)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidURL)
+			return
+		}
+
+		renewal, err := s.store.GetRenewalRequestByID(id)
+		if s.store.IsNotFound(err) || (err == nil && renewal.ApplicationID != appID) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if renewal.Status != RequestPending {
+			jsonResponse(w, API2ErrRequestDecided)
+			return
+		}
+
+		// the reason is optional, so an empty body is accepted
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil && err != io.EOF {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		app, err := s.store.GetApplicationByID(renewal.ApplicationID)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		renewal.Status = RequestRejected
+		if approve {
+			renewal.Status = RequestApproved
+
+			app.ValidUntil = renewal.ValidUntil
+			if err := s.store.ReplaceApplication(app); err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+			s.emitApplication(EventApplicationUpdated, app)
+		}
+
+		renewal.Reason = request.Reason
+		renewal.DecidedBy = user.ID
+		renewal.DecidedAt = time.Now().UTC().Unix()
+		if err := s.store.UpdateRenewalRequest(renewal); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		text := fmt.Sprintf("The renewal of your application %q has been %s.", app.Name, renewal.Status)
+		if renewal.Reason != "" {
+			text += "\n\nReason: " + renewal.Reason
+		}
+		s.notifyRegistrant(app.OwnerID, "Renewal of "+app.Name+" "+renewal.Status, text)
+
+		jsonResponse(w, RenewalRequestModel(*renewal))
+	}
+}
+
+// handleSetApplicationValidity provides an endpoint that allows
+// administrators to set the validity period of an application directly
+func (s *Server) handleSetApplicationValidity() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request ValidityModel
+
+		if !s.can(s.sessions.GetUser(req), CapApplicationRenew) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		app := s.applicationFromURL(w, req, CapApplicationRenew)
+		if app == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if request.ValidFrom != 0 && request.ValidUntil != 0 && request.ValidUntil <= request.ValidFrom {
+			jsonResponse(w, API2ErrInvalidValidity)
+			return
+		}
+
+		app.ValidFrom = request.ValidFrom
+		app.ValidUntil = request.ValidUntil
+		if err := s.store.ReplaceApplication(app); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		s.emitApplication(EventApplicationUpdated, app)
+
+		jsonResponse(w, ValidityModel{ValidFrom: app.ValidFrom, ValidUntil: app.ValidUntil})
+	}
+}
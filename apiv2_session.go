@@ -47,6 +47,7 @@ func (s *Server) handleGetSession() http.HandlerFunc {
 		response.Token = token
 		response.UserID = u.ID
 		response.Role = u.Role
+		response.Capabilities = s.policy.Capabilities(u.Role)
 
 		jsonResponse(w, response)
 		return
@@ -82,8 +83,7 @@ func (s *Server) handleCreateSession() http.HandlerFunc {
 		}
 
 		// save LastLogin timestamp
-		registrant.LastLogin = time.Now().UTC().Unix()
-		err = s.store.ReplaceRegistrant(registrant)
+		err = s.store.SetRegistrantLastLogin(registrant.ID, time.Now().UTC().Unix())
 		if err != nil {
 			jsonResponse(w, err.Error())
 		}
@@ -106,6 +106,7 @@ func (s *Server) handleCreateSession() http.HandlerFunc {
 		response.Token = token
 		response.UserID = sessionUser.ID
 		response.Role = sessionUser.Role
+		response.Capabilities = s.policy.Capabilities(sessionUser.Role)
 		jsonResponse(w, response)
 		return
 	}
@@ -0,0 +1,210 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// OwnershipTransferModel is the JSON representation of an OwnershipTransfer.
+// The token is only sent to the proposed owner.
+type OwnershipTransferModel struct {
+	ID            int64  `json:"id"`
+	ApplicationID int64  `json:"application_id"`
+	FromID        int64  `json:"from_id"`
+	ToID          int64  `json:"to_id"`
+	Token         string `json:"-"`
+	Status        string `json:"status"`
+	RequestedBy   int64  `json:"requested_by"`
+	CreatedAt     int64  `json:"created_at"`
+	DecidedAt     int64  `json:"decided_at"`
+}
+
+// activeRegistrant returns the registrant with the ID, if it exists and is
+// active. Otherwise an error is sent to the client and nil is returned.
+func (s *Server) activeRegistrant(w http.ResponseWriter, id int64) *Registrant {
+	registrant, err := s.store.GetRegistrantByID(id)
+	if s.store.IsNotFound(err) || (err == nil && !registrant.Active) {
+		jsonResponse(w, API2ErrInvalidOwner)
+		return nil
+	} else if err != nil {
+		jsonResponse(w, API2ErrDatabase)
+		return nil
+	}
+
+	return registrant
+}
+
+// handleCreateOwnershipTransfer provides an endpoint that allows the owner of
+// an application, or registrants that may set owners, to propose a new owner
+// by email. The proposed owner receives a link to accept the transfer.
+func (s *Server) handleCreateOwnershipTransfer() http.HandlerFunc {
+	type Request struct {
+		Email string `json:"email"`
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request Request
+
+		app := s.applicationFromURL(w, req, CapApplicationSetOwner)
+		if app == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		recipient, err := s.store.GetRegistrantByEmail(request.Email)
+		if s.store.IsNotFound(err) || (err == nil && (!recipient.Active || recipient.ID == app.OwnerID)) {
+			jsonResponse(w, API2ErrInvalidOwner)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		// pending transfers have to expire before a new one can be proposed
+		existing, err := s.store.ListOwnershipTransfersByApplication(app.ID)
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		now := time.Now().UTC()
+		for _, t := range existing {
+			if t.Status == RequestPending && !t.IsExpired(now) {
+				jsonResponse(w, API2ErrRequestPending)
+				return
+			}
+		}
+
+		transfer := &OwnershipTransfer{
+			ApplicationID: app.ID,
+			FromID:        app.OwnerID,
+			ToID:          recipient.ID,
+			Token:         generateToken(),
+			Status:        RequestPending,
+			RequestedBy:   s.sessions.GetUser(req).ID,
+			CreatedAt:     now.Unix(),
+		}
+		if err := s.store.CreateOwnershipTransfer(transfer); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		s.notify(recipient.Email, "Transfer of "+app.Name,
+			fmt.Sprintf("You have been proposed as the new owner of the application %q (%s).\n\nTo accept the transfer within %d days, please open: %s",
+				app.Name, app.URL, int(OwnershipTransferValidity.Hours()/24),
+				s.link("transfers/%s", transfer.Token)),
+		)
+
+		jsonResponse(w, OwnershipTransferModel(*transfer))
+	}
+}
+
+// handleListOwnershipTransfers provides an endpoint that returns the
+// ownership transfers of an application
+func (s *Server) handleListOwnershipTransfers() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var responses []OwnershipTransferModel
+
+		app := s.applicationFromURL(w, req, CapApplicationView)
+		if app == nil {
+			return
+		}
+
+		transfers, err := s.store.ListOwnershipTransfersByApplication(app.ID)
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, responses)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, t := range transfers {
+			responses = append(responses, OwnershipTransferModel(*t))
+		}
+
+		jsonResponse(w, responses)
+	}
+}
+
+// handleDecideOwnershipTransfer provides an endpoint that allows the proposed
+// owner to accept or reject a transfer with the emailed token. Both the
+// previous and the new owner are notified by email.
+func (s *Server) handleDecideOwnershipTransfer(accept bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		user := s.sessions.GetUser(req)
+
+		transfer, err := s.store.GetOwnershipTransferByToken(chi.URLParam(req, "token"))
+		if s.store.IsNotFound(err) || (err == nil && transfer.ToID != user.ID) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if transfer.Status != RequestPending {
+			jsonResponse(w, API2ErrRequestDecided)
+			return
+		}
+
+		now := time.Now().UTC()
+		if transfer.IsExpired(now) {
+			jsonResponse(w, API2ErrTransferExpired)
+			return
+		}
+
+		app, err := s.store.GetApplicationByID(transfer.ApplicationID)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		// the owner may have changed since the transfer was proposed
+		if app.OwnerID != transfer.FromID {
+			jsonResponse(w, API2ErrRequestDecided)
+			return
+		}
+
+		if accept && s.activeRegistrant(w, transfer.ToID) == nil {
+			return
+		}
+
+		transfer.Status = RequestRejected
+		if accept {
+			transfer.Status = RequestApproved
+
+			app.OwnerID = transfer.ToID
+			if err := s.store.ReplaceApplication(app); err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+			s.emitApplication(EventApplicationUpdated, app)
+		}
+
+		transfer.DecidedAt = now.Unix()
+		if err := s.store.UpdateOwnershipTransfer(transfer); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		outcome := AuditGranted
+		if !accept {
+			outcome = AuditDenied
+		}
+		s.auditTransfer(user.ID, app, transfer.FromID, transfer.ToID, outcome, transfer.Status)
+
+		text := fmt.Sprintf("The transfer of the application %q to a new owner has been %s.", app.Name, transfer.Status)
+		s.notifyRegistrant(transfer.FromID, "Transfer of "+app.Name+" "+transfer.Status, text)
+		s.notifyRegistrant(transfer.ToID, "Transfer of "+app.Name+" "+transfer.Status, text)
+
+		jsonResponse(w, OwnershipTransferModel(*transfer))
+	}
+}
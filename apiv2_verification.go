@@ -0,0 +1,67 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+)
+
+// handleVerifyApplication provides an endpoint that verifies the domains of
+// an application. The owner publishes the challenge token of the application
+// on the domain of the URL and of every additional origin, either in the
+// challenge file (method `http`, the default) or in a TXT record (method
+// `dns`) before calling it.
+func (s *Server) handleVerifyApplication() http.HandlerFunc {
+	type Request struct {
+		Method string `json:"method"`
+	}
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request Request
+
+		app := s.applicationFromURL(w, req, CapApplicationUpdate)
+		if app == nil {
+			return
+		}
+
+		// the method is optional, so an empty body is accepted
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil && err != io.EOF {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+		if request.Method == "" {
+			request.Method = VerifyHTTP
+		}
+
+		if app.ChallengeToken == "" {
+			app.ChallengeToken = generateToken()
+		}
+
+		if origin, err := s.verifyOrigins(req.Context(), app, request.Method); err != nil {
+			// the error may describe the network of the registry
+			s.requestLogger(req).WithError(err).WithField("application", app.ID).
+				WithField("origin", origin).Info("Verification failed")
+
+			// the token may have been generated above
+			if err := s.store.ReplaceApplication(app); err != nil {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+
+			apiErr := API2ErrVerificationFailed
+			apiErr.Context = "The challenge token was not found for " + origin
+			jsonResponse(w, apiErr)
+			return
+		}
+
+		app.VerifiedAt = time.Now().UTC().Unix()
+		if err := s.store.ReplaceApplication(app); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+		s.emitApplication(EventApplicationUpdated, app)
+
+		jsonResponse(w, ApplicationModel(*app))
+	}
+}
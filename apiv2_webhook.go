@@ -0,0 +1,270 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// webhookDeliveryLogLength is the number of deliveries returned by the
+// delivery log of a webhook
+const webhookDeliveryLogLength = 100
+
+// WebhookModel is the JSON representation of a Webhook. The secret is only
+// returned when the webhook is created.
+type WebhookModel struct {
+	ID        int64    `json:"id"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events"`
+	Active    bool     `json:"active"`
+	CreatedBy int64    `json:"created_by"`
+	CreatedAt int64    `json:"created_at"`
+}
+
+func newWebhookModel(webhook *Webhook) WebhookModel {
+	model := WebhookModel(*webhook)
+	model.Secret = ""
+	return model
+}
+
+// WebhookDeliveryModel is the JSON representation of a WebhookDelivery
+type WebhookDeliveryModel struct {
+	ID            int64  `json:"id"`
+	WebhookID     int64  `json:"webhook_id"`
+	EventID       string `json:"event_id"`
+	EventType     string `json:"event_type"`
+	Payload       string `json:"payload"`
+	Status        string `json:"status"`
+	Attempts      int    `json:"attempts"`
+	StatusCode    int    `json:"status_code"`
+	Error         string `json:"error"`
+	CreatedAt     int64  `json:"created_at"`
+	NextAttemptAt int64  `json:"next_attempt_at"`
+	DeliveredAt   int64  `json:"delivered_at"`
+}
+
+// validWebhookEvents checks that all events are known event types
+func validWebhookEvents(events []string) bool {
+	for _, event := range events {
+		if !stringInSlice(event, EventTypes) {
+			return false
+		}
+	}
+	return true
+}
+
+// webhookFromURL returns the webhook referenced by the `id` URL parameter, if
+// the user may manage webhooks. Otherwise an error is written and nil
+// returned.
+func (s *Server) webhookFromURL(w http.ResponseWriter, req *http.Request) *Webhook {
+	if !s.can(s.sessions.GetUser(req), CapWebhookManage) {
+		jsonResponse(w, API2ErrForbidden)
+		return nil
+	}
+
+	id, err := strconv.ParseInt(chi.URLParam(req, "id"), 10, 64)
+	if err != nil {
+		jsonResponse(w, API2ErrInvalidURL)
+		return nil
+	}
+
+	webhook, err := s.store.GetWebhookByID(id)
+	if s.store.IsNotFound(err) {
+		jsonResponse(w, API2ErrNotFound)
+		return nil
+	} else if err != nil {
+		jsonResponse(w, API2ErrDatabase)
+		return nil
+	}
+
+	return webhook
+}
+
+// handleListWebhooks provides an endpoint that returns all webhooks
+func (s *Server) handleListWebhooks() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		responses := []WebhookModel{}
+
+		if !s.can(s.sessions.GetUser(req), CapWebhookManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		webhooks, err := s.store.ListWebhooks()
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, webhook := range webhooks {
+			responses = append(responses, newWebhookModel(webhook))
+		}
+		jsonResponse(w, responses)
+	}
+}
+
+// handleCreateWebhook provides an endpoint that subscribes a URL to registry
+// events. The secret is generated, unless one is given, and only returned in
+// the response.
+func (s *Server) handleCreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request WebhookModel
+
+		user := s.sessions.GetUser(req)
+		if !s.can(user, CapWebhookManage) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		webhook := Webhook{
+			URL:       request.URL,
+			Secret:    request.Secret,
+			Events:    request.Events,
+			Active:    request.Active,
+			CreatedBy: user.ID,
+			CreatedAt: time.Now().UTC().Unix(),
+		}
+		if webhook.URL == "" || !validHTTPURL(webhook.URL) || !validWebhookEvents(webhook.Events) {
+			jsonResponse(w, API2ErrInvalidWebhook)
+			return
+		}
+		if webhook.Secret == "" {
+			webhook.Secret = generateToken()
+		}
+
+		if err := s.store.CreateWebhook(&webhook); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, WebhookModel(webhook))
+	}
+}
+
+// handleUpdateWebhook provides an endpoint that updates the URL, events and
+// status of a webhook. The secret is only replaced if a new one is given.
+func (s *Server) handleUpdateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		var request WebhookModel
+
+		webhook := s.webhookFromURL(w, req)
+		if webhook == nil {
+			return
+		}
+
+		if err := json.NewDecoder(req.Body).Decode(&request); err != nil {
+			jsonResponse(w, API2ErrInvalidJSON)
+			return
+		}
+
+		if request.URL == "" || !validHTTPURL(request.URL) || !validWebhookEvents(request.Events) {
+			jsonResponse(w, API2ErrInvalidWebhook)
+			return
+		}
+
+		webhook.URL = request.URL
+		webhook.Events = request.Events
+		webhook.Active = request.Active
+		if request.Secret != "" {
+			webhook.Secret = request.Secret
+		}
+
+		if err := s.store.UpdateWebhook(webhook); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, newWebhookModel(webhook))
+	}
+}
+
+// handleDeleteWebhook provides an endpoint that removes a webhook together
+// with its deliveries
+func (s *Server) handleDeleteWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		webhook := s.webhookFromURL(w, req)
+		if webhook == nil {
+			return
+		}
+
+		if err := s.store.DeleteWebhook(webhook.ID); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, API2EmptyResponse{})
+	}
+}
+
+// handleListWebhookDeliveries provides an endpoint that returns the latest
+// deliveries of a webhook, newest first
+func (s *Server) handleListWebhookDeliveries() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		responses := []WebhookDeliveryModel{}
+
+		webhook := s.webhookFromURL(w, req)
+		if webhook == nil {
+			return
+		}
+
+		deliveries, err := s.store.ListWebhookDeliveries(webhook.ID, webhookDeliveryLogLength)
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, delivery := range deliveries {
+			responses = append(responses, WebhookDeliveryModel(*delivery))
+		}
+		jsonResponse(w, responses)
+	}
+}
+
+// handleRedeliverWebhook provides an endpoint that queues a previous
+// delivery again. The new delivery carries the same event, so receivers can
+// recognise duplicates by the event id.
+func (s *Server) handleRedeliverWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		webhook := s.webhookFromURL(w, req)
+		if webhook == nil {
+			return
+		}
+
+		id, err := strconv.ParseInt(chi.URLParam(req, "delivery"), 10, 64)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidURL)
+			return
+		}
+
+		delivery, err := s.store.GetWebhookDeliveryByID(id)
+		if s.store.IsNotFound(err) || (err == nil && delivery.WebhookID != webhook.ID) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		redelivery := WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   delivery.EventID,
+			EventType: delivery.EventType,
+			Payload:   delivery.Payload,
+		}
+		if err := s.queueDelivery(&redelivery); err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		jsonResponse(w, WebhookDeliveryModel(redelivery))
+	}
+}
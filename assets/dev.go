@@ -17,6 +17,7 @@ import (
 var Assets = union.New(map[string]http.FileSystem{
 	"/migrations": http.Dir(importPathToDir("github.com/k-box/k-link-registry/assets/migrations")),
 	"/static":     http.Dir(importPathToDir("github.com/k-box/k-link-registry/ui/dist")),
+	"/templates":  http.Dir(importPathToDir("github.com/k-box/k-link-registry/assets/templates")),
 })
 
 // importPathToDir is a helper function that resolves the absolute path of
@@ -0,0 +1,8 @@
+
+BEGIN;
+
+DROP TABLE `renewal_request`;
+
+ALTER TABLE `application` DROP COLUMN `valid_from`, DROP COLUMN `valid_until`, DROP COLUMN `reminder_sent_for`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,30 @@
+-- This migration adds an optional validity period to applications, and the
+-- requests of owners to extend it.
+
+BEGIN;
+
+ALTER TABLE `application`
+  ADD COLUMN `valid_from` bigint(20) NOT NULL DEFAULT 0, -- 0 means unbounded
+  ADD COLUMN `valid_until` bigint(20) NOT NULL DEFAULT 0, -- 0 means unbounded
+  ADD COLUMN `reminder_sent_for` bigint(20) NOT NULL DEFAULT 0; -- valid_until the owner was reminded about
+
+--
+-- Table structure for table `renewal_request`
+--
+CREATE TABLE IF NOT EXISTS `renewal_request` (
+  `renewal_request_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `application_id` int(11) NOT NULL,
+  `valid_until` bigint(20) NOT NULL,
+  `justification` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  `status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- pending, approved or rejected
+  `reason` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '', -- optional explanation of the decision
+  `requested_by` bigint(20) NOT NULL,
+  `decided_by` bigint(20) NOT NULL DEFAULT 0,
+  `created_at` int(11) NOT NULL,
+  `decided_at` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`renewal_request_id`),
+  KEY (`application_id`),
+  CONSTRAINT FOREIGN KEY (`application_id`) REFERENCES `application` (`application_id`) ON DELETE CASCADE
+);
+
+COMMIT;
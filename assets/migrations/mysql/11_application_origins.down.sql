@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE `application_origin`;
+
+COMMIT;
\ No newline at end of file
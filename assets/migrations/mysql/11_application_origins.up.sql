@@ -0,0 +1,28 @@
+-- This migration allows applications to authenticate from multiple origins,
+-- including wildcard patterns such as https://*.example.org.
+
+BEGIN;
+
+--
+-- Table structure for table `application_origin`
+--
+CREATE TABLE IF NOT EXISTS `application_origin` (
+  `origin` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL, -- normalised origin or wildcard pattern
+  `application_id` int(11) NOT NULL,
+  `is_primary` tinyint(1) NOT NULL DEFAULT 0, -- origin of the application URL
+  PRIMARY KEY (`origin`),
+  KEY (`application_id`),
+  CONSTRAINT FOREIGN KEY (`application_id`) REFERENCES `application` (`application_id`) ON DELETE CASCADE
+);
+
+--
+-- The URL of existing applications becomes their primary origin. The
+-- normalisation is approximated here and completed when the application is
+-- saved next; until then the URL is also matched exactly.
+--
+INSERT IGNORE INTO `application_origin` (`origin`, `application_id`, `is_primary`)
+  SELECT CONCAT(IF(LOCATE('://', `app_domain`) = 0, 'https://', ''), LOWER(TRIM(TRAILING '/' FROM TRIM(`app_domain`)))),
+    `application_id`, 1
+  FROM `application`;
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+ALTER TABLE `application` DROP COLUMN `challenge_token`, DROP COLUMN `verified_at`;
+
+COMMIT;
\ No newline at end of file
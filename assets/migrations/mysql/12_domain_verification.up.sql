@@ -0,0 +1,15 @@
+-- This migration adds the challenge that proves the control of the domain of
+-- an application.
+
+BEGIN;
+
+ALTER TABLE `application`
+  ADD COLUMN `challenge_token` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  ADD COLUMN `verified_at` bigint(20) NOT NULL DEFAULT 0; -- 0 means unverified
+
+--
+-- Applications that were registered before are considered verified
+--
+UPDATE `application` SET `verified_at` = UNIX_TIMESTAMP();
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE `ownership_transfer`;
+
+COMMIT;
\ No newline at end of file
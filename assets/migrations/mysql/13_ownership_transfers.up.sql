@@ -0,0 +1,26 @@
+-- This migration adds the transfers of applications to a new owner, which
+-- have to be accepted by the new owner.
+
+BEGIN;
+
+--
+-- Table structure for table `ownership_transfer`
+--
+CREATE TABLE IF NOT EXISTS `ownership_transfer` (
+  `transfer_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `application_id` int(11) NOT NULL,
+  `from_id` bigint(20) NOT NULL,
+  `to_id` bigint(20) NOT NULL,
+  `token` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- pending, approved or rejected
+  `requested_by` bigint(20) NOT NULL,
+  `created_at` int(11) NOT NULL,
+  `decided_at` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`transfer_id`),
+  UNIQUE KEY (`token`),
+  KEY (`application_id`),
+  CONSTRAINT FOREIGN KEY (`application_id`) REFERENCES `application` (`application_id`) ON DELETE CASCADE,
+  CONSTRAINT FOREIGN KEY (`to_id`) REFERENCES `registrant` (`registrant_id`) ON DELETE CASCADE
+);
+
+COMMIT;
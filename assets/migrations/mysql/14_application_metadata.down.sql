@@ -0,0 +1,7 @@
+
+BEGIN;
+
+ALTER TABLE `application` DROP COLUMN `description`, DROP COLUMN `tags`, DROP COLUMN `technical_contact`,
+  DROP COLUMN `security_contact`, DROP COLUMN `logo_url`, DROP COLUMN `environment`;
+
+COMMIT;
\ No newline at end of file
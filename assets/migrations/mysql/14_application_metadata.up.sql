@@ -0,0 +1,14 @@
+-- This migration adds descriptive metadata to applications, such as tags and
+-- contacts, which network managers can filter by.
+
+BEGIN;
+
+ALTER TABLE `application`
+  ADD COLUMN `description` text COLLATE utf8mb4_unicode_ci NOT NULL,
+  ADD COLUMN `tags` longtext COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '(DC2Type:simple_array)',
+  ADD COLUMN `technical_contact` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  ADD COLUMN `security_contact` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  ADD COLUMN `logo_url` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  ADD COLUMN `environment` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT 'production'; -- production, staging, development or test
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE `join_request`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,26 @@
+-- This migration adds the requests of registrants to join a K-Link, which are
+-- approved or rejected by the managers of the K-Link.
+
+BEGIN;
+
+--
+-- Table structure for table `join_request`
+--
+CREATE TABLE IF NOT EXISTS `join_request` (
+  `join_request_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `klink_id` bigint(20) NOT NULL,
+  `registrant_id` bigint(20) NOT NULL,
+  `justification` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  `status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- pending, approved or rejected
+  `reason` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '', -- optional explanation of the decision
+  `decided_by` bigint(20) NOT NULL DEFAULT 0,
+  `created_at` int(11) NOT NULL,
+  `decided_at` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`join_request_id`),
+  KEY (`klink_id`),
+  KEY (`registrant_id`),
+  CONSTRAINT FOREIGN KEY (`klink_id`) REFERENCES `klink` (`klink_id`) ON DELETE CASCADE,
+  CONSTRAINT FOREIGN KEY (`registrant_id`) REFERENCES `registrant` (`registrant_id`) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,11 @@
+
+BEGIN;
+
+DROP TABLE `klink_health_check`;
+
+ALTER TABLE `klink`
+  DROP COLUMN `health_url`,
+  DROP COLUMN `health_status`,
+  DROP COLUMN `health_checked_at`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,27 @@
+-- This migration adds an optional health-check URL to K-Links, which is
+-- probed in the background, and the history of the health checks.
+
+BEGIN;
+
+ALTER TABLE `klink`
+  ADD COLUMN `health_url` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  ADD COLUMN `health_status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '', -- up, down or empty if not checked yet
+  ADD COLUMN `health_checked_at` int(11) NOT NULL DEFAULT 0;
+
+--
+-- Table structure for table `klink_health_check`
+--
+CREATE TABLE IF NOT EXISTS `klink_health_check` (
+  `health_check_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `klink_id` bigint(20) NOT NULL,
+  `checked_at` int(11) NOT NULL,
+  `status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- up or down
+  `status_code` int(11) NOT NULL DEFAULT 0, -- HTTP status code, 0 if no response was received
+  `latency` int(11) NOT NULL DEFAULT 0, -- in milliseconds
+  `error` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  PRIMARY KEY (`health_check_id`),
+  KEY (`klink_id`, `checked_at`),
+  CONSTRAINT FOREIGN KEY (`klink_id`) REFERENCES `klink` (`klink_id`) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,12 @@
+
+BEGIN;
+
+ALTER TABLE `application` DROP COLUMN `peer_id`, DROP COLUMN `remote_id`;
+
+ALTER TABLE `klink` DROP COLUMN `peer_id`, DROP COLUMN `remote_id`;
+
+DROP TABLE `change_log`;
+
+DROP TABLE `peer`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,55 @@
+-- This migration adds the peer registries of the network, the log of changes
+-- peers pull from this registry, and marks the K-Links and applications
+-- imported from a peer.
+
+BEGIN;
+
+--
+-- Table structure for table `peer`
+--
+CREATE TABLE IF NOT EXISTS `peer` (
+  `peer_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `name` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `url` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '', -- empty if this registry does not subscribe to the peer
+  `peer_key` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `secret` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL, -- shared secret for signing requests and responses
+  `registrant_id` bigint(20) NOT NULL, -- owner of the imported records
+  `active` tinyint(1) NOT NULL,
+  `sync_cursor` bigint(20) NOT NULL DEFAULT 0, -- last change imported from the peer
+  `last_sync_at` int(11) NOT NULL DEFAULT 0,
+  `last_error` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  PRIMARY KEY (`peer_id`),
+  UNIQUE KEY (`peer_key`),
+  KEY (`registrant_id`),
+  CONSTRAINT FOREIGN KEY (`registrant_id`) REFERENCES `registrant` (`registrant_id`)
+);
+
+--
+-- Table structure for table `change_log`
+--
+CREATE TABLE IF NOT EXISTS `change_log` (
+  `change_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `kind` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- application or klink
+  `record_id` bigint(20) NOT NULL,
+  `created_at` int(11) NOT NULL,
+  PRIMARY KEY (`change_id`)
+);
+
+ALTER TABLE `klink`
+  ADD COLUMN `peer_id` bigint(20) NOT NULL DEFAULT 0, -- 0 for local K-Links
+  ADD COLUMN `remote_id` bigint(20) NOT NULL DEFAULT 0,
+  ADD KEY (`peer_id`, `remote_id`);
+
+ALTER TABLE `application`
+  ADD COLUMN `peer_id` bigint(20) NOT NULL DEFAULT 0, -- 0 for local applications
+  ADD COLUMN `remote_id` bigint(20) NOT NULL DEFAULT 0,
+  ADD KEY (`peer_id`, `remote_id`);
+
+-- existing records are pulled by the peers on their first sync, K-Links
+-- first as the applications refer to them
+INSERT INTO `change_log` (`kind`, `record_id`, `created_at`)
+  SELECT 'klink', `klink_id`, UNIX_TIMESTAMP() FROM `klink` ORDER BY `klink_id`;
+INSERT INTO `change_log` (`kind`, `record_id`, `created_at`)
+  SELECT 'application', `application_id`, UNIX_TIMESTAMP() FROM `application` ORDER BY `application_id`;
+
+COMMIT;
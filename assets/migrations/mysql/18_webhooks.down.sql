@@ -0,0 +1,8 @@
+
+BEGIN;
+
+DROP TABLE `webhook_delivery`;
+
+DROP TABLE `webhook`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,42 @@
+-- This migration adds the webhooks that subscribe to registry events and the
+-- log of their deliveries.
+
+BEGIN;
+
+--
+-- Table structure for table `webhook`
+--
+CREATE TABLE IF NOT EXISTS `webhook` (
+  `webhook_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `url` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `secret` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL, -- signs the deliveries
+  `events` text COLLATE utf8mb4_unicode_ci NOT NULL, -- comma separated event types, empty for all events
+  `active` tinyint(1) NOT NULL,
+  `created_by` bigint(20) NOT NULL,
+  `created_at` int(11) NOT NULL,
+  PRIMARY KEY (`webhook_id`)
+);
+
+--
+-- Table structure for table `webhook_delivery`
+--
+CREATE TABLE IF NOT EXISTS `webhook_delivery` (
+  `delivery_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `webhook_id` bigint(20) NOT NULL,
+  `event_id` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `event_type` varchar(50) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `payload` mediumtext COLLATE utf8mb4_unicode_ci NOT NULL,
+  `status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- pending, delivered or failed
+  `attempts` int(11) NOT NULL DEFAULT 0,
+  `status_code` int(11) NOT NULL DEFAULT 0,
+  `error` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  `created_at` int(11) NOT NULL,
+  `next_attempt_at` int(11) NOT NULL,
+  `delivered_at` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`delivery_id`),
+  KEY (`webhook_id`),
+  KEY (`status`, `next_attempt_at`),
+  CONSTRAINT FOREIGN KEY (`webhook_id`) REFERENCES `webhook` (`webhook_id`) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE `event_log`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,20 @@
+-- This migration adds the log of events, from which subscribers of the event
+-- stream resume after reconnecting.
+
+BEGIN;
+
+--
+-- Table structure for table `event_log`
+--
+CREATE TABLE IF NOT EXISTS `event_log` (
+  `event_seq` bigint(20) NOT NULL AUTO_INCREMENT, -- sent as the id of the server-sent event
+  `event_id` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `event_type` varchar(50) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `subject_id` bigint(20) NOT NULL, -- application, K-Link or registrant the event is about
+  `payload` mediumtext COLLATE utf8mb4_unicode_ci NOT NULL,
+  `created_at` int(11) NOT NULL,
+  PRIMARY KEY (`event_seq`),
+  KEY (`created_at`)
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE `klink_member`;
+
+COMMIT;
\ No newline at end of file
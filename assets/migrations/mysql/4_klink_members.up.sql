@@ -0,0 +1,25 @@
+-- This migration adds K-Link scoped roles, so that a K-Link can be
+-- administered by several registrants without global privileges
+
+BEGIN;
+
+--
+-- Table structure for table `klink_member`
+--
+CREATE TABLE IF NOT EXISTS `klink_member` (
+  `klink_id` bigint(20) NOT NULL,
+  `registrant_id` bigint(20) NOT NULL,
+  `role` varchar(50) COLLATE utf8mb4_unicode_ci NOT NULL, -- manager, curator or viewer
+  PRIMARY KEY (`klink_id`, `registrant_id`),
+  KEY (`registrant_id`),
+  CONSTRAINT FOREIGN KEY (`klink_id`) REFERENCES `klink` (`klink_id`) ON DELETE CASCADE,
+  CONSTRAINT FOREIGN KEY (`registrant_id`) REFERENCES `registrant` (`registrant_id`) ON DELETE CASCADE
+);
+
+--
+-- The current managers become the first members of their K-Link
+--
+INSERT INTO `klink_member` (`klink_id`, `registrant_id`, `role`)
+  SELECT `klink_id`, `manager_id`, 'manager' FROM `klink` WHERE `manager_id` IS NOT NULL;
+
+COMMIT;
@@ -0,0 +1,16 @@
+
+BEGIN;
+
+DROP TABLE `access_request`;
+
+ALTER TABLE `application` ADD COLUMN `klinks` longtext COLLATE utf8mb4_unicode_ci COMMENT '(DC2Type:simple_array)';
+
+UPDATE `application` a SET a.`klinks` = (
+  SELECT GROUP_CONCAT(k.`identifier`) FROM `application_klink` ak
+  JOIN `klink` k ON k.`klink_id` = ak.`klink_id`
+  WHERE ak.`application_id` = a.`application_id`
+);
+
+DROP TABLE `application_klink`;
+
+COMMIT;
\ No newline at end of file
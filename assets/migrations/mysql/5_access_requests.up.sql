@@ -0,0 +1,49 @@
+-- This migration moves the K-Links of an application into a separate table,
+-- so that access to a K-Link can only be granted by approving an access
+-- request.
+
+BEGIN;
+
+--
+-- Table structure for table `application_klink`
+--
+CREATE TABLE IF NOT EXISTS `application_klink` (
+  `application_id` int(11) NOT NULL,
+  `klink_id` bigint(20) NOT NULL,
+  PRIMARY KEY (`application_id`, `klink_id`),
+  KEY (`klink_id`),
+  CONSTRAINT FOREIGN KEY (`application_id`) REFERENCES `application` (`application_id`) ON DELETE CASCADE,
+  CONSTRAINT FOREIGN KEY (`klink_id`) REFERENCES `klink` (`klink_id`) ON DELETE CASCADE
+);
+
+--
+-- K-Links that were assigned before are considered approved
+--
+INSERT INTO `application_klink` (`application_id`, `klink_id`)
+  SELECT a.`application_id`, k.`klink_id` FROM `application` a
+  JOIN `klink` k ON FIND_IN_SET(k.`identifier`, a.`klinks`) > 0;
+
+ALTER TABLE `application` DROP COLUMN `klinks`;
+
+--
+-- Table structure for table `access_request`
+--
+CREATE TABLE IF NOT EXISTS `access_request` (
+  `access_request_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `application_id` int(11) NOT NULL,
+  `klink_id` bigint(20) NOT NULL,
+  `permissions` longtext COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '(DC2Type:simple_array)',
+  `status` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- pending, approved or rejected
+  `reason` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '', -- optional explanation of the decision
+  `requested_by` bigint(20) NOT NULL,
+  `decided_by` bigint(20) NOT NULL DEFAULT 0,
+  `created_at` int(11) NOT NULL,
+  `decided_at` int(11) NOT NULL DEFAULT 0,
+  PRIMARY KEY (`access_request_id`),
+  KEY (`application_id`),
+  KEY (`klink_id`),
+  CONSTRAINT FOREIGN KEY (`application_id`) REFERENCES `application` (`application_id`) ON DELETE CASCADE,
+  CONSTRAINT FOREIGN KEY (`klink_id`) REFERENCES `klink` (`klink_id`) ON DELETE CASCADE
+);
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+ALTER TABLE `application_klink` DROP COLUMN `permissions`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,14 @@
+-- This migration stores the permissions of an application per K-Link.
+-- Existing grants receive the permissions of the application, so that
+-- nothing changes for applications registered before.
+
+BEGIN;
+
+ALTER TABLE `application_klink` ADD COLUMN `permissions` longtext COLLATE utf8mb4_unicode_ci COMMENT '(DC2Type:simple_array)';
+
+UPDATE `application_klink` ak JOIN `application` a ON a.`application_id` = ak.`application_id`
+  SET ak.`permissions` = COALESCE(a.`permissions`, '');
+
+ALTER TABLE `application_klink` MODIFY COLUMN `permissions` longtext COLLATE utf8mb4_unicode_ci NOT NULL COMMENT '(DC2Type:simple_array)';
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+ALTER TABLE `permission` DROP COLUMN `description`, DROP COLUMN `deprecated`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,10 @@
+-- This migration adds a description and a deprecation flag to the
+-- permissions, so that the catalogue can be managed through the API.
+
+BEGIN;
+
+ALTER TABLE `permission`
+  ADD COLUMN `description` varchar(255) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  ADD COLUMN `deprecated` tinyint(1) NOT NULL DEFAULT 0;
+
+COMMIT;
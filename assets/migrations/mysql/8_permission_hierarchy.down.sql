@@ -0,0 +1,6 @@
+
+BEGIN;
+
+ALTER TABLE `permission` DROP COLUMN `implies`;
+
+COMMIT;
\ No newline at end of file
@@ -0,0 +1,9 @@
+-- This migration allows permissions to imply other permissions. The implied
+-- permissions of the built-in permissions are filled in on start.
+
+BEGIN;
+
+ALTER TABLE `permission`
+  ADD COLUMN `implies` varchar(1000) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '' COMMENT '(DC2Type:simple_array)';
+
+COMMIT;
@@ -0,0 +1,6 @@
+
+BEGIN;
+
+DROP TABLE `audit_log`;
+
+COMMIT;
\ No newline at end of file
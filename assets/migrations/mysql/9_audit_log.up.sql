@@ -0,0 +1,23 @@
+-- This migration adds the audit log, which records security relevant
+-- actions like denied authentications.
+
+BEGIN;
+
+--
+-- Table structure for table `audit_log`
+--
+CREATE TABLE IF NOT EXISTS `audit_log` (
+  `audit_id` bigint(20) NOT NULL AUTO_INCREMENT,
+  `created_at` int(11) NOT NULL,
+  `action` varchar(100) COLLATE utf8mb4_unicode_ci NOT NULL,
+  `actor_id` bigint(20) NOT NULL DEFAULT 0, -- registrant, 0 for applications
+  `application_id` int(11) NOT NULL DEFAULT 0,
+  `outcome` varchar(20) COLLATE utf8mb4_unicode_ci NOT NULL, -- granted or denied
+  `reason` varchar(100) COLLATE utf8mb4_unicode_ci NOT NULL DEFAULT '',
+  `detail` text COLLATE utf8mb4_unicode_ci NOT NULL,
+  PRIMARY KEY (`audit_id`),
+  KEY (`application_id`),
+  KEY (`created_at`)
+);
+
+COMMIT;
@@ -0,0 +1,57 @@
+package klinkregistry
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditActionAuthenticate = "application.authenticate"
+	AuditActionTransfer     = "application.transfer"
+)
+
+// audit records an entry in the audit log once the action is done
+func (s *Server) audit(entry *AuditEntry) {
+	entry.CreatedAt = time.Now().UTC().Unix()
+
+	if err := s.store.CreateAuditEntry(entry); err != nil {
+		s.logger.WithError(err).WithField("action", entry.Action).Error("Error writing audit entry")
+	}
+}
+
+// auditDenial records the reason why an application was denied access
+func (s *Server) auditDenial(auth *Authorization, appURL string) {
+	var details []string
+	for _, check := range auth.Checks {
+		if check.Result == CheckFailed && check.Detail != "" {
+			details = append(details, check.Detail)
+		}
+	}
+
+	entry := &AuditEntry{
+		Action:  AuditActionAuthenticate,
+		Outcome: AuditDenied,
+		Reason:  auth.Reason,
+		Detail:  appURL + ": " + strings.Join(details, "; "),
+	}
+	if auth.App != nil {
+		entry.ApplicationID = auth.App.ID
+	}
+
+	s.audit(entry)
+}
+
+// auditTransfer records the change of the owner of an application, or the
+// rejection of a transfer
+func (s *Server) auditTransfer(actorID int64, app *Application, fromID, toID int64, outcome, reason string) {
+	s.audit(&AuditEntry{
+		Action:        AuditActionTransfer,
+		ActorID:       actorID,
+		ApplicationID: app.ID,
+		Outcome:       outcome,
+		Reason:        reason,
+		Detail:        fmt.Sprintf("%s: registrant %d to %d", app.URL, fromID, toID),
+	})
+}
@@ -0,0 +1,244 @@
+package klinkregistry
+
+import (
+	"strings"
+	"time"
+)
+
+// Reasons why an application is denied access. They are recorded in the
+// audit log and returned by the authorization dry-run.
+const (
+	DenyUnknownApplication  = "unknown_application"
+	DenyInactiveApplication = "inactive_application"
+	DenyUnverifiedDomain    = "unverified_domain"
+	DenyNotYetValid         = "not_yet_valid"
+	DenyExpired             = "expired"
+	DenyInvalidSecret       = "invalid_secret"
+	DenyKlinkNotGranted     = "klink_not_granted"
+	DenyInactiveKlink       = "inactive_klink"
+	DenyMissingPermission   = "missing_permission"
+	DenyUnknownOwner        = "unknown_owner"
+	DenyInactiveOwner       = "inactive_owner"
+	DenyDatabaseError       = "database_error"
+)
+
+// Possible results of a single authorization check
+const (
+	CheckPassed  = "passed"
+	CheckFailed  = "failed"
+	CheckSkipped = "skipped"
+)
+
+// AuthorizationRequest contains the parameters of an authorization
+type AuthorizationRequest struct {
+	AppURL      string
+	AppSecret   string
+	Permissions []string
+	KlinkID     string
+
+	// SkipSecret is set by the dry-run, as the secret is optional there
+	SkipSecret bool
+}
+
+// AuthorizationCheck is the result of a single check of an authorization
+type AuthorizationCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Reason string `json:"reason,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Authorization is the outcome of an authorization. The application contains
+// the effective permissions. Reason contains the reason of the first failed
+// check, and is empty if access is granted.
+type Authorization struct {
+	App    *Application
+	Owner  *Registrant
+	Checks []AuthorizationCheck
+	Reason string
+}
+
+// Granted returns true if all checks passed
+func (a *Authorization) Granted() bool {
+	return a.Reason == ""
+}
+
+func (a *Authorization) pass(name, detail string) {
+	a.Checks = append(a.Checks, AuthorizationCheck{Name: name, Result: CheckPassed, Detail: detail})
+}
+
+func (a *Authorization) skip(name, detail string) {
+	a.Checks = append(a.Checks, AuthorizationCheck{Name: name, Result: CheckSkipped, Detail: detail})
+}
+
+func (a *Authorization) fail(name, reason, detail string) {
+	a.Checks = append(a.Checks, AuthorizationCheck{Name: name, Result: CheckFailed, Reason: reason, Detail: detail})
+	if a.Reason == "" {
+		a.Reason = reason
+	}
+}
+
+// missingPermissions returns the requested permissions that are not granted
+func missingPermissions(granted, requested []string) []string {
+	var missing []string
+	for _, permission := range requested {
+		if !stringInSlice(permission, granted) {
+			missing = append(missing, permission)
+		}
+	}
+	return missing
+}
+
+// authorize runs all checks that decide if an application may access the
+// registry with the requested permissions. Once the application is known,
+// the remaining checks are run even if one fails, so that the dry-run can
+// explain every problem at once.
+func (s *Server) authorize(request AuthorizationRequest) *Authorization {
+	auth := &Authorization{}
+
+	app, err := s.applicationByURL(request.AppURL)
+	if s.store.IsNotFound(err) {
+		auth.fail("application", DenyUnknownApplication, "No application is registered for "+request.AppURL)
+		return auth
+	} else if err != nil {
+		auth.fail("application", DenyDatabaseError, "The application could not be loaded")
+		return auth
+	}
+	auth.pass("application", "")
+
+	if app.Active {
+		auth.pass("active", "")
+	} else if s.config.AllowInactiveApplications {
+		auth.pass("active", "The application is not active, which is allowed by the configuration")
+	} else {
+		auth.fail("active", DenyInactiveApplication, "The application is not active")
+	}
+
+	if app.VerifiedAt != 0 {
+		auth.pass("domain", "")
+	} else if s.config.AllowUnverifiedApplications {
+		auth.pass("domain", "The domain is not verified, which is allowed by the configuration")
+	} else {
+		auth.fail("domain", DenyUnverifiedDomain, "The domain of the application is not verified")
+	}
+
+	now := time.Now()
+	if app.ValidFrom != 0 && now.Unix() < app.ValidFrom {
+		auth.fail("validity", DenyNotYetValid, "The application is valid from "+time.Unix(app.ValidFrom, 0).UTC().Format(time.RFC3339))
+	} else if !app.IsValidAt(now) {
+		auth.fail("validity", DenyExpired, "The application expired at "+time.Unix(app.ValidUntil, 0).UTC().Format(time.RFC3339))
+	} else {
+		auth.pass("validity", "")
+	}
+
+	if request.SkipSecret {
+		auth.skip("secret", "No secret given")
+	} else if !app.MatchesSecret(request.AppSecret) {
+		auth.fail("secret", DenyInvalidSecret, "The secret does not match")
+	} else {
+		auth.pass("secret", "")
+	}
+
+	// permissions are checked against the effective set, which contains
+	// implied permissions and resolves wildcards
+	catalogue, err := s.store.ListPermissions()
+	if err != nil && !s.store.IsNotFound(err) {
+		auth.fail("permissions", DenyDatabaseError, "The permissions could not be loaded")
+		return auth
+	}
+	auth.App = effectiveApplication(app, catalogue)
+
+	inactive, err := s.removeInactiveGrants(auth.App)
+	if err != nil {
+		auth.fail("klink", DenyDatabaseError, "The K-Links could not be loaded")
+		return auth
+	}
+
+	granted := auth.App.Permissions
+	if request.KlinkID == "" {
+		auth.skip("klink", "No K-Link given, the application permissions are checked")
+	} else if stringInSlice(request.KlinkID, inactive) {
+		auth.fail("klink", DenyInactiveKlink, "The K-Link "+request.KlinkID+" is not active")
+		granted = nil
+	} else if grant := auth.App.GetGrant(request.KlinkID); grant == nil {
+		auth.fail("klink", DenyKlinkNotGranted, "The application has no access to "+request.KlinkID)
+		granted = nil
+	} else {
+		auth.pass("klink", "")
+		granted = grant.Permissions
+	}
+
+	if missing := missingPermissions(granted, request.Permissions); len(missing) > 0 {
+		auth.fail("permissions", DenyMissingPermission, "Not granted: "+strings.Join(missing, ", "))
+	} else {
+		auth.pass("permissions", "")
+	}
+
+	owner, err := s.store.GetRegistrantByID(app.OwnerID)
+	if s.store.IsNotFound(err) {
+		auth.fail("owner", DenyUnknownOwner, "The owner of the application does not exist")
+	} else if err != nil {
+		auth.fail("owner", DenyDatabaseError, "The owner could not be loaded")
+	} else if !owner.Active && s.config.DenyInactiveOwners {
+		auth.Owner = owner
+		auth.fail("owner", DenyInactiveOwner, "The owner of the application is not active")
+	} else {
+		auth.Owner = owner
+		auth.pass("owner", "")
+	}
+
+	return auth
+}
+
+// removeInactiveGrants removes the grants of K-Links that are not active from
+// the application, unless the configuration allows them. The identifiers of
+// the removed K-Links are returned.
+func (s *Server) removeInactiveGrants(app *Application) ([]string, error) {
+	if s.config.AllowInactiveKlinks {
+		return nil, nil
+	}
+
+	klinks, err := s.klinksByIdentifier(app.Klinks)
+	if err != nil {
+		return nil, err
+	}
+
+	var inactive []string
+	grants := make([]KlinkGrant, 0, len(app.Grants))
+	for _, grant := range app.Grants {
+		klink, ok := klinks[grant.Klink]
+		if !ok {
+			// unknown klinks are skipped when the response is built
+			grants = append(grants, grant)
+			continue
+		}
+
+		if !klink.Active {
+			inactive = append(inactive, grant.Klink)
+			continue
+		}
+		grants = append(grants, grant)
+	}
+	app.SetGrants(grants)
+
+	return inactive, nil
+}
+
+// klinksByIdentifier loads the klinks with the given identifiers in a single
+// query, and returns them by identifier
+func (s *Server) klinksByIdentifier(identifiers []string) (map[string]*Klink, error) {
+	klinks := make(map[string]*Klink, len(identifiers))
+	if len(identifiers) == 0 {
+		return klinks, nil
+	}
+
+	list, err := s.store.ListKlinksByIdentifier(identifiers)
+	if err != nil && !s.store.IsNotFound(err) {
+		return nil, err
+	}
+
+	for _, klink := range list {
+		klinks[klink.Identifier] = klink
+	}
+	return klinks, nil
+}
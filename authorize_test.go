@@ -0,0 +1,141 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestApplicationDryRun(t *testing.T) {
+	s, store := newTestServer(t)
+
+	rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/dry-run",
+		`{"klink_id":"k-unknown","permissions":["data-search"]}`)
+	if rec.Code != 200 {
+		t.Fatalf("expected the dry-run to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var response AuthorizationModel
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Granted || response.Reason != DenyKlinkNotGranted {
+		t.Errorf("expected access to be denied because of the klink, got %+v", response)
+	}
+
+	want := map[string]string{
+		"application": CheckPassed,
+		"active":      CheckPassed,
+		"secret":      CheckSkipped,
+		"klink":       CheckFailed,
+		"permissions": CheckFailed,
+		"domain":      CheckPassed,
+		"validity":    CheckPassed,
+		"owner":       CheckPassed,
+	}
+	if len(response.Checks) != len(want) {
+		t.Errorf("expected %d checks, got %+v", len(want), response.Checks)
+	}
+	for _, check := range response.Checks {
+		if want[check.Name] != check.Result {
+			t.Errorf("expected check %s to be %s, got %s", check.Name, want[check.Name], check.Result)
+		}
+	}
+}
+
+func TestAuthenticateAuditsDenials(t *testing.T) {
+	s, store := newTestServer(t)
+
+	body := `{"id":"1","params":{"app_url":"https://alice.example.com","app_secret":"wrong","permissions":["data-search"]}}`
+	serve(t, s, store, 0, "POST", "/api/1.0/application.authenticate", body)
+
+	if len(store.audit) != 1 {
+		t.Fatalf("expected one audit entry, got %d", len(store.audit))
+	}
+
+	entry := store.audit[0]
+	if entry.Outcome != AuditDenied || entry.Reason != DenyInvalidSecret || entry.ApplicationID != testAliceAppID {
+		t.Errorf("expected the denial to be recorded with its reason, got %+v", entry)
+	}
+}
+
+func TestAuthorizeInactive(t *testing.T) {
+	cases := []struct {
+		name   string
+		config func(*Config)
+		setup  func(*memStore)
+		klink  string
+		reason string
+	}{
+		{
+			name:   "inactive application",
+			setup:  func(m *memStore) { m.applications[testAliceAppID].Active = false },
+			reason: DenyInactiveApplication,
+		},
+		{
+			name:   "inactive application allowed",
+			config: func(c *Config) { c.AllowInactiveApplications = true },
+			setup:  func(m *memStore) { m.applications[testAliceAppID].Active = false },
+		},
+		{
+			name:   "inactive klink",
+			setup:  func(m *memStore) { m.klinks[testKlinkID].Active = false },
+			klink:  testKlinkIdentifier,
+			reason: DenyInactiveKlink,
+		},
+		{
+			name:   "inactive klink allowed",
+			config: func(c *Config) { c.AllowInactiveKlinks = true },
+			setup:  func(m *memStore) { m.klinks[testKlinkID].Active = false },
+			klink:  testKlinkIdentifier,
+		},
+		{
+			name:  "inactive owner",
+			setup: func(m *memStore) { m.registrants[testAliceID].Active = false },
+		},
+		{
+			name:   "inactive owner denied",
+			config: func(c *Config) { c.DenyInactiveOwners = true },
+			setup:  func(m *memStore) { m.registrants[testAliceID].Active = false },
+			reason: DenyInactiveOwner,
+		},
+	}
+
+	for _, c := range cases {
+		s, store := newTestServer(t)
+		if c.config != nil {
+			c.config(s.config)
+		}
+		c.setup(store)
+
+		auth := s.authorize(AuthorizationRequest{
+			AppURL:      "https://alice.example.com",
+			AppSecret:   "alice",
+			Permissions: []string{"data-search"},
+			KlinkID:     c.klink,
+		})
+		if auth.Reason != c.reason {
+			t.Errorf("%s: expected reason %q, got %q", c.name, c.reason, auth.Reason)
+		}
+	}
+}
+
+func TestAuthenticateFiltersInactiveKlinks(t *testing.T) {
+	s, store := newTestServer(t)
+	store.klinks[testKlinkID].Active = false
+
+	response := authenticate(t, s, store, "", "data-search")
+	if response.Error != nil {
+		t.Fatalf("expected access to be granted, got %v", response.Error)
+	}
+
+	result, _ := json.Marshal(response.Result)
+	var authenticated struct {
+		Klinks []KlinkResponse `json:"klinks"`
+	}
+	json.Unmarshal(result, &authenticated)
+
+	if len(authenticated.Klinks) != 0 {
+		t.Errorf("expected inactive klinks to be filtered, got %+v", authenticated.Klinks)
+	}
+}
@@ -0,0 +1,302 @@
+package klinkregistry
+
+import (
+	"container/list"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Cache stores encoded records by key. The in-process LRUCache is used by
+// default; a shared cache can be configured when several instances of the
+// registry serve the same database, so that they see each others writes.
+type Cache interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte)
+	Purge()
+}
+
+// LRUCache is an in-process Cache that holds up to a number of entries, and
+// evicts the least recently used entry when it is full. Entries expire after
+// the TTL, unless it is 0.
+type LRUCache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	order   *list.List
+	entries map[string]*list.Element
+
+	now func() time.Time
+}
+
+type lruEntry struct {
+	key     string
+	value   []byte
+	expires time.Time
+}
+
+// NewLRUCache returns an empty LRUCache
+func NewLRUCache(size int, ttl time.Duration) *LRUCache {
+	return &LRUCache{
+		size:    size,
+		ttl:     ttl,
+		order:   list.New(),
+		entries: make(map[string]*list.Element),
+		now:     time.Now,
+	}
+}
+
+// Get returns the value of the key, if it is cached and not expired
+func (c *LRUCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+
+	entry := element.Value.(*lruEntry)
+	if c.ttl > 0 && c.now().After(entry.expires) {
+		c.order.Remove(element)
+		delete(c.entries, key)
+		return nil, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.value, true
+}
+
+// Set caches the value of the key, evicting the least recently used entry if
+// the cache is full
+func (c *LRUCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	expires := c.now().Add(c.ttl)
+	if element, ok := c.entries[key]; ok {
+		entry := element.Value.(*lruEntry)
+		entry.value = value
+		entry.expires = expires
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&lruEntry{key: key, value: value, expires: expires})
+
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*lruEntry).key)
+	}
+}
+
+// Purge removes all entries
+func (c *LRUCache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// CachedStore is a read-through cache in front of a Storer for the lookups
+// of the authentication of applications. Every write to applications,
+// registrants, K-Links or permissions purges the cache, the other methods
+// are passed through. The last login of registrants and the health of
+// K-Links do not affect the authentication and are written often, so they
+// do not purge the cache.
+type CachedStore struct {
+	Storer
+	cache Cache
+
+	// generation is increased by every purge, so that a record loaded
+	// before a write is not cached after it
+	generation uint64
+}
+
+// NewCachedStore returns a CachedStore that caches the reads of the store
+func NewCachedStore(store Storer, cache Cache) *CachedStore {
+	return &CachedStore{Storer: store, cache: cache}
+}
+
+// cached decodes the cached value of the key into value. On a miss, the
+// value is loaded, cached and decoded.
+func (c *CachedStore) cached(key string, value interface{}, load func() (interface{}, error)) error {
+	if data, ok := c.cache.Get(key); ok && json.Unmarshal(data, value) == nil {
+		return nil
+	}
+
+	generation := atomic.LoadUint64(&c.generation)
+	loaded, err := load()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(loaded)
+	if err != nil {
+		return err
+	}
+	if atomic.LoadUint64(&c.generation) == generation {
+		c.cache.Set(key, data)
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func (c *CachedStore) purge() {
+	atomic.AddUint64(&c.generation, 1)
+	c.cache.Purge()
+}
+
+// GetApplicationByDomain returns the cached application of the URL
+func (c *CachedStore) GetApplicationByDomain(domain string) (*Application, error) {
+	app := new(Application)
+	err := c.cached("application.domain:"+domain, app, func() (interface{}, error) {
+		return c.Storer.GetApplicationByDomain(domain)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// GetApplicationByOrigin returns the cached application of the most specific
+// origin candidate
+func (c *CachedStore) GetApplicationByOrigin(candidates []string) (*Application, error) {
+	app := new(Application)
+	err := c.cached("application.origin:"+strings.Join(candidates, " "), app, func() (interface{}, error) {
+		return c.Storer.GetApplicationByOrigin(candidates)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return app, nil
+}
+
+// GetRegistrantByID returns the cached registrant
+func (c *CachedStore) GetRegistrantByID(id int64) (*Registrant, error) {
+	registrant := new(Registrant)
+	err := c.cached("registrant:"+strconv.FormatInt(id, 10), registrant, func() (interface{}, error) {
+		return c.Storer.GetRegistrantByID(id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return registrant, nil
+}
+
+// GetKlinkByIdentifier returns the cached klink
+func (c *CachedStore) GetKlinkByIdentifier(identifier string) (*Klink, error) {
+	klink := new(Klink)
+	err := c.cached("klink:"+identifier, klink, func() (interface{}, error) {
+		return c.Storer.GetKlinkByIdentifier(identifier)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return klink, nil
+}
+
+// ListKlinksByIdentifier returns the cached klinks of the identifiers
+func (c *CachedStore) ListKlinksByIdentifier(identifiers []string) ([]*Klink, error) {
+	sorted := append([]string{}, identifiers...)
+	sort.Strings(sorted)
+
+	var klinks []*Klink
+	err := c.cached("klinks:"+strings.Join(sorted, " "), &klinks, func() (interface{}, error) {
+		return c.Storer.ListKlinksByIdentifier(sorted)
+	})
+	return klinks, err
+}
+
+// ListPermissions returns the cached permission catalogue
+func (c *CachedStore) ListPermissions() ([]*Permission, error) {
+	var permissions []*Permission
+	err := c.cached("permissions", &permissions, func() (interface{}, error) {
+		return c.Storer.ListPermissions()
+	})
+	return permissions, err
+}
+
+// CreateRegistrant creates the registrant and purges the cache
+func (c *CachedStore) CreateRegistrant(r *Registrant) error {
+	defer c.purge()
+	return c.Storer.CreateRegistrant(r)
+}
+
+// ReplaceRegistrant replaces the registrant and purges the cache
+func (c *CachedStore) ReplaceRegistrant(r *Registrant) error {
+	defer c.purge()
+	return c.Storer.ReplaceRegistrant(r)
+}
+
+// DeleteRegistrant deletes the registrant and purges the cache
+func (c *CachedStore) DeleteRegistrant(id int64) error {
+	defer c.purge()
+	return c.Storer.DeleteRegistrant(id)
+}
+
+// CreateApplication creates the application and purges the cache
+func (c *CachedStore) CreateApplication(app *Application) error {
+	defer c.purge()
+	return c.Storer.CreateApplication(app)
+}
+
+// ReplaceApplication replaces the application and purges the cache
+func (c *CachedStore) ReplaceApplication(app *Application) error {
+	defer c.purge()
+	return c.Storer.ReplaceApplication(app)
+}
+
+// DeleteApplication deletes the application and purges the cache
+func (c *CachedStore) DeleteApplication(id int64) error {
+	defer c.purge()
+	return c.Storer.DeleteApplication(id)
+}
+
+// CreateKlink creates the klink and purges the cache
+func (c *CachedStore) CreateKlink(klink *Klink) error {
+	defer c.purge()
+	return c.Storer.CreateKlink(klink)
+}
+
+// UpdateKlink updates the klink and purges the cache
+func (c *CachedStore) UpdateKlink(klink *Klink) error {
+	defer c.purge()
+	return c.Storer.UpdateKlink(klink)
+}
+
+// DeleteKlink deletes the klink and purges the cache
+func (c *CachedStore) DeleteKlink(id int64) error {
+	defer c.purge()
+	return c.Storer.DeleteKlink(id)
+}
+
+// CreatePermission creates the permission and purges the cache
+func (c *CachedStore) CreatePermission(p *Permission) error {
+	defer c.purge()
+	return c.Storer.CreatePermission(p)
+}
+
+// UpdatePermission updates the permission and purges the cache
+func (c *CachedStore) UpdatePermission(p *Permission) error {
+	defer c.purge()
+	return c.Storer.UpdatePermission(p)
+}
+
+// DeletePermission deletes the permission and purges the cache
+func (c *CachedStore) DeletePermission(name string) error {
+	defer c.purge()
+	return c.Storer.DeletePermission(name)
+}
+
+// DeletePeer deletes the peer with its records and purges the cache
+func (c *CachedStore) DeletePeer(id int64) error {
+	defer c.purge()
+	return c.Storer.DeletePeer(id)
+}
@@ -0,0 +1,82 @@
+package klinkregistry
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLRUCache(t *testing.T) {
+	now := time.Now()
+	cache := NewLRUCache(2, time.Minute)
+	cache.now = func() time.Time { return now }
+
+	cache.Set("a", []byte("1"))
+	cache.Set("b", []byte("2"))
+	cache.Get("a")
+	cache.Set("c", []byte("3"))
+
+	if _, ok := cache.Get("b"); ok {
+		t.Error("expected the least recently used entry to be evicted")
+	}
+	if value, ok := cache.Get("a"); !ok || string(value) != "1" {
+		t.Errorf("expected the recently used entry to be kept, got %q", value)
+	}
+
+	now = now.Add(time.Minute + time.Second)
+	if _, ok := cache.Get("c"); ok {
+		t.Error("expected the entry to expire after the TTL")
+	}
+
+	cache.Set("d", []byte("4"))
+	cache.Purge()
+	if _, ok := cache.Get("d"); ok {
+		t.Error("expected the purge to remove all entries")
+	}
+}
+
+func TestCachedAuthenticate(t *testing.T) {
+	s, store := newTestServer(t)
+	s.config.CacheSize = 100
+	s.SetStore(store)
+
+	if res := authenticate(t, s, store, testKlinkIdentifier, "data-search"); res.Error != nil {
+		t.Fatalf("expected the application to be granted, got %+v", res.Error)
+	}
+
+	// changes that bypass the registry are not seen while cached
+	store.applications[testAliceAppID].Token = "changed"
+	if res := authenticate(t, s, store, testKlinkIdentifier, "data-search"); res.Error != nil {
+		t.Errorf("expected the cached application to be granted, got %+v", res.Error)
+	}
+
+	// logins and health checks do not purge the cache
+	s.store.SetRegistrantLastLogin(testAliceID, time.Now().Unix())
+	s.store.SetKlinkHealth(testKlinkID, HealthDown, time.Now().Unix())
+	if res := authenticate(t, s, store, testKlinkIdentifier, "data-search"); res.Error != nil {
+		t.Errorf("expected the application to stay cached, got %+v", res.Error)
+	}
+	store.applications[testAliceAppID].Token = "alice"
+
+	// writes through the registry purge the cache
+	validity := `{"valid_from":0,"valid_until":` + strconv.FormatInt(time.Now().Add(-time.Hour).Unix(), 10) + `}`
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/applications/5/validity", validity); rec.Code != 200 {
+		t.Fatalf("expected the validity to be updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if res := authenticate(t, s, store, testKlinkIdentifier, "data-search"); res.Error == nil {
+		t.Error("expected the expired application to be denied after the write")
+	}
+}
+
+func TestMapToKlink(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	klinks := s.MapToKlink([]KlinkGrant{
+		{Klink: "unknown", Permissions: []string{"data-search"}},
+		{Klink: testKlinkIdentifier},
+	})
+
+	if len(klinks) != 1 || klinks[0].ID != testKlinkIdentifier || klinks[0].Permissions == nil {
+		t.Errorf("expected only the known K-Link with its permissions, got %+v", klinks)
+	}
+}
@@ -0,0 +1,145 @@
+package mysql
+
+import (
+	"strings"
+
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// AccessRequestRow represents an AccessRequest inside the database
+type AccessRequestRow struct {
+	ID            int64  `db:"access_request_id"`
+	ApplicationID int64  `db:"application_id"`
+	KlinkID       int64  `db:"klink_id"`
+	Permissions   string `db:"permissions"`
+	Status        string `db:"status"`
+	Reason        string `db:"reason"`
+	RequestedBy   int64  `db:"requested_by"`
+	DecidedBy     int64  `db:"decided_by"`
+	CreatedAt     int64  `db:"created_at"`
+	DecidedAt     int64  `db:"decided_at"`
+}
+
+func (row *AccessRequestRow) fromAccessRequest(r *klinkregistry.AccessRequest) {
+	if r == nil {
+		return
+	}
+
+	row.ID = r.ID
+	row.ApplicationID = r.ApplicationID
+	row.KlinkID = r.KlinkID
+	row.Permissions = strings.Join(r.Permissions, ",")
+	row.Status = r.Status
+	row.Reason = r.Reason
+	row.RequestedBy = r.RequestedBy
+	row.DecidedBy = r.DecidedBy
+	row.CreatedAt = r.CreatedAt
+	row.DecidedAt = r.DecidedAt
+}
+
+func (row *AccessRequestRow) toAccessRequest() *klinkregistry.AccessRequest {
+	if row == nil {
+		return nil
+	}
+
+	r := new(klinkregistry.AccessRequest)
+
+	r.ID = row.ID
+	r.ApplicationID = row.ApplicationID
+	r.KlinkID = row.KlinkID
+	r.Permissions = splitList(row.Permissions)
+	r.Status = row.Status
+	r.Reason = row.Reason
+	r.RequestedBy = row.RequestedBy
+	r.DecidedBy = row.DecidedBy
+	r.CreatedAt = row.CreatedAt
+	r.DecidedAt = row.DecidedAt
+	return r
+}
+
+// CreateAccessRequest adds a new access request inside the database
+func (db Database) CreateAccessRequest(r *klinkregistry.AccessRequest) error {
+	var row AccessRequestRow
+
+	row.fromAccessRequest(r)
+
+	res, err := db.db.NamedExec(`INSERT INTO access_request (
+			application_id, klink_id, permissions, status, reason,
+			requested_by, decided_by, created_at, decided_at
+		) VALUES (
+			:application_id, :klink_id, :permissions, :status, :reason,
+			:requested_by, :decided_by, :created_at, :decided_at
+		)`, &row)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	r.ID = lastID
+
+	return nil
+}
+
+func (db Database) selectAccessRequests(query string, args ...interface{}) ([]*klinkregistry.AccessRequest, error) {
+	var rows []*AccessRequestRow
+
+	err := db.db.Select(&rows, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var models []*klinkregistry.AccessRequest
+	for _, row := range rows {
+		models = append(models, row.toAccessRequest())
+	}
+
+	return models, nil
+}
+
+// ListAccessRequestsByApplication returns all access requests of an
+// application, newest first
+func (db Database) ListAccessRequestsByApplication(applicationID int64) ([]*klinkregistry.AccessRequest, error) {
+	return db.selectAccessRequests(
+		`SELECT * FROM access_request WHERE application_id=? ORDER BY access_request_id DESC`,
+		applicationID)
+}
+
+// ListAccessRequestsByKlink returns all access requests for a klink, newest
+// first
+func (db Database) ListAccessRequestsByKlink(klinkID int64) ([]*klinkregistry.AccessRequest, error) {
+	return db.selectAccessRequests(
+		`SELECT * FROM access_request WHERE klink_id=? ORDER BY access_request_id DESC`,
+		klinkID)
+}
+
+// GetAccessRequestByID returns a single access request by ID
+func (db Database) GetAccessRequestByID(id int64) (*klinkregistry.AccessRequest, error) {
+	row := new(AccessRequestRow)
+
+	err := db.db.Get(row,
+		`SELECT * FROM access_request WHERE access_request_id=?`,
+		id)
+
+	return row.toAccessRequest(), err
+}
+
+// UpdateAccessRequest stores the decision about an access request
+func (db Database) UpdateAccessRequest(r *klinkregistry.AccessRequest) error {
+	var row AccessRequestRow
+
+	row.fromAccessRequest(r)
+
+	_, err := db.db.NamedExec(`UPDATE access_request SET
+		permissions = :permissions,
+		status = :status,
+		reason = :reason,
+		decided_by = :decided_by,
+		decided_at = :decided_at
+		WHERE access_request_id = :access_request_id`, &row)
+
+	return err
+}
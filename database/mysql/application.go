@@ -1,8 +1,10 @@
 package mysql
 
 import (
+	"database/sql"
 	"strings"
 
+	"github.com/jmoiron/sqlx"
 	klinkregistry "github.com/k-box/k-link-registry"
 )
 
@@ -14,8 +16,36 @@ type ApplicationRow struct {
 	URL         string `db:"app_domain"`
 	Token       string `db:"auth_token"`
 	Permissions string `db:"permissions"`
-	Klinks      string `db:"klinks"`
 	Active      bool   `db:"status"`
+	ValidFrom   int64  `db:"valid_from"`
+	ValidUntil  int64  `db:"valid_until"`
+	Reminder    int64  `db:"reminder_sent_for"`
+	Challenge   string `db:"challenge_token"`
+	VerifiedAt  int64  `db:"verified_at"`
+	Description string `db:"description"`
+	Tags        string `db:"tags"`
+	Technical   string `db:"technical_contact"`
+	Security    string `db:"security_contact"`
+	LogoURL     string `db:"logo_url"`
+	Environment string `db:"environment"`
+	PeerID      int64  `db:"peer_id"`
+	RemoteID    int64  `db:"remote_id"`
+}
+
+// ApplicationOriginRow represents an origin an Application may authenticate
+// from
+type ApplicationOriginRow struct {
+	Origin        string `db:"origin"`
+	ApplicationID int64  `db:"application_id"`
+	Primary       bool   `db:"is_primary"`
+}
+
+// ApplicationKlinkRow represents a K-Link an Application may publish to,
+// with the permissions granted inside the K-Link
+type ApplicationKlinkRow struct {
+	ApplicationID int64  `db:"application_id"`
+	Identifier    string `db:"identifier"`
+	Permissions   string `db:"permissions"`
 }
 
 func (row *ApplicationRow) fromApplication(app *klinkregistry.Application) {
@@ -29,8 +59,20 @@ func (row *ApplicationRow) fromApplication(app *klinkregistry.Application) {
 	row.URL = app.URL
 	row.Token = app.Token
 	row.Permissions = strings.Join(app.Permissions, ",")
-	row.Klinks = strings.Join(app.Klinks, ",")
 	row.Active = app.Active
+	row.ValidFrom = app.ValidFrom
+	row.ValidUntil = app.ValidUntil
+	row.Reminder = app.ReminderSentFor
+	row.Challenge = app.ChallengeToken
+	row.VerifiedAt = app.VerifiedAt
+	row.Description = app.Description
+	row.Tags = strings.Join(app.Tags, ",")
+	row.Technical = app.TechnicalContact
+	row.Security = app.SecurityContact
+	row.LogoURL = app.LogoURL
+	row.Environment = app.Environment
+	row.PeerID = app.PeerID
+	row.RemoteID = app.RemoteID
 }
 
 func (row *ApplicationRow) toApplication() *klinkregistry.Application {
@@ -45,9 +87,22 @@ func (row *ApplicationRow) toApplication() *klinkregistry.Application {
 	app.Name = row.Name
 	app.URL = row.URL
 	app.Token = row.Token
-	app.Permissions = strings.Split(row.Permissions, ",")
-	app.Klinks = strings.Split(row.Klinks, ",")
+	app.Permissions = splitList(row.Permissions)
+	app.SetGrants(nil)
 	app.Active = row.Active
+	app.ValidFrom = row.ValidFrom
+	app.ValidUntil = row.ValidUntil
+	app.ReminderSentFor = row.Reminder
+	app.ChallengeToken = row.Challenge
+	app.VerifiedAt = row.VerifiedAt
+	app.Description = row.Description
+	app.Tags = splitList(row.Tags)
+	app.TechnicalContact = row.Technical
+	app.SecurityContact = row.Security
+	app.LogoURL = row.LogoURL
+	app.Environment = row.Environment
+	app.PeerID = row.PeerID
+	app.RemoteID = row.RemoteID
 	return app
 }
 
@@ -58,9 +113,15 @@ func (db Database) CreateApplication(app *klinkregistry.Application) error {
 	row.fromApplication(app)
 
 	res, err := db.db.NamedExec(`INSERT INTO application (
-			registrant_id, name, app_domain, auth_token, permissions, klinks, status
+			registrant_id, name, app_domain, auth_token, permissions, status,
+			valid_from, valid_until, reminder_sent_for, challenge_token, verified_at,
+			description, tags, technical_contact, security_contact, logo_url, environment,
+			peer_id, remote_id
 		) VALUES (
-			:registrant_id, :name, :app_domain, :auth_token, :permissions, :klinks, :status
+			:registrant_id, :name, :app_domain, :auth_token, :permissions, :status,
+			:valid_from, :valid_until, :reminder_sent_for, :challenge_token, :verified_at,
+			:description, :tags, :technical_contact, :security_contact, :logo_url, :environment,
+			:peer_id, :remote_id
 		)`, &row)
 	if err != nil {
 		return err
@@ -71,10 +132,13 @@ func (db Database) CreateApplication(app *klinkregistry.Application) error {
 	if err != nil {
 		return err
 	}
-	row.ID = lastID
-	app = row.toApplication() // replace app with the new row information
+	app.ID = lastID
 
-	return nil
+	if err := db.saveOrigins(app); err != nil {
+		return err
+	}
+
+	return db.saveGrants(app)
 }
 
 // ListApplications returns a list off all applications inside the database
@@ -91,6 +155,13 @@ func (db Database) ListApplications() ([]*klinkregistry.Application, error) {
 		models = append(models, row.toApplication())
 	}
 
+	if err := db.loadGrants(models...); err != nil {
+		return nil, err
+	}
+	if err := db.loadOrigins(models...); err != nil {
+		return nil, err
+	}
+
 	return models, nil
 }
 
@@ -102,7 +173,15 @@ func (db Database) GetApplicationByID(id int64) (*klinkregistry.Application, err
 		`SELECT * FROM application WHERE application_id=?`,
 		id)
 
-	return row.toApplication(), err
+	app := row.toApplication()
+	if err == nil {
+		err = db.loadGrants(app)
+	}
+	if err == nil {
+		err = db.loadOrigins(app)
+	}
+
+	return app, err
 }
 
 // GetApplicationByDomain returns a single application by Domain
@@ -113,7 +192,73 @@ func (db Database) GetApplicationByDomain(domain string) (*klinkregistry.Applica
 		`SELECT * FROM application WHERE app_domain=?`,
 		domain)
 
-	return row.toApplication(), err
+	app := row.toApplication()
+	if err == nil {
+		err = db.loadGrants(app)
+	}
+	if err == nil {
+		err = db.loadOrigins(app)
+	}
+
+	return app, err
+}
+
+// GetApplicationByRemoteID returns a single application imported from a
+// peer, by its ID on the peer
+func (db Database) GetApplicationByRemoteID(peerID, remoteID int64) (*klinkregistry.Application, error) {
+	row := new(ApplicationRow)
+
+	err := db.db.Get(row,
+		`SELECT * FROM application WHERE peer_id=? AND remote_id=?`,
+		peerID, remoteID)
+
+	app := row.toApplication()
+	if err == nil {
+		err = db.loadGrants(app)
+	}
+	if err == nil {
+		err = db.loadOrigins(app)
+	}
+
+	return app, err
+}
+
+// GetApplicationByOrigin returns the application registered for the first
+// of the candidate origins, which are ordered from the most to the least
+// specific match
+func (db Database) GetApplicationByOrigin(candidates []string) (*klinkregistry.Application, error) {
+	if len(candidates) == 0 {
+		return nil, sql.ErrNoRows
+	}
+
+	query, args, err := sqlx.In(`SELECT * FROM application_origin WHERE origin IN (?)`, candidates)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*ApplicationOriginRow
+	if err := db.db.Select(&rows, db.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	for _, candidate := range candidates {
+		for _, row := range rows {
+			if row.Origin == candidate {
+				return db.GetApplicationByID(row.ApplicationID)
+			}
+		}
+	}
+
+	return nil, sql.ErrNoRows
+}
+
+// SetApplicationReminder records that the owner has been reminded about the
+// expiry at validUntil. Nothing is changed if the application has been
+// renewed in the meantime, and other changes are not overwritten.
+func (db Database) SetApplicationReminder(appID, validUntil int64) error {
+	_, err := db.db.Exec(`UPDATE application SET reminder_sent_for=?
+		WHERE application_id=? AND valid_until=?`, validUntil, appID, validUntil)
+	return err
 }
 
 // ReplaceApplication replaces the application inside the dabase, based on
@@ -129,14 +274,28 @@ func (db Database) ReplaceApplication(app *klinkregistry.Application) error {
 		app_domain = :app_domain,
 		auth_token = :auth_token,
 		permissions = :permissions,
-		klinks = :klinks,
-		status = :status
+		status = :status,
+		valid_from = :valid_from,
+		valid_until = :valid_until,
+		reminder_sent_for = :reminder_sent_for,
+		challenge_token = :challenge_token,
+		verified_at = :verified_at,
+		description = :description,
+		tags = :tags,
+		technical_contact = :technical_contact,
+		security_contact = :security_contact,
+		logo_url = :logo_url,
+		environment = :environment
 		WHERE application_id = :application_id`, &row)
 	if err != nil {
 		return err
 	}
 
-	return err
+	if err := db.saveOrigins(app); err != nil {
+		return err
+	}
+
+	return db.saveGrants(app)
 }
 
 // DeleteApplication removes a application entry from the database
@@ -144,3 +303,141 @@ func (db Database) DeleteApplication(id int64) error {
 	_, err := db.db.Exec("DELETE FROM application WHERE application_id=?", id)
 	return err
 }
+
+// loadOrigins populates the additional origins of the applications
+func (db Database) loadOrigins(apps ...*klinkregistry.Application) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*klinkregistry.Application, len(apps))
+	ids := make([]int64, 0, len(apps))
+	for _, app := range apps {
+		app.Origins = []string{}
+		byID[app.ID] = app
+		ids = append(ids, app.ID)
+	}
+
+	query, args, err := sqlx.In(`SELECT * FROM application_origin
+		WHERE application_id IN (?) AND is_primary = 0 ORDER BY origin ASC`, ids)
+	if err != nil {
+		return err
+	}
+
+	var rows []*ApplicationOriginRow
+	if err := db.db.Select(&rows, db.db.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		app := byID[row.ApplicationID]
+		app.Origins = append(app.Origins, row.Origin)
+	}
+
+	return nil
+}
+
+// saveOrigins replaces the origins of the application with the normalised
+// application URL and its additional origins
+func (db Database) saveOrigins(app *klinkregistry.Application) error {
+	if _, err := db.db.Exec("DELETE FROM application_origin WHERE application_id=?", app.ID); err != nil {
+		return err
+	}
+
+	rows := make([]ApplicationOriginRow, 0, len(app.Origins)+1)
+	if primary, err := klinkregistry.NormalizeOrigin(app.URL); err == nil {
+		rows = append(rows, ApplicationOriginRow{Origin: primary, ApplicationID: app.ID, Primary: true})
+	}
+	for _, origin := range app.Origins {
+		if len(rows) > 0 && origin == rows[0].Origin {
+			continue
+		}
+		rows = append(rows, ApplicationOriginRow{Origin: origin, ApplicationID: app.ID})
+	}
+
+	for _, row := range rows {
+		_, err := db.db.NamedExec(`INSERT INTO application_origin (origin, application_id, is_primary)
+			VALUES (:origin, :application_id, :is_primary)`, row)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// loadGrants populates the K-Links the applications may publish to, and the
+// permissions granted inside each of them
+func (db Database) loadGrants(apps ...*klinkregistry.Application) error {
+	if len(apps) == 0 {
+		return nil
+	}
+
+	byID := make(map[int64]*klinkregistry.Application, len(apps))
+	ids := make([]int64, 0, len(apps))
+	for _, app := range apps {
+		byID[app.ID] = app
+		ids = append(ids, app.ID)
+	}
+
+	query, args, err := sqlx.In(`SELECT ak.application_id, k.identifier, ak.permissions
+		FROM application_klink ak JOIN klink k ON k.klink_id = ak.klink_id
+		WHERE ak.application_id IN (?) ORDER BY k.identifier ASC`, ids)
+	if err != nil {
+		return err
+	}
+
+	var rows []*ApplicationKlinkRow
+	if err := db.db.Select(&rows, db.db.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		app := byID[row.ApplicationID]
+		app.AddGrant(row.Identifier, splitList(row.Permissions))
+	}
+
+	return nil
+}
+
+// saveGrants replaces the K-Links the application may publish to, and the
+// permissions granted inside each of them. Unknown identifiers are ignored.
+func (db Database) saveGrants(app *klinkregistry.Application) error {
+	var identifiers []string
+	for _, grant := range app.Grants {
+		if grant.Klink != "" {
+			identifiers = append(identifiers, grant.Klink)
+		}
+	}
+
+	if len(identifiers) == 0 {
+		_, err := db.db.Exec("DELETE FROM application_klink WHERE application_id=?", app.ID)
+		return err
+	}
+
+	query, args, err := sqlx.In(`DELETE FROM application_klink WHERE application_id=?
+		AND klink_id NOT IN (SELECT klink_id FROM klink WHERE identifier IN (?))`,
+		app.ID, identifiers)
+	if err != nil {
+		return err
+	}
+	if _, err := db.db.Exec(db.db.Rebind(query), args...); err != nil {
+		return err
+	}
+
+	for _, grant := range app.Grants {
+		if grant.Klink == "" {
+			continue
+		}
+
+		_, err := db.db.Exec(`INSERT INTO application_klink (application_id, klink_id, permissions)
+			SELECT ?, klink_id, ? FROM klink WHERE identifier=?
+			ON DUPLICATE KEY UPDATE permissions=VALUES(permissions)`,
+			app.ID, strings.Join(grant.Permissions, ","), grant.Klink)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,26 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateAuditEntry adds a new entry to the audit log
+func (db Database) CreateAuditEntry(entry *klinkregistry.AuditEntry) error {
+	res, err := db.db.NamedExec(`INSERT INTO audit_log (
+			created_at, action, actor_id, application_id, outcome, reason, detail
+		) VALUES (
+			:created_at, :action, :actor_id, :application_id, :outcome, :reason, :detail
+		)`, entry)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = lastID
+
+	return nil
+}
@@ -0,0 +1,41 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateChange records the change of a local record inside the database
+func (db Database) CreateChange(c *klinkregistry.Change) error {
+	res, err := db.db.NamedExec(`INSERT INTO change_log (
+			kind, record_id, created_at
+		) VALUES (
+			:kind, :record_id, :created_at
+		)`, c)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+
+	return nil
+}
+
+// ListChangesSince returns the changes after the given change ID, oldest
+// first
+func (db Database) ListChangesSince(id int64, limit int) ([]*klinkregistry.Change, error) {
+	var models []*klinkregistry.Change
+
+	err := db.db.Select(&models,
+		`SELECT * FROM change_log WHERE change_id>? ORDER BY change_id ASC LIMIT ?`,
+		id, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
@@ -0,0 +1,57 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateEvent persists an event of the event stream inside the database
+func (db Database) CreateEvent(e *klinkregistry.EventRecord) error {
+	res, err := db.db.NamedExec(`INSERT INTO event_log (
+			event_id, event_type, subject_id, payload, created_at
+		) VALUES (
+			:event_id, :event_type, :subject_id, :payload, :created_at
+		)`, e)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.Seq = lastID
+
+	return nil
+}
+
+// ListEventsSince returns the events after the given sequence number, oldest
+// first
+func (db Database) ListEventsSince(seq int64, limit int) ([]*klinkregistry.EventRecord, error) {
+	var models []*klinkregistry.EventRecord
+
+	err := db.db.Select(&models,
+		`SELECT * FROM event_log WHERE event_seq>? ORDER BY event_seq ASC LIMIT ?`,
+		seq, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// GetLastEventSeq returns the sequence number of the latest event, or 0 if
+// there is none
+func (db Database) GetLastEventSeq() (int64, error) {
+	var seq int64
+
+	err := db.db.Get(&seq, `SELECT COALESCE(MAX(event_seq), 0) FROM event_log`)
+
+	return seq, err
+}
+
+// DeleteEventsBefore removes the events created before the given time
+func (db Database) DeleteEventsBefore(createdAt int64) error {
+	_, err := db.db.Exec("DELETE FROM event_log WHERE created_at<?", createdAt)
+	return err
+}
@@ -0,0 +1,49 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateHealthCheck adds the result of a health check inside the database
+func (db Database) CreateHealthCheck(c *klinkregistry.HealthCheck) error {
+	res, err := db.db.NamedExec(`INSERT INTO klink_health_check (
+			klink_id, checked_at, status, status_code, latency, error
+		) VALUES (
+			:klink_id, :checked_at, :status, :status_code, :latency, :error
+		)`, c)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = lastID
+
+	return nil
+}
+
+// ListHealthChecks returns the latest health checks of a klink, newest
+// first
+func (db Database) ListHealthChecks(klinkID int64, limit int) ([]*klinkregistry.HealthCheck, error) {
+	var models []*klinkregistry.HealthCheck
+
+	err := db.db.Select(&models,
+		`SELECT * FROM klink_health_check WHERE klink_id=?
+		ORDER BY health_check_id DESC LIMIT ?`,
+		klinkID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// DeleteHealthChecksBefore removes all health checks that are older than
+// checkedAt
+func (db Database) DeleteHealthChecksBefore(checkedAt int64) error {
+	_, err := db.db.Exec("DELETE FROM klink_health_check WHERE checked_at<?", checkedAt)
+	return err
+}
@@ -0,0 +1,78 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateJoinRequest adds a new join request inside the database
+func (db Database) CreateJoinRequest(r *klinkregistry.JoinRequest) error {
+	res, err := db.db.NamedExec(`INSERT INTO join_request (
+			klink_id, registrant_id, justification, status, reason,
+			decided_by, created_at, decided_at
+		) VALUES (
+			:klink_id, :registrant_id, :justification, :status, :reason,
+			:decided_by, :created_at, :decided_at
+		)`, r)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	r.ID = lastID
+
+	return nil
+}
+
+func (db Database) selectJoinRequests(query string, args ...interface{}) ([]*klinkregistry.JoinRequest, error) {
+	var models []*klinkregistry.JoinRequest
+
+	err := db.db.Select(&models, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// ListJoinRequestsByKlink returns all join requests for a klink, newest
+// first
+func (db Database) ListJoinRequestsByKlink(klinkID int64) ([]*klinkregistry.JoinRequest, error) {
+	return db.selectJoinRequests(
+		`SELECT * FROM join_request WHERE klink_id=? ORDER BY join_request_id DESC`,
+		klinkID)
+}
+
+// ListJoinRequestsByRegistrant returns all join requests of a registrant,
+// newest first
+func (db Database) ListJoinRequestsByRegistrant(registrantID int64) ([]*klinkregistry.JoinRequest, error) {
+	return db.selectJoinRequests(
+		`SELECT * FROM join_request WHERE registrant_id=? ORDER BY join_request_id DESC`,
+		registrantID)
+}
+
+// GetJoinRequestByID returns a single join request by ID
+func (db Database) GetJoinRequestByID(id int64) (*klinkregistry.JoinRequest, error) {
+	r := new(klinkregistry.JoinRequest)
+
+	err := db.db.Get(r,
+		`SELECT * FROM join_request WHERE join_request_id=?`,
+		id)
+
+	return r, err
+}
+
+// UpdateJoinRequest stores the decision about a join request
+func (db Database) UpdateJoinRequest(r *klinkregistry.JoinRequest) error {
+	_, err := db.db.NamedExec(`UPDATE join_request SET
+		status = :status,
+		reason = :reason,
+		decided_by = :decided_by,
+		decided_at = :decided_at
+		WHERE join_request_id = :join_request_id`, r)
+
+	return err
+}
@@ -1,8 +1,7 @@
 package mysql
 
 import (
-	"log"
-
+	"github.com/jmoiron/sqlx"
 	klinkregistry "github.com/k-box/k-link-registry"
 )
 
@@ -15,6 +14,11 @@ type KlinkRow struct {
 	Website     string `db:"website"`
 	Description string `db:"description"`
 	Active      bool   `db:"active"`
+	HealthURL   string `db:"health_url"`
+	Health      string `db:"health_status"`
+	CheckedAt   int64  `db:"health_checked_at"`
+	PeerID      int64  `db:"peer_id"`
+	RemoteID    int64  `db:"remote_id"`
 }
 
 func (row *KlinkRow) fromKlink(klink *klinkregistry.Klink) *KlinkRow {
@@ -29,6 +33,11 @@ func (row *KlinkRow) fromKlink(klink *klinkregistry.Klink) *KlinkRow {
 	row.Website = klink.Website
 	row.Description = klink.Description
 	row.Active = klink.Active
+	row.HealthURL = klink.HealthURL
+	row.Health = klink.HealthStatus
+	row.CheckedAt = klink.HealthCheckedAt
+	row.PeerID = klink.PeerID
+	row.RemoteID = klink.RemoteID
 
 	return row
 }
@@ -47,6 +56,11 @@ func (row *KlinkRow) toKlink() *klinkregistry.Klink {
 	app.Website = row.Website
 	app.Description = row.Description
 	app.Active = row.Active
+	app.HealthURL = row.HealthURL
+	app.HealthStatus = row.Health
+	app.HealthCheckedAt = row.CheckedAt
+	app.PeerID = row.PeerID
+	app.RemoteID = row.RemoteID
 	return app
 }
 
@@ -57,9 +71,11 @@ func (db Database) CreateKlink(app *klinkregistry.Klink) error {
 	row.fromKlink(app)
 
 	res, err := db.db.NamedExec(`INSERT INTO klink (
-			identifier, manager_id, name, website, description, active
+			identifier, manager_id, name, website, description, active,
+			health_url, peer_id, remote_id
 		) VALUES (
-			:identifier, :manager_id, :name, :website, :description,  :active
+			:identifier, :manager_id, :name, :website, :description,  :active,
+			:health_url, :peer_id, :remote_id
 		)`, &row)
 	if err != nil {
 		return err
@@ -70,8 +86,7 @@ func (db Database) CreateKlink(app *klinkregistry.Klink) error {
 	if err != nil {
 		return err
 	}
-	row.ID = lastID
-	app = row.toKlink() // replace app with the new row information
+	app.ID = lastID
 
 	return nil
 }
@@ -115,6 +130,43 @@ func (db Database) GetKlinkByIdentifier(id string) (*klinkregistry.Klink, error)
 	return row.toKlink(), err
 }
 
+// ListKlinksByIdentifier returns the klinks with the given public
+// identifiers in a single query. Unknown identifiers are skipped.
+func (db Database) ListKlinksByIdentifier(identifiers []string) ([]*klinkregistry.Klink, error) {
+	if len(identifiers) == 0 {
+		return nil, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT * FROM klink WHERE identifier IN (?) ORDER BY klink_id ASC`, identifiers)
+	if err != nil {
+		return nil, err
+	}
+
+	var rows []*KlinkRow
+	if err := db.db.Select(&rows, db.db.Rebind(query), args...); err != nil {
+		return nil, err
+	}
+
+	var models []*klinkregistry.Klink
+	for _, row := range rows {
+		models = append(models, row.toKlink())
+	}
+
+	return models, nil
+}
+
+// GetKlinkByRemoteID returns a single klink imported from a peer, by its ID
+// on the peer
+func (db Database) GetKlinkByRemoteID(peerID, remoteID int64) (*klinkregistry.Klink, error) {
+	row := new(KlinkRow)
+
+	err := db.db.Get(row,
+		`SELECT * FROM klink WHERE peer_id=? AND remote_id=?`,
+		peerID, remoteID)
+
+	return row.toKlink(), err
+}
+
 // UpdateKlink update the klink inside the dabase, based on
 // the ID attribute
 func (db Database) UpdateKlink(app *klinkregistry.Klink) error {
@@ -127,18 +179,46 @@ func (db Database) UpdateKlink(app *klinkregistry.Klink) error {
 		name = :name,
 		website = :website,
 		description = :description,
-		active = :active
+		active = :active,
+		health_url = :health_url
 		WHERE identifier = :identifier`, &row)
-	if err != nil {
-		log.Println(err)
-		return err
-	}
+	return err
+}
 
+// SetKlinkHealth stores the result of the latest health check of a klink.
+// It is kept apart from UpdateKlink, so that the prober and the managers do
+// not overwrite each others changes.
+func (db Database) SetKlinkHealth(klinkID int64, status string, checkedAt int64) error {
+	_, err := db.db.Exec(`UPDATE klink SET health_status=?, health_checked_at=?
+		WHERE klink_id=?`, status, checkedAt, klinkID)
 	return err
 }
 
 // DeleteKlink removes a klink entry from the database
 func (db Database) DeleteKlink(id int64) error {
-	_, err := db.db.Exec("DELETE FROM klink WHERE identifier=?", id)
+	_, err := db.db.Exec("DELETE FROM klink WHERE klink_id=?", id)
 	return err
 }
+
+// CountKlinkApplications returns the number of active applications that
+// publish to each klink, by klink ID
+func (db Database) CountKlinkApplications() (map[int64]int, error) {
+	var rows []struct {
+		KlinkID int64 `db:"klink_id"`
+		Count   int   `db:"applications"`
+	}
+
+	err := db.db.Select(&rows, `SELECT ak.klink_id, COUNT(*) AS applications
+		FROM application_klink ak JOIN application a ON a.application_id = ak.application_id
+		WHERE a.status = 1 GROUP BY ak.klink_id`)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[int64]int, len(rows))
+	for _, row := range rows {
+		counts[row.KlinkID] = row.Count
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,63 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// ListKlinkMembers returns all members of a klink
+func (db Database) ListKlinkMembers(klinkID int64) ([]*klinkregistry.KlinkMember, error) {
+	var models []*klinkregistry.KlinkMember
+
+	err := db.db.Select(&models,
+		`SELECT klink_id, registrant_id, role FROM klink_member WHERE klink_id=? ORDER BY registrant_id ASC`,
+		klinkID)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// ListKlinkMembershipsByRegistrant returns all klink memberships of a
+// registrant
+func (db Database) ListKlinkMembershipsByRegistrant(registrantID int64) ([]*klinkregistry.KlinkMember, error) {
+	var models []*klinkregistry.KlinkMember
+
+	err := db.db.Select(&models,
+		`SELECT klink_id, registrant_id, role FROM klink_member WHERE registrant_id=? ORDER BY klink_id ASC`,
+		registrantID)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// GetKlinkMember returns the membership of a registrant inside a klink
+func (db Database) GetKlinkMember(klinkID, registrantID int64) (*klinkregistry.KlinkMember, error) {
+	var model klinkregistry.KlinkMember
+
+	err := db.db.Get(&model,
+		`SELECT klink_id, registrant_id, role FROM klink_member WHERE klink_id=? AND registrant_id=?`,
+		klinkID, registrantID)
+
+	return &model, err
+}
+
+// SaveKlinkMember adds a registrant to a klink, or changes the role of an
+// existing member
+func (db Database) SaveKlinkMember(m *klinkregistry.KlinkMember) error {
+	_, err := db.db.NamedExec(`INSERT INTO klink_member (
+			klink_id, registrant_id, role
+		) VALUES (
+			:klink_id, :registrant_id, :role
+		) ON DUPLICATE KEY UPDATE role = VALUES(role)`, m)
+
+	return err
+}
+
+// DeleteKlinkMember removes a registrant from a klink
+func (db Database) DeleteKlinkMember(klinkID, registrantID int64) error {
+	_, err := db.db.Exec("DELETE FROM klink_member WHERE klink_id=? AND registrant_id=?", klinkID, registrantID)
+	return err
+}
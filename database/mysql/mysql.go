@@ -2,10 +2,11 @@ package mysql
 
 import (
 	"database/sql"
-	"log"
+	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"github.com/sirupsen/logrus"
 
 	// MySQL database driver
 	_ "github.com/go-sql-driver/mysql"
@@ -13,14 +14,15 @@ import (
 
 // Database is a MySQL Database
 type Database struct {
-	db *sqlx.DB
+	db *observedDB
 }
 
-// NewDatabase returns a new MySQL database
-func NewDatabase(dsn string) (*Database, error) {
+// NewDatabase returns a new MySQL database. Attempts to reach the database
+// host are logged to logger.
+func NewDatabase(dsn string, logger logrus.FieldLogger) (*Database, error) {
 	db, err := sqlx.Open("mysql", dsn)
 
-	err = PingWithRetry(*db, 5)
+	err = PingWithRetry(*db, 5, logger)
 
 	if err != nil {
 		db.Close()
@@ -30,7 +32,13 @@ func NewDatabase(dsn string) (*Database, error) {
 	// Solve the problem of silently dying idle connections
 	db.SetConnMaxLifetime(time.Second)
 
-	return &Database{db: db}, err
+	return &Database{db: &observedDB{DB: db}}, err
+}
+
+// SetQueryObserver sets a function that is called after every query, e.g. to
+// record its duration
+func (db Database) SetQueryObserver(observer QueryObserver) {
+	db.db.observer = observer
 }
 
 // EmailVerificationRow represents an email verification inside the
@@ -50,9 +58,13 @@ type PasswordChangeVerificationRow struct {
 	Timestamp    int64
 }
 
-// PermissionRow represents a Permission inside the database
-type PermissionRow struct {
-	Name string
+// splitList splits a comma separated list, as it is used for simple arrays
+// inside the database. An empty string results in an empty list.
+func splitList(s string) []string {
+	if s == "" {
+		return []string{}
+	}
+	return strings.Split(s, ",")
 }
 
 // IsNotFound returns true, if the error is simply due to no entries being
@@ -61,8 +73,24 @@ func (db Database) IsNotFound(err error) bool {
 	return err == sql.ErrNoRows
 }
 
+// Ping checks that the database is reachable
+func (db Database) Ping() error {
+	return db.db.Ping()
+}
+
+// GetSchemaVersion returns the revision of the last migration, and whether it
+// failed
+func (db Database) GetSchemaVersion() (int64, bool, error) {
+	var row struct {
+		Version int64 `db:"version"`
+		Dirty   bool  `db:"dirty"`
+	}
+	err := db.db.Get(&row, "SELECT version, dirty FROM schema_migrations LIMIT 1")
+	return row.Version, row.Dirty, err
+}
+
 // PingWithRetry tries to Ping the connection for a predefined number of attempts before failing
-func PingWithRetry(db sqlx.DB, attempts int) error {
+func PingWithRetry(db sqlx.DB, attempts int, logger logrus.FieldLogger) error {
 	var err error
 	err = nil
 
@@ -73,7 +101,7 @@ func PingWithRetry(db sqlx.DB, attempts int) error {
 			return nil
 		}
 
-		log.Println("Trying again to contact the database host...")
+		logger.WithError(err).Warn("Trying again to contact the database host...")
 		time.Sleep(time.Duration(index+1) * time.Second)
 	}
 
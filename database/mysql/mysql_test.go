@@ -3,10 +3,12 @@ package mysql
 import (
 	"fmt"
 	"testing"
+
+	"github.com/sirupsen/logrus"
 )
 
 func TestDatabase(t *testing.T) {
-	db, err := NewDatabase("kregistry:kregistry@tcp(127.0.0.1)/kregistry")
+	db, err := NewDatabase("kregistry:kregistry@tcp(127.0.0.1)/kregistry", logrus.New())
 	if err != nil {
 		panic(err)
 	}
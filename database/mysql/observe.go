@@ -0,0 +1,75 @@
+package mysql
+
+import (
+	"database/sql"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// QueryObserver is called after every query with the name of the Database
+// method that ran it, the duration and the error of the query
+type QueryObserver func(method string, duration time.Duration, err error)
+
+// observedDB passes the queries of a Database to the QueryObserver
+type observedDB struct {
+	*sqlx.DB
+	observer QueryObserver
+}
+
+func (db *observedDB) observe(start time.Time, err error) {
+	if db.observer == nil {
+		return
+	}
+	db.observer(databaseMethod(), time.Since(start), err)
+}
+
+// databaseMethod returns the name of the Database method on the call stack
+func databaseMethod() string {
+	pc := make([]uintptr, 8)
+	frames := runtime.CallersFrames(pc[:runtime.Callers(3, pc)])
+
+	for {
+		frame, more := frames.Next()
+		if i := strings.Index(frame.Function, ".Database."); i >= 0 {
+			return frame.Function[i+len(".Database."):]
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// Get runs a query that returns a single row
+func (db *observedDB) Get(dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := db.DB.Get(dest, query, args...)
+	db.observe(start, err)
+	return err
+}
+
+// Select runs a query that returns rows
+func (db *observedDB) Select(dest interface{}, query string, args ...interface{}) error {
+	start := time.Now()
+	err := db.DB.Select(dest, query, args...)
+	db.observe(start, err)
+	return err
+}
+
+// Exec runs a statement
+func (db *observedDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.Exec(query, args...)
+	db.observe(start, err)
+	return res, err
+}
+
+// NamedExec runs a statement with named arguments
+func (db *observedDB) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	start := time.Now()
+	res, err := db.DB.NamedExec(query, arg)
+	db.observe(start, err)
+	return res, err
+}
@@ -0,0 +1,64 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateOwnershipTransfer adds a new ownership transfer inside the database
+func (db Database) CreateOwnershipTransfer(t *klinkregistry.OwnershipTransfer) error {
+	res, err := db.db.NamedExec(`INSERT INTO ownership_transfer (
+			application_id, from_id, to_id, token, status, requested_by,
+			created_at, decided_at
+		) VALUES (
+			:application_id, :from_id, :to_id, :token, :status, :requested_by,
+			:created_at, :decided_at
+		)`, t)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	t.ID = lastID
+
+	return nil
+}
+
+// ListOwnershipTransfersByApplication returns all ownership transfers of an
+// application, newest first
+func (db Database) ListOwnershipTransfersByApplication(applicationID int64) ([]*klinkregistry.OwnershipTransfer, error) {
+	var models []*klinkregistry.OwnershipTransfer
+
+	err := db.db.Select(&models,
+		`SELECT * FROM ownership_transfer WHERE application_id=? ORDER BY transfer_id DESC`,
+		applicationID)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// GetOwnershipTransferByToken returns a single ownership transfer by token
+func (db Database) GetOwnershipTransferByToken(token string) (*klinkregistry.OwnershipTransfer, error) {
+	t := new(klinkregistry.OwnershipTransfer)
+
+	err := db.db.Get(t,
+		`SELECT * FROM ownership_transfer WHERE token=?`,
+		token)
+
+	return t, err
+}
+
+// UpdateOwnershipTransfer stores the decision about an ownership transfer
+func (db Database) UpdateOwnershipTransfer(t *klinkregistry.OwnershipTransfer) error {
+	_, err := db.db.NamedExec(`UPDATE ownership_transfer SET
+		status = :status,
+		decided_at = :decided_at
+		WHERE transfer_id = :transfer_id`, t)
+
+	return err
+}
@@ -0,0 +1,87 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreatePeer adds a new peer registry inside the database
+func (db Database) CreatePeer(p *klinkregistry.Peer) error {
+	res, err := db.db.NamedExec(`INSERT INTO peer (
+			name, url, peer_key, secret, registrant_id, active,
+			sync_cursor, last_sync_at, last_error
+		) VALUES (
+			:name, :url, :peer_key, :secret, :registrant_id, :active,
+			:sync_cursor, :last_sync_at, :last_error
+		)`, p)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	p.ID = lastID
+
+	return nil
+}
+
+// ListPeers returns a list of all peer registries inside the database
+func (db Database) ListPeers() ([]*klinkregistry.Peer, error) {
+	var models []*klinkregistry.Peer
+
+	err := db.db.Select(&models, "SELECT * FROM peer ORDER BY peer_id ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// GetPeerByID returns a single peer registry by ID
+func (db Database) GetPeerByID(id int64) (*klinkregistry.Peer, error) {
+	p := new(klinkregistry.Peer)
+
+	err := db.db.Get(p, `SELECT * FROM peer WHERE peer_id=?`, id)
+
+	return p, err
+}
+
+// GetPeerByKey returns a single peer registry by its key
+func (db Database) GetPeerByKey(key string) (*klinkregistry.Peer, error) {
+	p := new(klinkregistry.Peer)
+
+	err := db.db.Get(p, `SELECT * FROM peer WHERE peer_key=?`, key)
+
+	return p, err
+}
+
+// UpdatePeer updates the peer registry inside the database, based on the ID
+// attribute
+func (db Database) UpdatePeer(p *klinkregistry.Peer) error {
+	_, err := db.db.NamedExec(`UPDATE peer SET
+		name = :name,
+		url = :url,
+		active = :active,
+		sync_cursor = :sync_cursor,
+		last_sync_at = :last_sync_at,
+		last_error = :last_error
+		WHERE peer_id = :peer_id`, p)
+
+	return err
+}
+
+// DeletePeer removes a peer registry and the applications and klinks
+// imported from it
+func (db Database) DeletePeer(id int64) error {
+	if _, err := db.db.Exec("DELETE FROM application WHERE peer_id=?", id); err != nil {
+		return err
+	}
+	if _, err := db.db.Exec("DELETE FROM klink WHERE peer_id=?", id); err != nil {
+		return err
+	}
+
+	_, err := db.db.Exec("DELETE FROM peer WHERE peer_id=?", id)
+	return err
+}
@@ -1,29 +1,118 @@
 package mysql
 
-import "github.com/k-box/k-link-registry"
+import (
+	"strings"
+
+	"github.com/k-box/k-link-registry"
+)
+
+// PermissionRow represents a Permission inside the database
+type PermissionRow struct {
+	Name        string `db:"name"`
+	Description string `db:"description"`
+	Implies     string `db:"implies"`
+	Deprecated  bool   `db:"deprecated"`
+}
+
+func (row *PermissionRow) fromPermission(p *klinkregistry.Permission) {
+	if p == nil {
+		return
+	}
+
+	row.Name = p.Name
+	row.Description = p.Description
+	row.Implies = strings.Join(p.Implies, ",")
+	row.Deprecated = p.Deprecated
+}
+
+func (row *PermissionRow) toPermission() *klinkregistry.Permission {
+	if row == nil {
+		return nil
+	}
+
+	p := new(klinkregistry.Permission)
+
+	p.Name = row.Name
+	p.Description = row.Description
+	p.Implies = splitList(row.Implies)
+	p.Deprecated = row.Deprecated
+	return p
+}
 
 // ListPermissions returns a list off all permissions inside the database
 func (db Database) ListPermissions() ([]*klinkregistry.Permission, error) {
-	var models []*klinkregistry.Permission
+	var rows []*PermissionRow
 
-	err := db.db.Select(&models, "SELECT * FROM permission ORDER BY name")
+	err := db.db.Select(&rows, "SELECT * FROM permission ORDER BY name")
 	if err != nil {
 		return nil, err
 	}
 
+	var models []*klinkregistry.Permission
+	for _, row := range rows {
+		models = append(models, row.toPermission())
+	}
+
 	return models, nil
 }
 
+// GetPermission returns a single permission by name
+func (db Database) GetPermission(name string) (*klinkregistry.Permission, error) {
+	row := new(PermissionRow)
+
+	err := db.db.Get(row, "SELECT * FROM permission WHERE name=?", name)
+
+	return row.toPermission(), err
+}
+
 // CreatePermission adds a new Permission inside the database
 func (db Database) CreatePermission(p *klinkregistry.Permission) error {
+	var row PermissionRow
+
+	row.fromPermission(p)
+
 	_, err := db.db.NamedExec(`INSERT INTO permission (
-		name
+		name, description, implies, deprecated
 	) VALUES (
-		:name
-	)`, &p)
+		:name, :description, :implies, :deprecated
+	)`, &row)
 
 	if err != nil {
 		return err
 	}
 	return nil
 }
+
+// UpdatePermission replaces the description, implied permissions and
+// deprecation flag of the permission, based on the name attribute
+func (db Database) UpdatePermission(p *klinkregistry.Permission) error {
+	var row PermissionRow
+
+	row.fromPermission(p)
+
+	_, err := db.db.NamedExec(`UPDATE permission SET
+		description = :description,
+		implies = :implies,
+		deprecated = :deprecated
+		WHERE name = :name`, &row)
+	return err
+}
+
+// DeletePermission removes a permission entry from the database
+func (db Database) DeletePermission(name string) error {
+	_, err := db.db.Exec("DELETE FROM permission WHERE name=?", name)
+	return err
+}
+
+// CountPermissionGrants returns the number of application and K-Link grants
+// that contain the permission
+func (db Database) CountPermissionGrants(name string) (int, error) {
+	var count int
+
+	err := db.db.Get(&count, `SELECT
+		(SELECT COUNT(*) FROM application WHERE FIND_IN_SET(?, permissions) > 0) +
+		(SELECT COUNT(*) FROM application_klink WHERE FIND_IN_SET(?, permissions) > 0)`,
+		name, name)
+
+	return count, err
+}
@@ -73,6 +73,13 @@ func (db Database) ReplaceRegistrant(r *klinkregistry.Registrant) error {
 	return err
 }
 
+// SetRegistrantLastLogin stores the time of the latest login of a
+// registrant, without overwriting other changes
+func (db Database) SetRegistrantLastLogin(id, lastLogin int64) error {
+	_, err := db.db.Exec("UPDATE registrant SET last_login=? WHERE registrant_id=?", lastLogin, id)
+	return err
+}
+
 // DeleteRegistrant removes a registrant entry from the database
 func (db Database) DeleteRegistrant(id int64) error {
 	_, err := db.db.Exec("DELETE FROM registrant WHERE registrant_id=?", id)
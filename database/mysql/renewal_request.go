@@ -0,0 +1,77 @@
+package mysql
+
+import (
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// CreateRenewalRequest adds a new renewal request inside the database
+func (db Database) CreateRenewalRequest(r *klinkregistry.RenewalRequest) error {
+	res, err := db.db.NamedExec(`INSERT INTO renewal_request (
+			application_id, valid_until, justification, status, reason,
+			requested_by, decided_by, created_at, decided_at
+		) VALUES (
+			:application_id, :valid_until, :justification, :status, :reason,
+			:requested_by, :decided_by, :created_at, :decided_at
+		)`, r)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	r.ID = lastID
+
+	return nil
+}
+
+func (db Database) selectRenewalRequests(query string, args ...interface{}) ([]*klinkregistry.RenewalRequest, error) {
+	var models []*klinkregistry.RenewalRequest
+
+	err := db.db.Select(&models, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// ListRenewalRequests returns all renewal requests, newest first
+func (db Database) ListRenewalRequests() ([]*klinkregistry.RenewalRequest, error) {
+	return db.selectRenewalRequests(
+		`SELECT * FROM renewal_request ORDER BY renewal_request_id DESC`)
+}
+
+// ListRenewalRequestsByApplication returns all renewal requests of an
+// application, newest first
+func (db Database) ListRenewalRequestsByApplication(applicationID int64) ([]*klinkregistry.RenewalRequest, error) {
+	return db.selectRenewalRequests(
+		`SELECT * FROM renewal_request WHERE application_id=? ORDER BY renewal_request_id DESC`,
+		applicationID)
+}
+
+// GetRenewalRequestByID returns a single renewal request by ID
+func (db Database) GetRenewalRequestByID(id int64) (*klinkregistry.RenewalRequest, error) {
+	r := new(klinkregistry.RenewalRequest)
+
+	err := db.db.Get(r,
+		`SELECT * FROM renewal_request WHERE renewal_request_id=?`,
+		id)
+
+	return r, err
+}
+
+// UpdateRenewalRequest stores the decision about a renewal request
+func (db Database) UpdateRenewalRequest(r *klinkregistry.RenewalRequest) error {
+	_, err := db.db.NamedExec(`UPDATE renewal_request SET
+		valid_until = :valid_until,
+		status = :status,
+		reason = :reason,
+		decided_by = :decided_by,
+		decided_at = :decided_at
+		WHERE renewal_request_id = :renewal_request_id`, r)
+
+	return err
+}
@@ -0,0 +1,199 @@
+package mysql
+
+import (
+	"strings"
+
+	klinkregistry "github.com/k-box/k-link-registry"
+)
+
+// WebhookRow represents a Webhook inside the database
+type WebhookRow struct {
+	ID        int64  `db:"webhook_id"`
+	URL       string `db:"url"`
+	Secret    string `db:"secret"`
+	Events    string `db:"events"`
+	Active    bool   `db:"active"`
+	CreatedBy int64  `db:"created_by"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+func (row *WebhookRow) fromWebhook(w *klinkregistry.Webhook) {
+	if w == nil {
+		return
+	}
+
+	row.ID = w.ID
+	row.URL = w.URL
+	row.Secret = w.Secret
+	row.Events = strings.Join(w.Events, ",")
+	row.Active = w.Active
+	row.CreatedBy = w.CreatedBy
+	row.CreatedAt = w.CreatedAt
+}
+
+func (row *WebhookRow) toWebhook() *klinkregistry.Webhook {
+	if row == nil {
+		return nil
+	}
+
+	w := new(klinkregistry.Webhook)
+
+	w.ID = row.ID
+	w.URL = row.URL
+	w.Secret = row.Secret
+	w.Events = splitList(row.Events)
+	w.Active = row.Active
+	w.CreatedBy = row.CreatedBy
+	w.CreatedAt = row.CreatedAt
+	return w
+}
+
+// CreateWebhook adds a new webhook inside the database
+func (db Database) CreateWebhook(w *klinkregistry.Webhook) error {
+	var row WebhookRow
+
+	row.fromWebhook(w)
+
+	res, err := db.db.NamedExec(`INSERT INTO webhook (
+			url, secret, events, active, created_by, created_at
+		) VALUES (
+			:url, :secret, :events, :active, :created_by, :created_at
+		)`, &row)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	w.ID = lastID
+
+	return nil
+}
+
+// ListWebhooks returns a list of all webhooks inside the database
+func (db Database) ListWebhooks() ([]*klinkregistry.Webhook, error) {
+	var rows []*WebhookRow
+
+	err := db.db.Select(&rows, "SELECT * FROM webhook ORDER BY webhook_id ASC")
+	if err != nil {
+		return nil, err
+	}
+
+	var models []*klinkregistry.Webhook
+	for _, row := range rows {
+		models = append(models, row.toWebhook())
+	}
+
+	return models, nil
+}
+
+// GetWebhookByID returns a single webhook by ID
+func (db Database) GetWebhookByID(id int64) (*klinkregistry.Webhook, error) {
+	row := new(WebhookRow)
+
+	err := db.db.Get(row, `SELECT * FROM webhook WHERE webhook_id=?`, id)
+
+	return row.toWebhook(), err
+}
+
+// UpdateWebhook updates the webhook inside the database, based on the ID
+// attribute
+func (db Database) UpdateWebhook(w *klinkregistry.Webhook) error {
+	var row WebhookRow
+
+	row.fromWebhook(w)
+
+	_, err := db.db.NamedExec(`UPDATE webhook SET
+		url = :url,
+		secret = :secret,
+		events = :events,
+		active = :active
+		WHERE webhook_id = :webhook_id`, &row)
+
+	return err
+}
+
+// DeleteWebhook removes a webhook together with its deliveries
+func (db Database) DeleteWebhook(id int64) error {
+	_, err := db.db.Exec("DELETE FROM webhook WHERE webhook_id=?", id)
+	return err
+}
+
+// CreateWebhookDelivery adds a new webhook delivery inside the database
+func (db Database) CreateWebhookDelivery(d *klinkregistry.WebhookDelivery) error {
+	res, err := db.db.NamedExec(`INSERT INTO webhook_delivery (
+			webhook_id, event_id, event_type, payload, status, attempts,
+			status_code, error, created_at, next_attempt_at, delivered_at
+		) VALUES (
+			:webhook_id, :event_id, :event_type, :payload, :status, :attempts,
+			:status_code, :error, :created_at, :next_attempt_at, :delivered_at
+		)`, d)
+	if err != nil {
+		return err
+	}
+
+	// Set auto incremented ID
+	lastID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	d.ID = lastID
+
+	return nil
+}
+
+// ListWebhookDeliveries returns the latest deliveries of a webhook, newest
+// first
+func (db Database) ListWebhookDeliveries(webhookID int64, limit int) ([]*klinkregistry.WebhookDelivery, error) {
+	var models []*klinkregistry.WebhookDelivery
+
+	err := db.db.Select(&models,
+		`SELECT * FROM webhook_delivery WHERE webhook_id=? ORDER BY delivery_id DESC LIMIT ?`,
+		webhookID, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// ListDueWebhookDeliveries returns the pending deliveries whose next attempt
+// is due, oldest first
+func (db Database) ListDueWebhookDeliveries(now int64, limit int) ([]*klinkregistry.WebhookDelivery, error) {
+	var models []*klinkregistry.WebhookDelivery
+
+	err := db.db.Select(&models,
+		`SELECT * FROM webhook_delivery WHERE status=? AND next_attempt_at<=? ORDER BY delivery_id ASC LIMIT ?`,
+		klinkregistry.DeliveryPending, now, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return models, nil
+}
+
+// GetWebhookDeliveryByID returns a single webhook delivery by ID
+func (db Database) GetWebhookDeliveryByID(id int64) (*klinkregistry.WebhookDelivery, error) {
+	d := new(klinkregistry.WebhookDelivery)
+
+	err := db.db.Get(d, `SELECT * FROM webhook_delivery WHERE delivery_id=?`, id)
+
+	return d, err
+}
+
+// UpdateWebhookDelivery stores the outcome of a delivery attempt
+func (db Database) UpdateWebhookDelivery(d *klinkregistry.WebhookDelivery) error {
+	_, err := db.db.NamedExec(`UPDATE webhook_delivery SET
+		status = :status,
+		attempts = :attempts,
+		status_code = :status_code,
+		error = :error,
+		next_attempt_at = :next_attempt_at,
+		delivered_at = :delivered_at
+		WHERE delivery_id = :delivery_id`, d)
+
+	return err
+}
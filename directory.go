@@ -0,0 +1,162 @@
+package klinkregistry
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// directoryMaxAge is the time clients and proxies may cache the directory
+const directoryMaxAge = 5 * time.Minute
+
+// DirectoryEntry contains the public information about an active K-Link
+type DirectoryEntry struct {
+	Identifier   string `json:"id"`
+	Name         string `json:"name"`
+	Website      string `json:"website"`
+	Description  string `json:"description"`
+	Applications int    `json:"applications"`
+	Health       string `json:"health"`
+}
+
+// Directory lists the active K-Links of the network, so that people can
+// discover the networks they may join
+type Directory struct {
+	Network string           `json:"network"`
+	Klinks  []DirectoryEntry `json:"klinks"`
+}
+
+// directory returns the active K-Links with the number of active
+// applications that publish to them
+func (s *Server) directory() (*Directory, error) {
+	directory := &Directory{Network: s.config.NetworkName, Klinks: []DirectoryEntry{}}
+
+	klinks, err := s.store.ListKlinks()
+	if s.store.IsNotFound(err) {
+		return directory, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	counts, err := s.store.CountKlinkApplications()
+	if err != nil && !s.store.IsNotFound(err) {
+		return nil, err
+	}
+
+	for _, klink := range klinks {
+		if !klink.Active {
+			continue
+		}
+
+		directory.Klinks = append(directory.Klinks, DirectoryEntry{
+			Identifier:   klink.Identifier,
+			Name:         klink.Name,
+			Website:      klink.Website,
+			Description:  klink.Description,
+			Applications: counts[klink.ID],
+			Health:       klink.HealthStatus,
+		})
+	}
+
+	return directory, nil
+}
+
+// writeCacheable writes a public response that may be cached for
+// directoryMaxAge. Clients that already have the content get a 304 response.
+func writeCacheable(w http.ResponseWriter, req *http.Request, contentType string, body []byte) {
+	sum := sha1.Sum(body)
+	etag := `"` + hex.EncodeToString(sum[:]) + `"`
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", int(directoryMaxAge.Seconds())))
+	w.Header().Set("ETag", etag)
+
+	if req.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Write(body)
+}
+
+// handleDirectory provides an unauthenticated endpoint that lists the active
+// K-Links
+func (s *Server) handleDirectory() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		directory, err := s.directory()
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		body, err := json.Marshal(directory)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidResponse)
+			return
+		}
+
+		writeCacheable(w, req, "application/json; charset=utf-8", body)
+	}
+}
+
+// handleDirectoryPage provides an unauthenticated HTML page that lists the
+// active K-Links. The page is rendered from `/templates/directory.html` with
+// the same variables as renderFile, and the Klinks of the directory.
+func (s *Server) handleDirectoryPage() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		directory, err := s.directory()
+		if err != nil {
+			http.Error(w, "The directory is not available.", http.StatusInternalServerError)
+			return
+		}
+
+		body, err := renderHTML(s.assets, "/templates/directory.html", map[string]interface{}{
+			"BaseURL":                s.config.HTTPBasePath,
+			"NetworkName":            s.config.NetworkName,
+			"AcceptUserRegistration": s.config.EnableUserRegistration,
+			"Klinks":                 directory.Klinks,
+		})
+		if err != nil {
+			s.requestLogger(req).WithError(err).Error("Error rendering the directory")
+			http.Error(w, "The directory is not available.", http.StatusInternalServerError)
+			return
+		}
+
+		writeCacheable(w, req, "text/html; charset=utf-8", body)
+	}
+}
+
+// renderHTML renders an HTML template. Unlike renderFile, the values are
+// escaped, as they may contain user input.
+func renderHTML(fs http.FileSystem, path string, data map[string]interface{}) ([]byte, error) {
+	file, err := fs.Open(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "Error opening file")
+	}
+	defer file.Close()
+
+	b, err := ioutil.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrap(err, "Failed reading template file")
+	}
+
+	tpl, err := template.New(path).Parse(string(b))
+	if err != nil {
+		return nil, errors.Wrap(err, "Error parsing template")
+	}
+
+	var buf bytes.Buffer
+	if err := tpl.Execute(&buf, data); err != nil {
+		return nil, errors.Wrap(err, "Error rendering file")
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,53 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDirectory(t *testing.T) {
+	s, store := newTestServer(t)
+	store.CreateKlink(&Klink{Identifier: "k-inactive", Name: "Inactive", Active: false})
+
+	rec := serve(t, s, store, 0, "GET", "/api/2.0/directory", "")
+	if rec.Code != 200 {
+		t.Fatalf("expected the directory to be public, got %d", rec.Code)
+	}
+	if !strings.HasPrefix(rec.Header().Get("Cache-Control"), "public") || rec.Header().Get("ETag") == "" {
+		t.Errorf("expected the directory to be cacheable, got %v", rec.Header())
+	}
+
+	var directory Directory
+	json.Unmarshal(rec.Body.Bytes(), &directory)
+	if len(directory.Klinks) != 1 || directory.Klinks[0].Identifier != testKlinkIdentifier || directory.Klinks[0].Applications != 1 {
+		t.Errorf("expected the active K-Link with one application, got %+v", directory.Klinks)
+	}
+
+	req := httptest.NewRequest("GET", "/api/2.0/directory", nil)
+	req.Header.Set("If-None-Match", rec.Header().Get("ETag"))
+	cached := httptest.NewRecorder()
+	s.router.ServeHTTP(cached, req)
+	if cached.Code != http.StatusNotModified {
+		t.Errorf("expected an unchanged directory to be not modified, got %d", cached.Code)
+	}
+}
+
+func TestDirectoryPage(t *testing.T) {
+	s, store := newTestServer(t)
+	s.assets = http.Dir("assets")
+
+	klink, _ := store.GetKlinkByIdentifier(testKlinkIdentifier)
+	klink.Description = "<script>alert(1)</script>"
+	store.UpdateKlink(klink)
+
+	rec := serve(t, s, store, 0, "GET", "/directory", "")
+	if rec.Code != 200 || !strings.Contains(rec.Body.String(), "K-Link") {
+		t.Fatalf("expected the directory page, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if strings.Contains(rec.Body.String(), "<script>") {
+		t.Error("expected the description to be escaped")
+	}
+}
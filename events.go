@@ -0,0 +1,168 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Types of the events sent to webhooks and the event stream
+const (
+	EventApplicationCreated      = "application.created"
+	EventApplicationUpdated      = "application.updated"
+	EventApplicationDeleted      = "application.deleted"
+	EventApplicationTokenRotated = "application.token_rotated"
+	EventKlinkCreated            = "klink.created"
+	EventKlinkUpdated            = "klink.updated"
+	EventKlinkDeleted            = "klink.deleted"
+	EventRegistrantDeactivated   = "registrant.deactivated"
+	EventRegistrantDeleted       = "registrant.deleted"
+)
+
+// EventTypes contains all event types
+var EventTypes = []string{
+	EventApplicationCreated,
+	EventApplicationUpdated,
+	EventApplicationDeleted,
+	EventApplicationTokenRotated,
+	EventKlinkCreated,
+	EventKlinkUpdated,
+	EventKlinkDeleted,
+	EventRegistrantDeactivated,
+	EventRegistrantDeleted,
+}
+
+// Event describes a change inside the registry. Data contains the changed
+// record as ApplicationEvent, KlinkEvent or RegistrantEvent; deleted records
+// are described as they were before the deletion.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt int64       `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// ApplicationEvent describes an application inside an Event. It does not
+// contain the token.
+type ApplicationEvent struct {
+	ID         int64    `json:"id"`
+	OwnerID    int64    `json:"owner_id"`
+	Name       string   `json:"name"`
+	URL        string   `json:"app_domain"`
+	Origins    []string `json:"origins"`
+	Klinks     []string `json:"klinks"`
+	Active     bool     `json:"active"`
+	ValidFrom  int64    `json:"valid_from"`
+	ValidUntil int64    `json:"valid_until"`
+	PeerID     int64    `json:"peer_id"`
+}
+
+// KlinkEvent describes a K-Link inside an Event
+type KlinkEvent struct {
+	Identifier string `json:"id"`
+	Name       string `json:"name"`
+	Website    string `json:"website"`
+	Active     bool   `json:"active"`
+	PeerID     int64  `json:"peer_id"`
+}
+
+// RegistrantEvent describes a registrant inside an Event
+type RegistrantEvent struct {
+	ID     int64  `json:"id"`
+	Name   string `json:"name"`
+	Role   string `json:"role"`
+	Active bool   `json:"active"`
+}
+
+func newApplicationEvent(app *Application) ApplicationEvent {
+	return ApplicationEvent{
+		ID:         app.ID,
+		OwnerID:    app.OwnerID,
+		Name:       app.Name,
+		URL:        app.URL,
+		Origins:    app.Origins,
+		Klinks:     app.Klinks,
+		Active:     app.Active,
+		ValidFrom:  app.ValidFrom,
+		ValidUntil: app.ValidUntil,
+		PeerID:     app.PeerID,
+	}
+}
+
+// emitApplication records the change of an application for the peers and
+// emits the event. Changes of imported applications are not passed on.
+func (s *Server) emitApplication(eventType string, app *Application) {
+	if app.PeerID == 0 {
+		s.recordChange(ChangeApplication, app.ID)
+	}
+	s.emit(eventType, app.ID, newApplicationEvent(app))
+}
+
+// emitKlink records the change of a K-Link for the peers and emits the
+// event. Changes of imported K-Links are not passed on.
+func (s *Server) emitKlink(eventType string, klink *Klink) {
+	if klink.PeerID == 0 {
+		s.recordChange(ChangeKlink, klink.ID)
+	}
+	s.emit(eventType, klink.ID, KlinkEvent{
+		Identifier: klink.Identifier,
+		Name:       klink.Name,
+		Website:    klink.Website,
+		Active:     klink.Active,
+		PeerID:     klink.PeerID,
+	})
+}
+
+// emitRegistrant emits the event of a registrant
+func (s *Server) emitRegistrant(eventType string, registrant *Registrant) {
+	s.emit(eventType, registrant.ID, RegistrantEvent{
+		ID:     registrant.ID,
+		Name:   registrant.Name,
+		Role:   registrant.Role,
+		Active: registrant.Active,
+	})
+}
+
+// emit persists the event for the event stream and queues it for delivery
+// to all active webhooks that subscribed to its type. The subject is the ID
+// of the record the event is about.
+func (s *Server) emit(eventType string, subjectID int64, data interface{}) {
+	event := Event{
+		ID:        generateToken(),
+		Type:      eventType,
+		CreatedAt: time.Now().UTC().Unix(),
+		Data:      data,
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		s.logger.WithError(err).WithField("event", eventType).Error("Error encoding event")
+		return
+	}
+
+	s.publish(&EventRecord{
+		ID:        event.ID,
+		Type:      event.Type,
+		SubjectID: subjectID,
+		Payload:   string(payload),
+		CreatedAt: event.CreatedAt,
+	})
+
+	webhooks, err := s.store.ListWebhooks()
+	if err != nil && !s.store.IsNotFound(err) {
+		s.logger.WithError(err).WithField("event", eventType).Error("Error listing webhooks for event")
+		return
+	}
+
+	for _, webhook := range webhooks {
+		if !webhook.Active || (len(webhook.Events) > 0 && !stringInSlice(eventType, webhook.Events)) {
+			continue
+		}
+
+		s.queueDelivery(&WebhookDelivery{
+			WebhookID: webhook.ID,
+			EventID:   event.ID,
+			EventType: event.Type,
+			Payload:   string(payload),
+		})
+	}
+}
@@ -0,0 +1,50 @@
+package klinkregistry
+
+import (
+	"fmt"
+	"time"
+)
+
+// runExpiryReminders sends the expiry reminders in the given interval. It
+// is started in the background by Run.
+func (s *Server) runExpiryReminders(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.sendExpiryReminders(time.Now())
+		<-ticker.C
+	}
+}
+
+// sendExpiryReminders reminds the owners of applications that expire within
+// the configured number of days. Every owner is reminded once per validity
+// period, a renewal resets the reminder.
+func (s *Server) sendExpiryReminders(now time.Time) {
+	apps, err := s.store.ListApplications()
+	if err != nil {
+		s.logger.WithError(err).Error("Error listing applications for expiry reminders")
+		return
+	}
+
+	deadline := now.AddDate(0, 0, s.config.ExpiryReminderDays).Unix()
+	for _, app := range apps {
+		if app.ValidUntil == 0 || app.ValidUntil <= now.Unix() || app.ValidUntil > deadline {
+			continue
+		}
+		if app.ReminderSentFor == app.ValidUntil {
+			continue
+		}
+
+		s.notifyRegistrant(app.OwnerID, "Application "+app.Name+" expires soon",
+			fmt.Sprintf("Your application %q (%s) expires at %s.\n\nYou can request a renewal here: %s",
+				app.Name, app.URL,
+				time.Unix(app.ValidUntil, 0).UTC().Format(time.RFC1123),
+				s.link("applications/%d", app.ID)),
+		)
+
+		if err := s.store.SetApplicationReminder(app.ID, app.ValidUntil); err != nil {
+			s.logger.WithError(err).WithField("application", app.ID).Error("Error storing expiry reminder")
+		}
+	}
+}
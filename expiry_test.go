@@ -0,0 +1,98 @@
+package klinkregistry
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// recordingMailer records the recipients of all emails
+type recordingMailer struct {
+	recipients []string
+}
+
+func (m *recordingMailer) Email(recipient, subject, html, text string) error {
+	m.recipients = append(m.recipients, recipient)
+	return nil
+}
+
+func TestAuthorizeValidity(t *testing.T) {
+	now := time.Now().Unix()
+
+	cases := []struct {
+		from, until int64
+		reason      string
+	}{
+		{0, 0, ""},
+		{now - 60, now + 60, ""},
+		{now + 60, 0, DenyNotYetValid},
+		{0, now - 60, DenyExpired},
+	}
+
+	for _, c := range cases {
+		s, store := newTestServer(t)
+		store.applications[testAliceAppID].ValidFrom = c.from
+		store.applications[testAliceAppID].ValidUntil = c.until
+
+		auth := s.authorize(AuthorizationRequest{AppURL: "https://alice.example.com", AppSecret: "alice"})
+		if auth.Reason != c.reason {
+			t.Errorf("valid from %d until %d: expected reason %q, got %q", c.from, c.until, c.reason, auth.Reason)
+		}
+	}
+}
+
+func TestSendExpiryReminders(t *testing.T) {
+	s, store := newTestServer(t)
+	mailer := &recordingMailer{}
+	s.email = mailer
+	s.config.ExpiryReminderDays = 7
+
+	now := time.Now()
+	store.applications[testAliceAppID].ValidUntil = now.AddDate(0, 0, 3).Unix()
+	store.applications[testBobAppID].ValidUntil = now.AddDate(0, 0, 30).Unix()
+
+	s.sendExpiryReminders(now)
+	s.sendExpiryReminders(now)
+
+	if len(mailer.recipients) != 1 || mailer.recipients[0] != "alice@example.com" {
+		t.Errorf("expected a single reminder to alice, got %v", mailer.recipients)
+	}
+}
+
+func TestRenewalRequest(t *testing.T) {
+	s, store := newTestServer(t)
+	until := time.Now().AddDate(1, 0, 0).Unix()
+	body := fmt.Sprintf(`{"valid_until":%d,"justification":"project extended"}`, until)
+
+	if rec := serve(t, s, store, testBobID, "POST", "/api/2.0/applications/5/renewals", body); rec.Code != 403 {
+		t.Errorf("expected others to be unable to request a renewal, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/renewals", body); rec.Code != 200 {
+		t.Fatalf("expected the renewal request to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/renewals", body); rec.Code != 409 {
+		t.Errorf("expected a second pending renewal to be rejected, got %d", rec.Code)
+	}
+
+	renewals, _ := store.ListRenewalRequestsByApplication(testAliceAppID)
+	path := fmt.Sprintf("/api/2.0/applications/5/renewals/%d/approve", renewals[0].ID)
+
+	if rec := serve(t, s, store, testAliceID, "POST", path, ""); rec.Code != 403 {
+		t.Errorf("expected owners to be unable to approve their renewal, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "POST", path, ""); rec.Code != 200 {
+		t.Fatalf("expected the approval to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	app, _ := store.GetApplicationByID(testAliceAppID)
+	if app.ValidUntil != until {
+		t.Errorf("expected the validity to be extended to %d, got %d", until, app.ValidUntil)
+	}
+
+	if rec := serve(t, s, store, testAliceID, "PUT", "/api/2.0/applications/5/validity", `{"valid_until":0}`); rec.Code != 403 {
+		t.Errorf("expected owners to be unable to set the validity, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/applications/5/validity", `{"valid_until":0}`); rec.Code != 200 {
+		t.Errorf("expected admins to set the validity, got %d", rec.Code)
+	}
+}
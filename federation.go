@@ -0,0 +1,541 @@
+package klinkregistry
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Headers of signed requests and responses between peer registries
+const (
+	HeaderPeerKey   = "X-Registry-Key"
+	HeaderTimestamp = "X-Registry-Timestamp"
+	HeaderSignature = "X-Registry-Signature"
+)
+
+// ChangesPath is the path of the change feed, relative to the base path of a
+// registry
+const ChangesPath = "/api/2.0/federation/changes"
+
+const (
+	// federationMaxSkew is the maximal difference between the clocks of
+	// two peers, older signatures are rejected
+	federationMaxSkew = 5 * time.Minute
+
+	// federationBatchSize is the number of changes returned at once
+	federationBatchSize = 200
+
+	// federationMaxBody is the maximal size of a change feed response
+	federationMaxBody = 32 << 20
+)
+
+// ErrInvalidSignature is returned if a response of a peer is not signed with
+// the shared secret
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// FederatedKlink is the representation of a K-Link in the change feed
+type FederatedKlink struct {
+	ID          int64  `json:"id"`
+	Identifier  string `json:"identifier"`
+	Name        string `json:"name"`
+	Website     string `json:"website"`
+	Description string `json:"description"`
+	Active      bool   `json:"active"`
+}
+
+// FederatedApplication is the representation of an application in the
+// change feed. The token is replaced by its hash. The challenge token lets
+// the peer verify the domains of the application itself.
+type FederatedApplication struct {
+	ID               int64        `json:"id"`
+	Name             string       `json:"name"`
+	URL              string       `json:"app_domain"`
+	Origins          []string     `json:"origins"`
+	TokenHash        string       `json:"token_hash"`
+	Permissions      []string     `json:"permissions"`
+	Grants           []KlinkGrant `json:"grants"`
+	Active           bool         `json:"active"`
+	ValidFrom        int64        `json:"valid_from"`
+	ValidUntil       int64        `json:"valid_until"`
+	ChallengeToken   string       `json:"challenge_token"`
+	VerifiedAt       int64        `json:"verified_at"`
+	Description      string       `json:"description"`
+	Tags             []string     `json:"tags"`
+	TechnicalContact string       `json:"technical_contact"`
+	SecurityContact  string       `json:"security_contact"`
+	LogoURL          string       `json:"logo_url"`
+	Environment      string       `json:"environment"`
+}
+
+// FederationChanges contains the current state of the records that changed
+// after a cursor. Cursor is the last included change, and More is set if
+// there are further changes.
+type FederationChanges struct {
+	Registry            string                 `json:"registry"`
+	Cursor              int64                  `json:"cursor"`
+	More                bool                   `json:"more"`
+	Klinks              []FederatedKlink       `json:"klinks"`
+	Applications        []FederatedApplication `json:"applications"`
+	DeletedKlinks       []int64                `json:"deleted_klinks"`
+	DeletedApplications []int64                `json:"deleted_applications"`
+}
+
+// sign returns the signature of a request or response. The signature of a
+// response covers the request URI, so that it cannot be replayed for another
+// request.
+func sign(secret, timestamp, method, uri string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%s\n%s\n%s\n", timestamp, method, uri)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// checkSignature returns true if the signature is valid and not older than
+// federationMaxSkew
+func checkSignature(secret, timestamp, method, uri string, body []byte, signature string, now time.Time) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	skew := now.Sub(time.Unix(ts, 0))
+	if skew > federationMaxSkew || skew < -federationMaxSkew {
+		return false
+	}
+
+	return hmac.Equal([]byte(sign(secret, timestamp, method, uri, body)), []byte(signature))
+}
+
+// recordChange records that a local record was changed, so that peers pull
+// it on their next sync
+func (s *Server) recordChange(kind string, id int64) {
+	change := &Change{Kind: kind, RecordID: id, CreatedAt: time.Now().UTC().Unix()}
+	if err := s.store.CreateChange(change); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{"kind": kind, "id": id}).Error("Error recording change")
+	}
+}
+
+// changesSince returns the current state of the local records that changed
+// after the cursor. Records imported from other peers are not passed on.
+func (s *Server) changesSince(cursor int64) (*FederationChanges, error) {
+	changes := &FederationChanges{
+		Registry:            s.config.NetworkName,
+		Cursor:              cursor,
+		Klinks:              []FederatedKlink{},
+		Applications:        []FederatedApplication{},
+		DeletedKlinks:       []int64{},
+		DeletedApplications: []int64{},
+	}
+
+	list, err := s.store.ListChangesSince(cursor, federationBatchSize)
+	if err != nil && !s.store.IsNotFound(err) {
+		return nil, err
+	}
+	changes.More = len(list) == federationBatchSize
+
+	seen := make(map[Change]bool)
+	for _, change := range list {
+		changes.Cursor = change.ID
+
+		key := Change{Kind: change.Kind, RecordID: change.RecordID}
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		switch change.Kind {
+		case ChangeKlink:
+			klink, err := s.store.GetKlinkByPrimaryKey(change.RecordID)
+			if s.store.IsNotFound(err) {
+				changes.DeletedKlinks = append(changes.DeletedKlinks, change.RecordID)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if klink.PeerID != 0 {
+				continue
+			}
+
+			changes.Klinks = append(changes.Klinks, FederatedKlink{
+				ID:          klink.ID,
+				Identifier:  klink.Identifier,
+				Name:        klink.Name,
+				Website:     klink.Website,
+				Description: klink.Description,
+				Active:      klink.Active,
+			})
+
+		case ChangeApplication:
+			app, err := s.store.GetApplicationByID(change.RecordID)
+			if s.store.IsNotFound(err) {
+				changes.DeletedApplications = append(changes.DeletedApplications, change.RecordID)
+				continue
+			} else if err != nil {
+				return nil, err
+			}
+			if app.PeerID != 0 {
+				continue
+			}
+
+			changes.Applications = append(changes.Applications, FederatedApplication{
+				ID:               app.ID,
+				Name:             app.Name,
+				URL:              app.URL,
+				Origins:          app.Origins,
+				TokenHash:        HashToken(app.Token),
+				Permissions:      app.Permissions,
+				Grants:           app.Grants,
+				Active:           app.Active,
+				ValidFrom:        app.ValidFrom,
+				ValidUntil:       app.ValidUntil,
+				ChallengeToken:   app.ChallengeToken,
+				VerifiedAt:       app.VerifiedAt,
+				Description:      app.Description,
+				Tags:             app.Tags,
+				TechnicalContact: app.TechnicalContact,
+				SecurityContact:  app.SecurityContact,
+				LogoURL:          app.LogoURL,
+				Environment:      app.Environment,
+			})
+		}
+	}
+
+	return changes, nil
+}
+
+// handleFederationChanges provides the change feed for peers. The request
+// has to be signed with the secret of an active peer, and the response is
+// signed with the same secret.
+func (s *Server) handleFederationChanges() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		peer, err := s.store.GetPeerByKey(req.Header.Get(HeaderPeerKey))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrUnauthorized)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		uri := req.URL.RequestURI()
+		if !peer.Active || !checkSignature(peer.Secret, req.Header.Get(HeaderTimestamp), req.Method, uri, nil,
+			req.Header.Get(HeaderSignature), time.Now()) {
+			jsonResponse(w, API2ErrUnauthorized)
+			return
+		}
+
+		cursor, _ := strconv.ParseInt(req.URL.Query().Get("since"), 10, 64)
+		changes, err := s.changesSince(cursor)
+		if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		body, err := json.Marshal(changes)
+		if err != nil {
+			jsonResponse(w, API2ErrInvalidResponse)
+			return
+		}
+
+		timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Header().Set(HeaderTimestamp, timestamp)
+		w.Header().Set(HeaderSignature, sign(peer.Secret, timestamp, req.Method, uri, body))
+		w.Write(body)
+	}
+}
+
+// fetchChanges requests the changes after the cursor of the peer
+func (s *Server) fetchChanges(peer *Peer) (*FederationChanges, error) {
+	u, err := url.Parse(strings.TrimSuffix(peer.URL, "/") + ChangesPath)
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = url.Values{"since": {strconv.FormatInt(peer.Cursor, 10)}}.Encode()
+	uri := u.RequestURI()
+
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set(HeaderPeerKey, peer.Key)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, sign(peer.Secret, timestamp, "GET", uri, nil))
+
+	res, err := s.federation.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, federationMaxBody))
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("unexpected status %s", res.Status)
+	}
+
+	if !checkSignature(peer.Secret, res.Header.Get(HeaderTimestamp), "GET", uri, body,
+		res.Header.Get(HeaderSignature), time.Now()) {
+		return nil, ErrInvalidSignature
+	}
+
+	changes := new(FederationChanges)
+	if err := json.Unmarshal(body, changes); err != nil {
+		return nil, errors.Wrap(err, "Invalid change feed")
+	}
+
+	return changes, nil
+}
+
+// syncPeer imports the changes of the peer since its cursor, until the feed
+// has no more changes. The cursor and the outcome are stored with the peer.
+func (s *Server) syncPeer(peer *Peer) error {
+	pullErr := s.pullPeer(peer)
+
+	peer.LastSyncAt = time.Now().UTC().Unix()
+	peer.LastError = ""
+	if pullErr != nil {
+		peer.LastError = truncate(pullErr.Error(), 255)
+	}
+	if err := s.store.UpdatePeer(peer); err != nil {
+		return err
+	}
+
+	return pullErr
+}
+
+// pullPeer fetches and applies the batches of changes of the peer
+func (s *Server) pullPeer(peer *Peer) error {
+	for {
+		changes, err := s.fetchChanges(peer)
+		if err != nil {
+			return err
+		}
+
+		// K-Links first, as the grants of applications refer to them
+		for _, klink := range changes.Klinks {
+			if err := s.importKlink(peer, klink); err != nil {
+				return err
+			}
+		}
+		for _, app := range changes.Applications {
+			if err := s.importApplication(peer, app); err != nil {
+				return err
+			}
+		}
+		for _, id := range changes.DeletedApplications {
+			app, err := s.store.GetApplicationByRemoteID(peer.ID, id)
+			if s.store.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := s.store.DeleteApplication(app.ID); err != nil {
+				return err
+			}
+			s.emitApplication(EventApplicationDeleted, app)
+		}
+		for _, id := range changes.DeletedKlinks {
+			klink, err := s.store.GetKlinkByRemoteID(peer.ID, id)
+			if s.store.IsNotFound(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			if err := s.store.DeleteKlink(klink.ID); err != nil {
+				return err
+			}
+			s.emitKlink(EventKlinkDeleted, klink)
+		}
+
+		// the cursor is stored after each batch, so that a failed sync
+		// continues where it stopped
+		peer.Cursor = changes.Cursor
+		if err := s.store.UpdatePeer(peer); err != nil {
+			return err
+		}
+
+		if !changes.More {
+			return nil
+		}
+	}
+}
+
+// importKlink creates or updates the local copy of a K-Link of the peer. A
+// K-Link whose identifier is already used by another K-Link is skipped.
+func (s *Server) importKlink(peer *Peer, remote FederatedKlink) error {
+	klink, err := s.store.GetKlinkByRemoteID(peer.ID, remote.ID)
+	if s.store.IsNotFound(err) {
+		if _, err := s.store.GetKlinkByIdentifier(remote.Identifier); err == nil {
+			s.logger.WithFields(logrus.Fields{"klink": remote.Identifier, "peer": peer.Name}).Warn("Skipping K-Link of peer, the identifier is already used")
+			return nil
+		} else if !s.store.IsNotFound(err) {
+			return err
+		}
+
+		klink = &Klink{
+			Identifier: remote.Identifier,
+			ManagerID:  peer.OwnerID,
+			PeerID:     peer.ID,
+			RemoteID:   remote.ID,
+		}
+	} else if err != nil {
+		return err
+	}
+
+	klink.Name = remote.Name
+	klink.Website = remote.Website
+	klink.Description = remote.Description
+	klink.Active = remote.Active
+
+	if klink.ID == 0 {
+		if err := s.store.CreateKlink(klink); err != nil {
+			return err
+		}
+		s.emitKlink(EventKlinkCreated, klink)
+		return nil
+	}
+
+	if err := s.store.UpdateKlink(klink); err != nil {
+		return err
+	}
+	s.emitKlink(EventKlinkUpdated, klink)
+	return nil
+}
+
+// importApplication creates or updates the local copy of an application of
+// the peer. An application whose origins are already used by another
+// application is skipped, and grants of K-Links that were not imported from
+// the peer are dropped. The application wide permissions are not imported,
+// so that the application is only granted access inside the K-Links of the
+// peer.
+func (s *Server) importApplication(peer *Peer, remote FederatedApplication) error {
+	app, err := s.store.GetApplicationByRemoteID(peer.ID, remote.ID)
+	if s.store.IsNotFound(err) {
+		app = &Application{OwnerID: peer.OwnerID, PeerID: peer.ID, RemoteID: remote.ID}
+	} else if err != nil {
+		return err
+	}
+	previous := *app
+
+	app.Name = remote.Name
+	app.URL = remote.URL
+	app.Origins = remote.Origins
+	app.Token = remote.TokenHash
+	app.Permissions = []string{}
+	app.SetGrants(nil)
+	for _, grant := range remote.Grants {
+		// a peer may only grant access to its own K-Links
+		klink, err := s.store.GetKlinkByIdentifier(grant.Klink)
+		if s.store.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if klink.PeerID == peer.ID {
+			app.AddGrant(grant.Klink, grant.Permissions)
+		}
+	}
+	app.Active = remote.Active
+	app.ValidFrom = remote.ValidFrom
+	app.ValidUntil = remote.ValidUntil
+	app.ChallengeToken = remote.ChallengeToken
+	app.Description = remote.Description
+	app.Tags = remote.Tags
+	app.TechnicalContact = remote.TechnicalContact
+	app.SecurityContact = remote.SecurityContact
+	app.LogoURL = remote.LogoURL
+	app.Environment = remote.Environment
+
+	if apiErr := s.checkOrigins(app); apiErr != nil {
+		s.logger.WithFields(logrus.Fields{"application": remote.URL, "peer": peer.Name, "reason": apiErr.Message}).Warn("Skipping application of peer")
+		return nil
+	}
+	s.verifyImportedApplication(app, &previous, remote.VerifiedAt != 0)
+
+	if app.ID == 0 {
+		if err := s.store.CreateApplication(app); err != nil {
+			return err
+		}
+		s.emitApplication(EventApplicationCreated, app)
+		return nil
+	}
+
+	if err := s.store.ReplaceApplication(app); err != nil {
+		return err
+	}
+	s.emitApplication(EventApplicationUpdated, app)
+	return nil
+}
+
+// verifyImportedApplication verifies the domains of an imported application
+// with its challenge token, instead of trusting the verification of the
+// peer. Applications the peer has not verified are not checked, and a local
+// verification is kept as long as the domains and the token do not change.
+func (s *Server) verifyImportedApplication(app, previous *Application, verifiedByPeer bool) {
+	if !verifiedByPeer || app.ChallengeToken == "" {
+		app.VerifiedAt = 0
+		return
+	}
+
+	if app.ID != 0 && app.VerifiedAt != 0 && app.ChallengeToken == previous.ChallengeToken &&
+		sameDomain(app.URL, previous.URL) && isSubset(app.Origins, previous.Origins) {
+		return
+	}
+
+	app.VerifiedAt = 0
+	origin, err := s.verifyOrigins(context.Background(), app, VerifyDNS, VerifyHTTP)
+	if err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{"application": app.URL, "origin": origin}).Warn("Could not verify the domain of an imported application")
+		return
+	}
+	app.VerifiedAt = time.Now().UTC().Unix()
+}
+
+// runFederationSync pulls the changes of all subscribed peers in the given
+// interval. It is started in the background by Run.
+func (s *Server) runFederationSync(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.syncPeers()
+		<-ticker.C
+	}
+}
+
+// syncPeers pulls the changes of all active peers that have a URL
+func (s *Server) syncPeers() {
+	peers, err := s.store.ListPeers()
+	if err != nil && !s.store.IsNotFound(err) {
+		s.logger.WithError(err).Error("Error listing peers for synchronisation")
+		return
+	}
+
+	for _, peer := range peers {
+		if !peer.Active || peer.URL == "" {
+			continue
+		}
+
+		if err := s.syncPeer(peer); err != nil {
+			s.logger.WithError(err).WithField("peer", peer.Name).Error("Error synchronising peer")
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package klinkregistry
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newPeerTestServer returns a server whose store only contains an admin and
+// the permission catalogue, so that it can import the records of a test
+// server
+func newPeerTestServer(t *testing.T) (*Server, *memStore) {
+	s, err := NewServer(&Config{HTTPSecret: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newMemStore()
+	store.CreateRegistrant(&Registrant{Email: "admin@peer.example.com", Name: "Admin", Role: RoleAdmin, Active: true})
+	store.CreatePermission(&Permission{Name: "data-search"})
+
+	s.SetStore(store)
+	return s, store
+}
+
+// federate connects a test server as source to a peer test server, which
+// subscribes to it. The source has to be closed by the caller.
+func federate(t *testing.T) (*httptest.Server, *memStore, *Server, *memStore, *Peer) {
+	source, sourceStore := newTestServer(t)
+	ts := httptest.NewServer(source.router)
+
+	// the fixtures are not created through the API
+	sourceStore.CreateChange(&Change{Kind: ChangeKlink, RecordID: testKlinkID})
+	sourceStore.CreateChange(&Change{Kind: ChangeApplication, RecordID: testAliceAppID})
+	sourceStore.CreateChange(&Change{Kind: ChangeApplication, RecordID: testBobAppID})
+	sourceStore.CreatePeer(&Peer{Name: "Peer", Key: "peer-key", Secret: "peer-secret", OwnerID: testAdminID, Active: true})
+
+	target, targetStore := newPeerTestServer(t)
+	peer := &Peer{Name: "Source", URL: ts.URL, Key: "peer-key", Secret: "peer-secret", OwnerID: 1, Active: true}
+	targetStore.CreatePeer(peer)
+
+	return ts, sourceStore, target, targetStore, peer
+}
+
+func TestFederationSync(t *testing.T) {
+	ts, sourceStore, target, targetStore, peer := federate(t)
+	defer ts.Close()
+
+	// the domain of alice is verified again, bob has no challenge token
+	sourceStore.applications[testAliceAppID].ChallengeToken = "alice-challenge"
+	target.verifier = &DomainVerifier{Resolver: fakeResolver{
+		"_klink-registry-challenge.alice.example.com": {"alice-challenge"},
+	}}
+
+	if err := target.syncPeer(peer); err != nil {
+		t.Fatal(err)
+	}
+
+	klink, err := targetStore.GetKlinkByIdentifier(testKlinkIdentifier)
+	if err != nil || klink.PeerID != peer.ID || klink.RemoteID != testKlinkID {
+		t.Fatalf("expected the K-Link to be imported, got %+v (%v)", klink, err)
+	}
+
+	app, err := targetStore.GetApplicationByRemoteID(peer.ID, testAliceAppID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if app.URL != "https://alice.example.com" || app.Token == "alice" || app.GetGrant(testKlinkIdentifier) == nil {
+		t.Errorf("expected the application to be imported with the hash of its token and its grant, got %+v", app)
+	}
+
+	// the imported application authenticates with its own secret
+	request := AuthorizationRequest{AppURL: "https://alice.example.com", AppSecret: "alice", KlinkID: testKlinkIdentifier, Permissions: []string{"data-search"}}
+	if auth := target.authorize(request); !auth.Granted() {
+		t.Errorf("expected the federated application to be granted, got %q: %+v", auth.Reason, auth.Checks)
+	}
+	request.AppSecret = HashToken("alice")
+	if auth := target.authorize(request); auth.Reason != DenyInvalidSecret {
+		t.Errorf("expected the hash to be no valid secret, got %q", auth.Reason)
+	}
+
+	// the application wide permissions of the peer are not imported
+	request.AppSecret, request.KlinkID = "alice", ""
+	if auth := target.authorize(request); auth.Reason != DenyMissingPermission {
+		t.Errorf("expected the federated application to need a K-Link, got %q", auth.Reason)
+	}
+
+	if bob, _ := targetStore.GetApplicationByRemoteID(peer.ID, testBobAppID); bob == nil || bob.VerifiedAt != 0 {
+		t.Errorf("expected the verification of the peer not to be trusted, got %+v", bob)
+	}
+
+	// imported records are read-only
+	if rec := serve(t, target, targetStore, 1, "DELETE", "/api/2.0/klinks/k-admin", ""); rec.Code != 409 {
+		t.Errorf("expected imported K-Links to be read-only, got %d", rec.Code)
+	}
+	if rec := serve(t, target, targetStore, 1, "POST", "/api/2.0/applications/"+strconv.FormatInt(app.ID, 10)+"/verify", ""); rec.Code != 409 {
+		t.Errorf("expected imported applications to be read-only, got %d", rec.Code)
+	}
+
+	// later syncs only pull the new changes
+	sourceStore.applications[testAliceAppID].Name = "Alice renamed"
+	sourceStore.CreateChange(&Change{Kind: ChangeApplication, RecordID: testAliceAppID})
+	sourceStore.DeleteApplication(testBobAppID)
+	sourceStore.CreateChange(&Change{Kind: ChangeApplication, RecordID: testBobAppID})
+
+	cursor := peer.Cursor
+	if err := target.syncPeer(peer); err != nil {
+		t.Fatal(err)
+	}
+	if peer.Cursor <= cursor || peer.LastError != "" {
+		t.Errorf("expected the cursor to advance, got %d after %d: %s", peer.Cursor, cursor, peer.LastError)
+	}
+
+	if app, _ := targetStore.GetApplicationByRemoteID(peer.ID, testAliceAppID); app == nil || app.Name != "Alice renamed" {
+		t.Errorf("expected the update to be imported, got %+v", app)
+	}
+	if _, err := targetStore.GetApplicationByRemoteID(peer.ID, testBobAppID); !targetStore.IsNotFound(err) {
+		t.Errorf("expected the deletion to be imported, got %v", err)
+	}
+
+	// imports emit events, but are not passed on to other peers
+	var types []string
+	for _, event := range targetStore.events {
+		types = append(types, event.Type)
+	}
+	want := []string{EventKlinkCreated, EventApplicationCreated, EventApplicationCreated, EventApplicationUpdated, EventApplicationDeleted}
+	if strings.Join(types, ",") != strings.Join(want, ",") {
+		t.Errorf("expected the events %v, got %v", want, types)
+	}
+	if len(targetStore.changes) != 0 {
+		t.Errorf("expected no changes to be recorded for imported records, got %d", len(targetStore.changes))
+	}
+
+	// removing the peer removes its records
+	if rec := serve(t, target, targetStore, 1, "DELETE", "/api/2.0/peers/"+strconv.FormatInt(peer.ID, 10), ""); rec.Code != 200 {
+		t.Fatalf("expected the peer to be removed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if len(targetStore.applications) != 0 || len(targetStore.klinks) != 0 {
+		t.Errorf("expected the imported records to be removed, got %d applications and %d K-Links",
+			len(targetStore.applications), len(targetStore.klinks))
+	}
+}
+
+func TestFederationSignature(t *testing.T) {
+	ts, _, target, targetStore, peer := federate(t)
+	defer ts.Close()
+
+	peer.Secret = "wrong"
+	if err := target.syncPeer(peer); err == nil {
+		t.Error("expected a sync with the wrong secret to fail")
+	}
+	if stored, _ := targetStore.GetPeerByID(peer.ID); stored.LastError == "" || stored.Cursor != 0 {
+		t.Errorf("expected the error to be stored without moving the cursor, got %+v", stored)
+	}
+	if len(targetStore.applications) != 0 {
+		t.Errorf("expected nothing to be imported, got %d applications", len(targetStore.applications))
+	}
+
+	now := time.Now()
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	sig := sign("secret", timestamp, "GET", ChangesPath, nil)
+	if !checkSignature("secret", timestamp, "GET", ChangesPath, nil, sig, now) {
+		t.Error("expected the signature to be valid")
+	}
+	if checkSignature("secret", timestamp, "GET", ChangesPath+"?since=0", nil, sig, now) {
+		t.Error("expected the signature to cover the request URI")
+	}
+	if checkSignature("secret", timestamp, "GET", ChangesPath, nil, sig, now.Add(federationMaxSkew+time.Second)) {
+		t.Error("expected old signatures to be rejected")
+	}
+}
+
+func TestFederationChangesUnsigned(t *testing.T) {
+	s, store := newTestServer(t)
+	store.CreatePeer(&Peer{Name: "Peer", Key: "peer-key", Secret: "peer-secret", OwnerID: testAdminID, Active: true})
+
+	req := httptest.NewRequest("GET", ChangesPath, nil)
+	req.Header.Set(HeaderPeerKey, "peer-key")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != 401 {
+		t.Errorf("expected unsigned requests to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestCreatePeer(t *testing.T) {
+	s, store := newTestServer(t)
+
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/peers/", `{"name":"Peer"}`); rec.Code != 403 {
+		t.Errorf("expected users to be unable to add peers, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "POST", "/api/2.0/peers/", `{"name":"Peer","url":"ftp://peer"}`); rec.Code != 422 {
+		t.Errorf("expected invalid URLs to be rejected, got %d", rec.Code)
+	}
+
+	rec := serve(t, s, store, testAdminID, "POST", "/api/2.0/peers/", `{"name":"Peer","active":true}`)
+	if rec.Code != 200 {
+		t.Fatalf("expected the peer to be added, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	peers, _ := store.ListPeers()
+	if len(peers) != 1 || peers[0].Key == "" || peers[0].Secret == "" || peers[0].OwnerID != testAdminID {
+		t.Errorf("expected the key and secret to be generated, got %+v", peers)
+	}
+}
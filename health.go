@@ -0,0 +1,195 @@
+package klinkregistry
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+// healthHistoryRetention is the time the results of health checks are kept
+const healthHistoryRetention = 30 * 24 * time.Hour
+
+// healthHistoryLength is the number of health checks returned by the API
+const healthHistoryLength = 100
+
+// healthProbeConcurrency is the number of K-Links that are probed at once
+const healthProbeConcurrency = 10
+
+// HealthCheckModel is the JSON representation of a HealthCheck
+type HealthCheckModel struct {
+	ID         int64  `json:"id"`
+	KlinkID    int64  `json:"-"`
+	CheckedAt  int64  `json:"checked_at"`
+	Status     string `json:"status"`
+	StatusCode int    `json:"status_code"`
+	Latency    int64  `json:"latency"`
+	Error      string `json:"error"`
+}
+
+// validHTTPURL returns true if the URL is empty or an absolute http(s) URL
+func validHTTPURL(raw string) bool {
+	if raw == "" {
+		return true
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+
+	return (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// runHealthChecks probes the K-Links in the given interval. It is started in
+// the background by Run.
+func (s *Server) runHealthChecks(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.checkKlinksHealth(time.Now())
+		<-ticker.C
+	}
+}
+
+// checkKlinksHealth probes the health-check URL of all active K-Links and
+// stores the results. The managers of a K-Link are alerted when its state
+// changes, but not when it is probed for the first time and is up.
+func (s *Server) checkKlinksHealth(now time.Time) {
+	klinks, err := s.store.ListKlinks()
+	if err != nil && !s.store.IsNotFound(err) {
+		s.logger.WithError(err).Error("Error listing K-Links for health checks")
+		return
+	}
+
+	var probed []*Klink
+	for _, klink := range klinks {
+		if klink.Active && klink.HealthURL != "" {
+			probed = append(probed, klink)
+		}
+	}
+
+	// unreachable K-Links take until the timeout, so the probes run
+	// concurrently to not delay the others
+	checks := make([]*HealthCheck, len(probed))
+	slots := make(chan struct{}, healthProbeConcurrency)
+	var wg sync.WaitGroup
+	for i, klink := range probed {
+		wg.Add(1)
+		go func(i int, klink *Klink) {
+			defer wg.Done()
+			slots <- struct{}{}
+			defer func() { <-slots }()
+			checks[i] = s.probeKlink(klink, now)
+		}(i, klink)
+	}
+	wg.Wait()
+
+	for i, klink := range probed {
+		check := checks[i]
+		if err := s.store.CreateHealthCheck(check); err != nil {
+			s.logger.WithError(err).WithField("klink", klink.Identifier).Error("Error storing health check")
+		}
+		if err := s.store.SetKlinkHealth(klink.ID, check.Status, check.CheckedAt); err != nil {
+			s.logger.WithError(err).WithField("klink", klink.Identifier).Error("Error storing health")
+			continue
+		}
+
+		if check.Status == klink.HealthStatus || (klink.HealthStatus == "" && check.Status == HealthUp) {
+			continue
+		}
+
+		text := fmt.Sprintf("The K-Link %q is %s since %s.", klink.Name, check.Status,
+			time.Unix(check.CheckedAt, 0).UTC().Format(time.RFC1123))
+		if check.Error != "" {
+			text += "\n\nThe health check failed with: " + check.Error
+		}
+		text += "\n\nYou can see the health history here: " + s.link("klinks/%s", klink.Identifier)
+
+		s.notifyKlinkMembers(klink, CapKlinkMemberManage, "K-Link "+klink.Name+" is "+check.Status, text)
+	}
+
+	if err := s.store.DeleteHealthChecksBefore(now.Add(-healthHistoryRetention).Unix()); err != nil {
+		s.logger.WithError(err).Error("Error removing old health checks")
+	}
+}
+
+// probeKlink requests the health-check URL of a K-Link. The K-Link is up if
+// it responds with a 2xx status code in time; redirects are not followed.
+// The history is shown to the viewers of the K-Link, so connection errors
+// are only logged and stored as a generic error.
+func (s *Server) probeKlink(klink *Klink, now time.Time) *HealthCheck {
+	check := &HealthCheck{KlinkID: klink.ID, CheckedAt: now.Unix(), Status: HealthDown}
+
+	start := time.Now()
+	resp, err := s.prober.Get(klink.HealthURL)
+	check.Latency = int64(time.Since(start) / time.Millisecond)
+	if err != nil {
+		s.logger.WithError(err).WithField("klink", klink.Identifier).Info("Health check failed")
+
+		check.Error = "The health-check URL could not be reached"
+		if err, ok := err.(net.Error); ok && err.Timeout() {
+			check.Error = "The health check timed out"
+		}
+		return check
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1024))
+
+	check.StatusCode = resp.StatusCode
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		check.Error = "unexpected status " + resp.Status
+		return check
+	}
+
+	check.Status = HealthUp
+	return check
+}
+
+// truncate shortens s to at most n bytes
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// handleListHealthChecks provides an endpoint that returns the latest health
+// checks of a klink, newest first
+func (s *Server) handleListHealthChecks() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		responses := []HealthCheckModel{}
+
+		klink, err := s.store.GetKlinkByIdentifier(chi.URLParam(req, "id"))
+		if s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrNotFound)
+			return
+		} else if err != nil {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		if !s.canInKlink(s.sessions.GetUser(req), klink, CapKlinkView) {
+			jsonResponse(w, API2ErrForbidden)
+			return
+		}
+
+		checks, err := s.store.ListHealthChecks(klink.ID, healthHistoryLength)
+		if err != nil && !s.store.IsNotFound(err) {
+			jsonResponse(w, API2ErrDatabase)
+			return
+		}
+
+		for _, check := range checks {
+			responses = append(responses, HealthCheckModel(*check))
+		}
+		jsonResponse(w, responses)
+	}
+}
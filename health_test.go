@@ -0,0 +1,151 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCheckKlinksHealth(t *testing.T) {
+	s, store := newTestServer(t)
+	mailer := &recordingMailer{}
+	s.email = mailer
+
+	status := http.StatusOK
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer ts.Close()
+	store.klinks[testKlinkID].HealthURL = ts.URL
+
+	now := time.Now()
+	steps := []struct {
+		status int
+		health string
+		alerts int
+	}{
+		{http.StatusOK, HealthUp, 0},
+		{http.StatusServiceUnavailable, HealthDown, 1},
+		{http.StatusInternalServerError, HealthDown, 1},
+		{http.StatusOK, HealthUp, 2},
+	}
+
+	for i, step := range steps {
+		status = step.status
+		s.checkKlinksHealth(now.Add(time.Duration(i) * time.Minute))
+
+		if health := store.klinks[testKlinkID].HealthStatus; health != step.health {
+			t.Errorf("step %d: expected health %q, got %q", i, step.health, health)
+		}
+		if len(mailer.recipients) != step.alerts {
+			t.Errorf("step %d: expected %d alerts, got %v", i, step.alerts, mailer.recipients)
+		}
+	}
+
+	// only the manager is alerted, not the curator
+	for _, recipient := range mailer.recipients {
+		if recipient != "admin@example.com" {
+			t.Errorf("expected only the manager to be alerted, got %s", recipient)
+		}
+	}
+
+	checks, _ := store.ListHealthChecks(testKlinkID, healthHistoryLength)
+	if len(checks) != len(steps) {
+		t.Fatalf("expected %d health checks, got %d", len(steps), len(checks))
+	}
+	if checks[0].Status != HealthUp || checks[1].StatusCode != http.StatusInternalServerError || checks[1].Error == "" {
+		t.Errorf("expected the history to be newest first, got %+v, %+v", checks[0], checks[1])
+	}
+}
+
+func TestCheckKlinksHealthUnreachable(t *testing.T) {
+	s, store := newTestServer(t)
+	mailer := &recordingMailer{}
+	s.email = mailer
+
+	ts := httptest.NewServer(http.NotFoundHandler())
+	ts.Close()
+	store.klinks[testKlinkID].HealthURL = ts.URL
+
+	s.checkKlinksHealth(time.Now())
+
+	if health := store.klinks[testKlinkID].HealthStatus; health != HealthDown {
+		t.Errorf("expected an unreachable K-Link to be down, got %q", health)
+	}
+	if len(mailer.recipients) != 1 {
+		t.Errorf("expected the manager to be alerted, got %v", mailer.recipients)
+	}
+
+	// the error is shown to viewers, so it must not contain the address
+	checks, _ := store.ListHealthChecks(testKlinkID, healthHistoryLength)
+	if len(checks) != 1 || checks[0].Error != "The health-check URL could not be reached" {
+		t.Errorf("expected a generic error, got %+v", checks)
+	}
+}
+
+func TestCheckKlinksHealthRedirect(t *testing.T) {
+	s, store := newTestServer(t)
+	s.email = &recordingMailer{}
+
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {}))
+	defer target.Close()
+	ts := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	defer ts.Close()
+	store.klinks[testKlinkID].HealthURL = ts.URL
+
+	s.checkKlinksHealth(time.Now())
+
+	checks, _ := store.ListHealthChecks(testKlinkID, healthHistoryLength)
+	if len(checks) != 1 || checks[0].Status != HealthDown || checks[0].StatusCode != http.StatusFound {
+		t.Errorf("expected the redirect not to be followed, got %+v", checks)
+	}
+}
+
+func TestListHealthChecks(t *testing.T) {
+	s, store := newTestServer(t)
+	now := time.Now()
+	store.CreateHealthCheck(&HealthCheck{KlinkID: testKlinkID, CheckedAt: now.Add(-healthHistoryRetention).Unix() - 1, Status: HealthDown})
+	store.CreateHealthCheck(&HealthCheck{KlinkID: testKlinkID, CheckedAt: now.Unix(), Status: HealthUp, StatusCode: 200})
+
+	// the prober removes expired history, even without health-check URLs
+	s.checkKlinksHealth(now)
+
+	if rec := serve(t, s, store, testAliceID, "GET", "/api/2.0/klinks/k-admin/health", ""); rec.Code != 403 {
+		t.Errorf("expected non-members to be unable to see the health history, got %d", rec.Code)
+	}
+
+	rec := serve(t, s, store, testCarolID, "GET", "/api/2.0/klinks/k-admin/health", "")
+	if rec.Code != 200 {
+		t.Fatalf("expected members to see the health history, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var checks []HealthCheckModel
+	if err := json.Unmarshal(rec.Body.Bytes(), &checks); err != nil {
+		t.Fatal(err)
+	}
+	if len(checks) != 1 || checks[0].Status != HealthUp {
+		t.Errorf("expected the recent health check only, got %+v", checks)
+	}
+}
+
+func TestUpdateKlinkHealthURL(t *testing.T) {
+	s, store := newTestServer(t)
+	store.SetKlinkHealth(testKlinkID, HealthDown, time.Now().Unix())
+
+	body := `{"name":"K-Link","active":true,"health_url":"ftp://k-link.example.com"}`
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/klinks/k-admin", body); rec.Code != 422 {
+		t.Errorf("expected an invalid health-check URL to be rejected, got %d", rec.Code)
+	}
+
+	body = `{"name":"K-Link","active":true,"health_url":"https://k-link.example.com/health","health_status":"up"}`
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/klinks/k-admin", body); rec.Code != 200 {
+		t.Fatalf("expected the health-check URL to be updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	klink := store.klinks[testKlinkID]
+	if klink.HealthURL != "https://k-link.example.com/health" || klink.HealthStatus != "" {
+		t.Errorf("expected a new URL to reset the health, got %q with %q", klink.HealthURL, klink.HealthStatus)
+	}
+}
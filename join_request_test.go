@@ -0,0 +1,77 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+)
+
+func TestJoinRequest(t *testing.T) {
+	s, store := newTestServer(t)
+	mailer := &recordingMailer{}
+	s.email = mailer
+	store.CreateKlink(&Klink{Identifier: "k-inactive", Name: "Inactive", Active: false})
+
+	// alice can browse the active klinks only
+	rec := serve(t, s, store, testAliceID, "GET", "/api/2.0/klinks/", "")
+	var klinks []KlinkModel
+	json.Unmarshal(rec.Body.Bytes(), &klinks)
+	if len(klinks) != 1 || klinks[0].Identifier != testKlinkIdentifier {
+		t.Errorf("expected alice to see the active K-Link, got %+v", klinks)
+	}
+
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/klinks/k-inactive/join-requests", `{"justification":"research"}`); rec.Code != 404 {
+		t.Errorf("expected inactive K-Links to be hidden, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testCarolID, "POST", "/api/2.0/klinks/k-admin/join-requests", `{"justification":"research"}`); rec.Code != 409 {
+		t.Errorf("expected members to be rejected, got %d", rec.Code)
+	}
+	rec = serve(t, s, store, testAliceID, "POST", "/api/2.0/klinks/k-admin/join-requests", `{"justification":"research"}`)
+	if rec.Code != 200 {
+		t.Fatalf("expected the join request to be created, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/klinks/k-admin/join-requests", `{"justification":"again"}`); rec.Code != 409 {
+		t.Errorf("expected a second pending request to be rejected, got %d", rec.Code)
+	}
+
+	// the manager and alice are notified
+	if len(mailer.recipients) != 2 || mailer.recipients[0] != "admin@example.com" || mailer.recipients[1] != "alice@example.com" {
+		t.Errorf("expected the manager and the registrant to be notified, got %v", mailer.recipients)
+	}
+
+	var joinRequest JoinRequestModel
+	json.Unmarshal(rec.Body.Bytes(), &joinRequest)
+	approve := "/api/2.0/klinks/k-admin/join-requests/" + strconv.FormatInt(joinRequest.ID, 10) + "/approve"
+
+	if rec := serve(t, s, store, testCarolID, "POST", approve, ""); rec.Code != 403 {
+		t.Errorf("expected curators to be forbidden, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "POST", approve, `{"reason":"welcome"}`); rec.Code != 200 {
+		t.Fatalf("expected the manager to approve, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, s, store, testAdminID, "POST", approve, ""); rec.Code != 409 {
+		t.Errorf("expected the request to be decided once, got %d", rec.Code)
+	}
+
+	member, err := store.GetKlinkMember(testKlinkID, testAliceID)
+	if err != nil || member.Role != KlinkRoleViewer {
+		t.Errorf("expected alice to be a viewer, got %+v (%v)", member, err)
+	}
+	if last := mailer.recipients[len(mailer.recipients)-1]; last != "alice@example.com" {
+		t.Errorf("expected alice to be notified of the decision, got %v", mailer.recipients)
+	}
+
+	var history []JoinRequestModel
+	rec = serve(t, s, store, testAdminID, "GET", "/api/2.0/klinks/k-admin/join-requests?status=approved", "")
+	json.Unmarshal(rec.Body.Bytes(), &history)
+	if len(history) != 1 || history[0].Reason != "welcome" {
+		t.Errorf("expected the history to contain the decision, got %+v", history)
+	}
+
+	var own []JoinRequestModel
+	rec = serve(t, s, store, testAliceID, "GET", "/api/2.0/join-requests/", "")
+	json.Unmarshal(rec.Body.Bytes(), &own)
+	if len(own) != 1 || own[0].Klink != testKlinkIdentifier {
+		t.Errorf("expected alice to see the own request, got %+v", own)
+	}
+}
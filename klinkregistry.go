@@ -9,6 +9,7 @@ import (
 	"github.com/k-box/k-link-registry/assets"
 	"github.com/k-box/k-link-registry/mail"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 // Version will be set automatically on release builds, using a build
@@ -53,22 +54,81 @@ type Config struct {
 	AdminPassword string
 
 	EnableUserRegistration bool // enable or disable user registration from the UI
+
+	AllowInactiveApplications bool // authenticate deactivated applications
+	AllowInactiveKlinks       bool // return deactivated K-Links to applications
+	DenyInactiveOwners        bool // deny applications of deactivated registrants
+
+	AllowUnverifiedApplications bool          // authenticate applications whose domain is not verified
+	VerificationTimeout         time.Duration // timeout of a domain verification
+
+	ExpiryReminderDays  int           // remind owners this many days before their application expires
+	ExpiryCheckInterval time.Duration // interval of the expiry reminder job, disabled if 0
+
+	HealthCheckInterval time.Duration // interval of the K-Link health prober, disabled if 0
+	HealthCheckTimeout  time.Duration // timeout of a single K-Link health check
+
+	FederationSyncInterval time.Duration // interval of pulling the changes of peers, disabled if 0
+
+	WebhookRetryInterval time.Duration // interval of retrying webhook deliveries, disabled if 0
+
+	CacheSize int           // entries of the in-process cache of application lookups, disabled if 0
+	CacheTTL  time.Duration // expiry of cached entries, never if 0
+	Cache     Cache         // cache used instead of the in-process cache, e.g. a shared one
+
+	RateLimitPerIP             int            // requests per minute per client IP on each of the login, registration and event stream endpoints, unlimited if 0
+	RateLimitAuthenticatePerIP int            // application.authenticate calls per minute per client IP, unlimited if 0
+	RateLimitPerApplication    int            // application.authenticate calls per minute per application URL and client IP, unlimited if 0
+	RateLimitPerEmail          int            // registrations per hour per email address, and logins per email address and client IP, unlimited if 0
+	RateLimitTrustProxy        bool           // take the client IP from the X-Forwarded-For and X-Real-IP headers
+	RateLimitStore             RateLimitStore // store used instead of the in-memory one, e.g. a shared one
+
+	MetricsListen string // address of a separate listener for /metrics, served by the HTTP listener if empty
+
+	LogFormat string         // "json" or "logfmt" (default)
+	LogLevel  string         // minimum level of logged entries, "info" by default
+	Logger    *logrus.Logger // logger used instead of one built from LogFormat and LogLevel
+
+	ReadyCheckMailer bool // check that the mail server is reachable in /readyz
+
+	Roles      map[string][]string // capabilities per role, overrides DefaultRoles
+	KlinkRoles map[string][]string // capabilities per K-Link role, overrides DefaultKlinkRoles
 }
 
 // Server is a struct that serves the Web application
 type Server struct {
-	assets   http.FileSystem
-	router   http.Handler
-	email    Emailer
-	store    Storer
-	config   *Config
-	sessions SessionsProvider
+	assets      http.FileSystem
+	router      http.Handler
+	email       Emailer
+	store       Storer
+	config      *Config
+	sessions    SessionsProvider
+	policy      *Policy
+	verifier    *DomainVerifier
+	prober      *http.Client
+	federation  *http.Client
+	webhooks    *http.Client
+	webhookWake chan struct{}
+	events      *eventHub
+	rateLimits  RateLimitStore
+	metrics     *metrics
+	logger      *logrus.Logger
 }
 
 // SetStore is a setter for setting a database inside the application.
 // this was originally named `initDatabase`, but caused a cyclic dependency
 // FIXME
+// The store is wrapped by a CachedStore if a cache is configured.
 func (s *Server) SetStore(store Storer) error {
+	cache := s.config.Cache
+	if cache == nil && s.config.CacheSize > 0 {
+		cache = NewLRUCache(s.config.CacheSize, s.config.CacheTTL)
+	}
+
+	if cache != nil {
+		store = NewCachedStore(store, cache)
+	}
+
 	s.store = store
 	return nil
 }
@@ -102,6 +162,10 @@ func NewServer(config *Config) (*Server, error) {
 	s := &Server{}
 	s.config = config
 
+	if err := s.initLogger(); err != nil {
+		return nil, err
+	}
+
 	// if no assets dir is specified, use the internally packaged assets.
 	// otherwise initialize the external assets file.
 	if s.config.AssetDir == "" {
@@ -118,12 +182,52 @@ func NewServer(config *Config) (*Server, error) {
 		s.sessions = &JWTSession{Key: key}
 	}
 
+	s.policy = NewPolicy(s.config.Roles, s.config.KlinkRoles)
+
+	timeout := s.config.VerificationTimeout
+	if timeout == 0 {
+		timeout = 10 * time.Second
+	}
+	s.verifier = NewDomainVerifier(timeout)
+
+	healthTimeout := s.config.HealthCheckTimeout
+	if healthTimeout == 0 {
+		healthTimeout = 10 * time.Second
+	}
+	s.prober = &http.Client{
+		Timeout: healthTimeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	s.federation = &http.Client{Timeout: 30 * time.Second}
+	s.webhooks = &http.Client{Timeout: 10 * time.Second}
+	s.webhookWake = make(chan struct{}, 1)
+	s.events = newEventHub()
+
+	s.rateLimits = s.config.RateLimitStore
+	if s.rateLimits == nil {
+		s.rateLimits = NewMemoryRateLimitStore()
+	}
+
+	s.metrics = newMetrics()
+
 	s.initSMTP()
+	s.email = &meteredEmailer{Emailer: s.email, emails: s.metrics.emails, logger: s.logger}
 	s.initRoutes()
 
 	return s, nil
 }
 
+// writeTimeout returns the configured HTTP write timeout, 10 seconds by
+// default
+func (s *Server) writeTimeout() time.Duration {
+	if s.config.HTTPWriteTimeout > 0 {
+		return s.config.HTTPWriteTimeout
+	}
+	return 10 * time.Second
+}
+
 // Run starts serving of the HTTP Endpoints
 func (s Server) Run() error {
 	if s.router == nil {
@@ -131,7 +235,10 @@ func (s Server) Run() error {
 	}
 
 	readTimeout := 10 * time.Second
-	writeTimeout := readTimeout
+	if s.config.HTTPReadTimeout > 0 {
+		readTimeout = s.config.HTTPReadTimeout
+	}
+	writeTimeout := s.writeTimeout()
 
 	server := http.Server{
 		Addr:           s.config.HTTPListen,
@@ -141,5 +248,31 @@ func (s Server) Run() error {
 		MaxHeaderBytes: 1 << 20,
 	}
 
+	if s.config.ExpiryCheckInterval > 0 {
+		go s.runExpiryReminders(s.config.ExpiryCheckInterval)
+	}
+
+	if s.config.HealthCheckInterval > 0 {
+		go s.runHealthChecks(s.config.HealthCheckInterval)
+	}
+
+	if s.config.FederationSyncInterval > 0 {
+		go s.runFederationSync(s.config.FederationSyncInterval)
+	}
+
+	if s.config.WebhookRetryInterval > 0 {
+		go s.runWebhookDeliveries(s.config.WebhookRetryInterval)
+	}
+
+	if s.config.MetricsListen != "" {
+		metricsMux := http.NewServeMux()
+		metricsMux.Handle("/metrics", s.handleMetrics())
+
+		go func() {
+			err := http.ListenAndServe(s.config.MetricsListen, metricsMux)
+			s.logger.WithError(err).Fatal("Error serving metrics")
+		}()
+	}
+
 	return server.ListenAndServe()
 }
@@ -3,15 +3,15 @@ package cmd
 import (
 	"database/sql"
 	"fmt"
-	"log"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 
 	klinkregistry "github.com/k-box/k-link-registry"
 	"github.com/k-box/k-link-registry/assets"
 	"github.com/k-box/k-link-registry/database/mysql"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
@@ -55,11 +55,16 @@ func init() {
 	rootCmd.AddCommand(migrateCmd)
 }
 
-type wrappedLogger struct {
-	*log.Logger
+// migrateLogger passes the messages of the migrator to a logrus logger
+type migrateLogger struct {
+	logrus.FieldLogger
 }
 
-func (l wrappedLogger) Verbose() bool {
+func (l migrateLogger) Printf(format string, v ...interface{}) {
+	l.Info(strings.TrimSpace(fmt.Sprintf(format, v...)))
+}
+
+func (l migrateLogger) Verbose() bool {
 	return true
 }
 
@@ -75,7 +80,7 @@ func migrate(config *klinkregistry.Config, command string) error {
 		migrationPathInFs = "/mysql"
 	}
 
-	log.Println("Running migration command")
+	logger.Info("Running migration command")
 
 	dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?multiStatements=true",
 		config.DatabaseUser, config.DatabasePassword,
@@ -83,18 +88,17 @@ func migrate(config *klinkregistry.Config, command string) error {
 
 	db, err := sql.Open("mysql", dsn)
 	if err != nil {
-		log.Printf("Error opening connection to database: %s", err.Error())
+		logger.Errorf("Error opening connection to database: %s", err.Error())
 		panic(err)
 	}
 
 	migrator, err := mysql.GetMigrator(db, fs, migrationPathInFs)
 	if err != nil {
-		log.Printf("Error initializing migrations: %s", err.Error())
+		logger.Errorf("Error initializing migrations: %s", err.Error())
 		return errors.Wrap(err, "Error creating migrator instance")
 	}
 
-	wl := wrappedLogger{log.New(os.Stdout, "", log.LstdFlags)}
-	migrator.Log = wl
+	migrator.Log = migrateLogger{logger}
 
 	var mErr error // migration error
 
@@ -102,7 +106,7 @@ func migrate(config *klinkregistry.Config, command string) error {
 	case "info":
 		version, dirty, err := migrator.Version()
 		if err != nil {
-			log.Printf("%s", err.Error())
+			logger.Error(err.Error())
 			return errors.Wrap(err, "Error getting migrator info")
 		}
 		fmt.Printf("\nDatabase revision: %d, Dirty: %t\n", version, dirty)
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"fmt"
+
+	klinkregistry "github.com/k-box/k-link-registry"
+	"github.com/k-box/k-link-registry/database/mysql"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// permissionCmd represents the permission command
+var permissionCmd = &cobra.Command{
+	Use:   "permission",
+	Short: "List, add, update or remove permissions",
+	Long: `Permission manages the catalogue of permissions applications may request.
+  * list shows all permissions
+  * add creates a new permission
+  * update changes the description, implied permissions or deprecation flag
+    of a permission
+  * del removes a permission, if it is not built-in and not granted anymore`,
+	Example: `  klinkregistry permission list
+  klinkregistry permission add data-export --description "Export data" --implies data-view
+  klinkregistry permission update data-export --deprecated
+  klinkregistry permission del data-export`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) < 1 || (args[0] != "list" && len(args) != 2) {
+			cmd.Help()
+			return
+		}
+
+		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?multiStatements=true",
+			viper.GetString("db_user"), viper.GetString("db_pass"),
+			viper.GetString("db_host"), viper.GetString("db_name"))
+		db, err := mysql.NewDatabase(dsn, logger)
+		if err != nil {
+			logger.Fatalf("Error creating Database: %s", err)
+		}
+
+		description, _ := cmd.Flags().GetString("description")
+		deprecated, _ := cmd.Flags().GetBool("deprecated")
+		implies, _ := cmd.Flags().GetStringSlice("implies")
+
+		switch args[0] {
+		case "list":
+			permissions, err := db.ListPermissions()
+			if err != nil {
+				logger.Fatalf("Error listing permissions: %s", err)
+			}
+			for _, p := range permissions {
+				status := ""
+				if p.Deprecated {
+					status = " (deprecated)"
+				}
+				fmt.Printf("%s%s\t%s\n", p.Name, status, p.Description)
+			}
+		case "add":
+			if !klinkregistry.IsValidPermissionName(args[1]) {
+				logger.Fatalf("Invalid permission name %s: use lowercase letters, digits, dots and dashes", args[1])
+			}
+			checkImplies(db, args[1], implies)
+
+			p := &klinkregistry.Permission{Name: args[1], Description: description, Implies: implies, Deprecated: deprecated}
+			if err := db.CreatePermission(p); err != nil {
+				logger.Fatalf("Error creating permission: %s", err)
+			}
+		case "update":
+			p, err := db.GetPermission(args[1])
+			if err != nil {
+				logger.Fatalf("Error querying for permission: %s", err)
+			}
+			if cmd.Flags().Changed("description") {
+				p.Description = description
+			}
+			if cmd.Flags().Changed("implies") {
+				checkImplies(db, p.Name, implies)
+				p.Implies = implies
+			}
+			if cmd.Flags().Changed("deprecated") {
+				p.Deprecated = deprecated
+			}
+			if err := db.UpdatePermission(p); err != nil {
+				logger.Fatalf("Error updating permission: %s", err)
+			}
+		case "del":
+			if klinkregistry.IsBuiltInPermission(args[1]) {
+				logger.Fatalf("Built-in permission %s cannot be deleted", args[1])
+			}
+			grants, err := db.CountPermissionGrants(args[1])
+			if err != nil {
+				logger.Fatalf("Error querying for grants: %s", err)
+			}
+			if grants > 0 {
+				logger.Fatalf("Permission %s is still granted %d times", args[1], grants)
+			}
+			if err := db.DeletePermission(args[1]); err != nil {
+				logger.Fatalf("Error deleting permission: %s", err)
+			}
+		default:
+			fmt.Printf("Unknown command: %s\n", args[0])
+			return
+		}
+	},
+}
+
+// checkImplies exits if the permission implies itself or an unknown
+// permission
+func checkImplies(db klinkregistry.Storer, name string, implies []string) {
+	ok, err := klinkregistry.CheckImplies(db, name, implies)
+	if err != nil {
+		logger.Fatalf("Error listing permissions: %s", err)
+	}
+	if !ok {
+		logger.Fatalf("Permission %s may only imply other existing permissions", name)
+	}
+}
+
+func init() {
+	rootCmd.AddCommand(permissionCmd)
+
+	permissionCmd.Flags().String("description", "", "Description of the permission")
+	permissionCmd.Flags().StringSlice("implies", nil, "Permissions that are granted together with the permission")
+	permissionCmd.Flags().Bool("deprecated", false, "Deprecated permissions cannot be requested anymore")
+}
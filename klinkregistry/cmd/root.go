@@ -16,16 +16,20 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 	"os"
 
 	klinkregistry "github.com/k-box/k-link-registry"
+	"github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 )
 
 var cfgFile string
 
+// logger is used by all commands. It is configured with the log format and
+// level once the configuration is read.
+var logger = logrus.New()
+
 // rootCmd represents the base command when called without any subcommands
 var rootCmd = &cobra.Command{
 	Use:   "klinkregistry",
@@ -104,7 +108,15 @@ func initConfig() {
 	viper.AutomaticEnv() // read in environment variables that match
 
 	// If a config file is found, read it in.
-	if err := viper.ReadInConfig(); err == nil {
-		log.Printf("Using config file: %s", viper.ConfigFileUsed())
+	configErr := viper.ReadInConfig()
+
+	configured, err := klinkregistry.NewLogger(os.Stderr, viper.GetString("log_format"), viper.GetString("log_level"))
+	if err != nil {
+		logger.Fatalf("Error configuring logger: %s", err)
+	}
+	logger = configured
+
+	if configErr == nil {
+		logger.Infof("Using config file: %s", viper.ConfigFileUsed())
 	}
 }
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"fmt"
-	"log"
 	"path"
 	"time"
 
@@ -15,18 +14,6 @@ import (
 	"github.com/spf13/viper"
 )
 
-var (
-	// DefaultPermissions contains the default permissions handled by the registry
-	DefaultPermissions = []string{
-		"data-add",
-		"data-edit",
-		"data-remove-all",
-		"data-remove-own",
-		"data-search",
-		"data-view",
-	}
-)
-
 // serverCmd represents the serve command
 var serverCmd = &cobra.Command{
 	Use:     "server",
@@ -37,28 +24,54 @@ for Authentication by K-Link services, as well as
 configuration by registrants.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		c := &klinkregistry.Config{
-			AssetDir:               viper.GetString("assets_dir"),
-			HTTPListen:             viper.GetString("http_listen"),
-			HTTPDomain:             viper.GetString("http_domain"),
-			HTTPReadTimeout:        viper.GetDuration("http_read_timeout"),
-			HTTPWriteTimeout:       viper.GetDuration("http_write_timeout"),
-			HTTPMaxHeader:          viper.GetInt("http_max_header"),
-			HTTPSecret:             viper.GetString("http_secret"),
-			DatabaseHost:           viper.GetString("db_host"),
-			DatabasePort:           viper.GetInt("db_port"),
-			DatabaseUser:           viper.GetString("db_user"),
-			DatabasePassword:       viper.GetString("db_pass"),
-			DatabaseName:           viper.GetString("db_name"),
-			SMTPHost:               viper.GetString("smtp_host"),
-			SMTPPort:               viper.GetInt("smtp_port"),
-			SMTPUser:               viper.GetString("smtp_user"),
-			SMTPPassword:           viper.GetString("smtp_pass"),
-			SMTPFrom:               viper.GetString("smtp_from"),
-			SMTPAllowInsecure:      viper.GetBool("smtp_allow_insecure"),
-			NetworkName:            viper.GetString("name"),
-			AdminUsername:          viper.GetString("admin_username"),
-			AdminPassword:          viper.GetString("admin_password"),
-			EnableUserRegistration: viper.GetBool("enable_user_registration"),
+			AssetDir:                    viper.GetString("assets_dir"),
+			MigrationsDir:               viper.GetString("migrations_dir"),
+			HTTPListen:                  viper.GetString("http_listen"),
+			HTTPDomain:                  viper.GetString("http_domain"),
+			HTTPReadTimeout:             viper.GetDuration("http_read_timeout"),
+			HTTPWriteTimeout:            viper.GetDuration("http_write_timeout"),
+			HTTPMaxHeader:               viper.GetInt("http_max_header"),
+			HTTPSecret:                  viper.GetString("http_secret"),
+			DatabaseHost:                viper.GetString("db_host"),
+			DatabasePort:                viper.GetInt("db_port"),
+			DatabaseUser:                viper.GetString("db_user"),
+			DatabasePassword:            viper.GetString("db_pass"),
+			DatabaseName:                viper.GetString("db_name"),
+			SMTPHost:                    viper.GetString("smtp_host"),
+			SMTPPort:                    viper.GetInt("smtp_port"),
+			SMTPUser:                    viper.GetString("smtp_user"),
+			SMTPPassword:                viper.GetString("smtp_pass"),
+			SMTPFrom:                    viper.GetString("smtp_from"),
+			SMTPAllowInsecure:           viper.GetBool("smtp_allow_insecure"),
+			NetworkName:                 viper.GetString("name"),
+			AdminUsername:               viper.GetString("admin_username"),
+			AdminPassword:               viper.GetString("admin_password"),
+			EnableUserRegistration:      viper.GetBool("enable_user_registration"),
+			AllowInactiveApplications:   viper.GetBool("allow_inactive_applications"),
+			AllowInactiveKlinks:         viper.GetBool("allow_inactive_klinks"),
+			DenyInactiveOwners:          viper.GetBool("deny_inactive_owners"),
+			AllowUnverifiedApplications: viper.GetBool("allow_unverified_applications"),
+			VerificationTimeout:         viper.GetDuration("verification_timeout"),
+			ExpiryReminderDays:          viper.GetInt("expiry_reminder_days"),
+			ExpiryCheckInterval:         viper.GetDuration("expiry_check_interval"),
+			HealthCheckInterval:         viper.GetDuration("health_check_interval"),
+			HealthCheckTimeout:          viper.GetDuration("health_check_timeout"),
+			FederationSyncInterval:      viper.GetDuration("federation_sync_interval"),
+			WebhookRetryInterval:        viper.GetDuration("webhook_retry_interval"),
+			CacheSize:                   viper.GetInt("cache_size"),
+			CacheTTL:                    viper.GetDuration("cache_ttl"),
+			RateLimitPerIP:              viper.GetInt("rate_limit_ip"),
+			RateLimitAuthenticatePerIP:  viper.GetInt("rate_limit_authenticate_ip"),
+			RateLimitPerApplication:     viper.GetInt("rate_limit_application"),
+			RateLimitPerEmail:           viper.GetInt("rate_limit_email"),
+			RateLimitTrustProxy:         viper.GetBool("rate_limit_trust_proxy"),
+			MetricsListen:               viper.GetString("metrics_listen"),
+			LogFormat:                   viper.GetString("log_format"),
+			LogLevel:                    viper.GetString("log_level"),
+			ReadyCheckMailer:            viper.GetBool("ready_check_mailer"),
+			Roles:                       viper.GetStringMapStringSlice("roles"),
+			KlinkRoles:                  viper.GetStringMapStringSlice("klink_roles"),
+			Logger:                      logger,
 		}
 
 		// Set base path, strip trailing slash, "/" will become ""
@@ -68,44 +81,45 @@ configuration by registrants.`,
 
 		s, err := klinkregistry.NewServer(c)
 		if err != nil {
-			log.Fatalf("Error while initializing server: %s", err)
+			logger.Fatalf("Error while initializing server: %s", err)
 		}
 
 		// set database here, to avoid cyclic dependencies (FIXME)
 		dsn := fmt.Sprintf("%s:%s@tcp(%s)/%s?multiStatements=true",
 			c.DatabaseUser, c.DatabasePassword,
 			c.DatabaseHost, c.DatabaseName)
-		db, err := mysql.NewDatabase(dsn)
+		db, err := mysql.NewDatabase(dsn, logger)
 		if err != nil {
-			log.Printf("Error creating Database: %s", err.Error())
+			logger.Errorf("Error creating Database: %s", err.Error())
 			panic(err)
 		}
+		db.SetQueryObserver(s.ObserveQuery)
 
 		// try to migrate to latest database revision
 		if err := migrate(c, "up"); err != nil {
-			log.Printf("Error running initial migration: %s", err)
+			logger.Errorf("Error running initial migration: %s", err)
 		}
 
 		// try to create admin user, if specified
 		if c.AdminUsername != "" && c.AdminPassword != "" {
 			err := createAdminIfNotExist(db, c.AdminUsername, c.AdminPassword)
 			if err != nil {
-				log.Printf("Error creating admin user: %s", err)
+				logger.Errorf("Error creating admin user: %s", err)
 			}
 		}
 
-		// try to create default permissions
-		err = createPermissionsIfNotExist(db, DefaultPermissions)
+		// create missing built-in permissions, e.g. after an upgrade
+		err = klinkregistry.ReconcilePermissions(db, klinkregistry.DefaultPermissions)
 		if err != nil {
-			log.Printf("Error creating default permissions: %s", err)
+			logger.Errorf("Error reconciling built-in permissions: %s", err)
 		}
 
 		s.SetStore(db)
 
-		log.Println("Registry waiting for connections...")
+		logger.Info("Registry waiting for connections...")
 
 		if err := s.Run(); err != nil {
-			log.Fatalf("Error running server: %s", err)
+			logger.Fatalf("Error running server: %s", err)
 		}
 	},
 }
@@ -123,6 +137,28 @@ func init() {
 	serverCmd.Flags().String("name", "K-Link Registry", "Name of this instance")
 	serverCmd.Flags().String("admin-username", "", "email address of primary admin")
 	serverCmd.Flags().String("admin-password", "", "password of primary admin")
+	serverCmd.Flags().Bool("allow-inactive-applications", false, "Authenticate applications that are not active")
+	serverCmd.Flags().Bool("allow-inactive-klinks", false, "Return K-Links that are not active to applications")
+	serverCmd.Flags().Bool("deny-inactive-owners", false, "Deny applications whose owner is not active")
+	serverCmd.Flags().Bool("allow-unverified-applications", false, "Authenticate applications whose domain is not verified")
+	serverCmd.Flags().Duration("verification-timeout", 10*time.Second, "Timeout of a domain verification")
+	serverCmd.Flags().Int("expiry-reminder-days", 14, "Remind owners this many days before their application expires")
+	serverCmd.Flags().Duration("expiry-check-interval", time.Hour, "Interval for checking expiring applications, 0 disables reminders")
+	serverCmd.Flags().Duration("health-check-interval", 5*time.Minute, "Interval for probing the health of K-Links, 0 disables the prober")
+	serverCmd.Flags().Duration("health-check-timeout", 10*time.Second, "Timeout of a single K-Link health check")
+	serverCmd.Flags().Duration("federation-sync-interval", 5*time.Minute, "Interval for pulling the changes of peer registries, 0 disables the synchronisation")
+	serverCmd.Flags().Duration("webhook-retry-interval", time.Minute, "Interval for retrying failed webhook deliveries, 0 disables the deliveries")
+	serverCmd.Flags().Int("cache-size", 1000, "Number of application lookups cached in memory, 0 disables the cache")
+	serverCmd.Flags().Duration("cache-ttl", time.Minute, "Expiry of cached application lookups")
+	serverCmd.Flags().Int("rate-limit-ip", 60, "Requests per minute per client IP on each of the login, registration and event stream endpoints, 0 disables the limit")
+	serverCmd.Flags().Int("rate-limit-authenticate-ip", 6000, "application.authenticate calls per minute per client IP, 0 disables the limit")
+	serverCmd.Flags().Int("rate-limit-application", 600, "application.authenticate calls per minute per application URL and client IP, 0 disables the limit")
+	serverCmd.Flags().Int("rate-limit-email", 5, "Registrations per hour per email address, and logins per email address and client IP, 0 disables the limit")
+	serverCmd.Flags().Bool("rate-limit-trust-proxy", false, "Take the client IP from the last X-Forwarded-For entry or the X-Real-IP header, set by the proxy in front of the registry")
+	serverCmd.Flags().String("metrics-listen", "", "Separate address to serve the Prometheus metrics on, served on the HTTP address if empty")
+	serverCmd.Flags().String("log-format", "logfmt", "Format of the logs, \"json\" or \"logfmt\"")
+	serverCmd.Flags().String("log-level", "info", "Minimum level of logged entries: debug, info, warn or error")
+	serverCmd.Flags().Bool("ready-check-mailer", false, "Check that the mail server is reachable in /readyz")
 
 	viper.BindPFlag("http_listen", serverCmd.Flags().Lookup("http"))
 	viper.BindPFlag("http_read_timeout", serverCmd.Flags().Lookup("read-timeout"))
@@ -135,6 +171,29 @@ func init() {
 
 	viper.BindPFlag("admin_username", serverCmd.Flags().Lookup("admin-username"))
 	viper.BindPFlag("admin_password", serverCmd.Flags().Lookup("admin-password"))
+
+	viper.BindPFlag("allow_inactive_applications", serverCmd.Flags().Lookup("allow-inactive-applications"))
+	viper.BindPFlag("allow_inactive_klinks", serverCmd.Flags().Lookup("allow-inactive-klinks"))
+	viper.BindPFlag("deny_inactive_owners", serverCmd.Flags().Lookup("deny-inactive-owners"))
+	viper.BindPFlag("expiry_reminder_days", serverCmd.Flags().Lookup("expiry-reminder-days"))
+	viper.BindPFlag("allow_unverified_applications", serverCmd.Flags().Lookup("allow-unverified-applications"))
+	viper.BindPFlag("verification_timeout", serverCmd.Flags().Lookup("verification-timeout"))
+	viper.BindPFlag("expiry_check_interval", serverCmd.Flags().Lookup("expiry-check-interval"))
+	viper.BindPFlag("health_check_interval", serverCmd.Flags().Lookup("health-check-interval"))
+	viper.BindPFlag("health_check_timeout", serverCmd.Flags().Lookup("health-check-timeout"))
+	viper.BindPFlag("federation_sync_interval", serverCmd.Flags().Lookup("federation-sync-interval"))
+	viper.BindPFlag("webhook_retry_interval", serverCmd.Flags().Lookup("webhook-retry-interval"))
+	viper.BindPFlag("cache_size", serverCmd.Flags().Lookup("cache-size"))
+	viper.BindPFlag("cache_ttl", serverCmd.Flags().Lookup("cache-ttl"))
+	viper.BindPFlag("rate_limit_ip", serverCmd.Flags().Lookup("rate-limit-ip"))
+	viper.BindPFlag("rate_limit_authenticate_ip", serverCmd.Flags().Lookup("rate-limit-authenticate-ip"))
+	viper.BindPFlag("rate_limit_application", serverCmd.Flags().Lookup("rate-limit-application"))
+	viper.BindPFlag("rate_limit_email", serverCmd.Flags().Lookup("rate-limit-email"))
+	viper.BindPFlag("rate_limit_trust_proxy", serverCmd.Flags().Lookup("rate-limit-trust-proxy"))
+	viper.BindPFlag("metrics_listen", serverCmd.Flags().Lookup("metrics-listen"))
+	viper.BindPFlag("log_format", serverCmd.Flags().Lookup("log-format"))
+	viper.BindPFlag("log_level", serverCmd.Flags().Lookup("log-level"))
+	viper.BindPFlag("ready_check_mailer", serverCmd.Flags().Lookup("ready-check-mailer"))
 }
 
 func createAdminIfNotExist(db klinkregistry.Storer, username, password string) error {
@@ -158,20 +217,3 @@ func createAdminIfNotExist(db klinkregistry.Storer, username, password string) e
 
 	return nil
 }
-
-func createPermissionsIfNotExist(db klinkregistry.Storer, permissions []string) error {
-	perms, err := db.ListPermissions()
-	if db.IsNotFound(err) || len(perms) == 0 {
-		for _, permission := range permissions {
-			p := klinkregistry.Permission{Name: permission}
-			if err := db.CreatePermission(&p); err != nil {
-				return errors.Wrapf(err, "Error creating permission %s", permission)
-			}
-		}
-
-	} else if err != nil {
-		return errors.Wrap(err, "Error querying for permissions")
-	}
-
-	return nil
-}
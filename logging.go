@@ -0,0 +1,187 @@
+package klinkregistry
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// HeaderRequestID contains the ID of a request. It is taken from the
+// request if present, and returned with every response.
+const HeaderRequestID = "X-Request-ID"
+
+// RequestIDKey is the Key used for the request ID stored inside
+// Context.Value
+var RequestIDKey ContextKey = "request_id"
+
+// redacted replaces the values of sensitive log fields
+const redacted = "[REDACTED]"
+
+// sensitiveFields are log fields and URL parameters whose values are
+// redacted. Fields are matched if their name contains one of them.
+var sensitiveFields = []string{"password", "secret", "token", "authorization"}
+
+func isSensitive(field string) bool {
+	field = strings.ToLower(field)
+	for _, sensitive := range sensitiveFields {
+		if strings.Contains(field, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactingFormatter redacts the sensitive fields of an entry before it is
+// formatted
+type redactingFormatter struct {
+	logrus.Formatter
+}
+
+// Format formats a copy of the entry without sensitive values
+func (f redactingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data))
+	for key, value := range entry.Data {
+		if isSensitive(key) {
+			value = redacted
+		}
+		data[key] = value
+	}
+
+	copied := *entry
+	copied.Data = data
+	return f.Formatter.Format(&copied)
+}
+
+// NewLogger returns a logger writing to out in the "json" or "logfmt"
+// format, that logs entries of the level and above. Sensitive fields are
+// redacted.
+func NewLogger(out io.Writer, format, level string) (*logrus.Logger, error) {
+	logger := logrus.New()
+	logger.Out = out
+
+	switch format {
+	case "json":
+		logger.Formatter = redactingFormatter{&logrus.JSONFormatter{}}
+	case "logfmt", "":
+		logger.Formatter = redactingFormatter{&logrus.TextFormatter{DisableColors: true, FullTimestamp: true}}
+	default:
+		return nil, errors.Errorf("Unknown log format %q", format)
+	}
+
+	if level == "" {
+		level = "info"
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid log level")
+	}
+	logger.Level = parsed
+
+	return logger, nil
+}
+
+// initLogger sets the configured logger, or creates one logging to stderr
+func (s *Server) initLogger() error {
+	if s.config.Logger != nil {
+		s.logger = s.config.Logger
+		return nil
+	}
+
+	logger, err := NewLogger(os.Stderr, s.config.LogFormat, s.config.LogLevel)
+	if err != nil {
+		return err
+	}
+	s.logger = logger
+	return nil
+}
+
+// validRequestID accepts IDs of up to 128 letters, digits and separators,
+// so that clients cannot inject arbitrary content into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// identifyRequests provides a middleware that takes the request ID from the
+// X-Request-ID header or generates one. The ID is stored in the request
+// context and returned in the X-Request-ID header of the response.
+func (s *Server) identifyRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		id := req.Header.Get(HeaderRequestID)
+		if !validRequestID(id) {
+			random := make([]byte, 16)
+			rand.Read(random)
+			id = hex.EncodeToString(random)
+		}
+
+		w.Header().Set(HeaderRequestID, id)
+		ctx := context.WithValue(req.Context(), RequestIDKey, id)
+		next.ServeHTTP(w, req.WithContext(ctx))
+	})
+}
+
+// requestID returns the ID of the request, or an empty string
+func requestID(req *http.Request) string {
+	id, _ := req.Context().Value(RequestIDKey).(string)
+	return id
+}
+
+// requestLogger returns the logger with the ID of the request
+func (s *Server) requestLogger(req *http.Request) *logrus.Entry {
+	return s.logger.WithField("request_id", requestID(req))
+}
+
+// logRequests provides a middleware that logs every request after it is
+// served. Sensitive URL parameters, e.g. verification tokens, are redacted
+// in the logged path.
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+
+		next.ServeHTTP(ww, req)
+
+		path := req.URL.Path
+		if rctx := chi.RouteContext(req.Context()); rctx != nil {
+			for i, key := range rctx.URLParams.Keys {
+				if isSensitive(key) && rctx.URLParams.Values[i] != "" {
+					path = strings.Replace(path, "/"+rctx.URLParams.Values[i], "/"+redacted, -1)
+				}
+			}
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		s.requestLogger(req).WithFields(logrus.Fields{
+			"method":   req.Method,
+			"path":     path,
+			"status":   status,
+			"bytes":    ww.BytesWritten(),
+			"duration": time.Since(start).Seconds(),
+			"remote":   s.clientIP(req),
+		}).Info("Request served")
+	})
+}
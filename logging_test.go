@@ -0,0 +1,62 @@
+package klinkregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoggerRedactsSensitiveFields(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewLogger(&out, "json", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	entry := logger.WithField("app_secret", "alice").WithField("application", 5)
+	entry.Info("Authenticating")
+	logger.WithField("password", "hunter2").Debug("Not logged")
+
+	var logged map[string]interface{}
+	if err := json.Unmarshal(out.Bytes(), &logged); err != nil {
+		t.Fatalf("expected a single JSON entry, got %q", out.String())
+	}
+	if logged["app_secret"] != redacted || logged["application"] != float64(5) {
+		t.Errorf("expected only the secret to be redacted, got %v", logged)
+	}
+	if entry.Data["app_secret"] != "alice" {
+		t.Error("expected the entry itself to be unchanged")
+	}
+
+	if _, err := NewLogger(&out, "xml", "info"); err == nil {
+		t.Error("expected unknown formats to be rejected")
+	}
+}
+
+func TestRequestIDs(t *testing.T) {
+	s, store := newTestServer(t)
+	var out bytes.Buffer
+	s.logger.Out = &out
+
+	req := httptest.NewRequest("GET", "/api/2.0/auth/email-verification/secret-token", nil)
+	req.Header.Set(HeaderRequestID, "trace-42")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if id := rec.Header().Get(HeaderRequestID); id != "trace-42" {
+		t.Errorf("expected the request ID to be returned, got %q", id)
+	}
+	if !strings.Contains(rec.Body.String(), `"request_id":"trace-42"`) {
+		t.Errorf("expected the error to contain the request ID, got %s", rec.Body.String())
+	}
+	if logged := out.String(); !strings.Contains(logged, "request_id=trace-42") || strings.Contains(logged, "secret-token") {
+		t.Errorf("expected the request to be logged with its ID and without the token, got %q", logged)
+	}
+
+	rec = serve(t, s, store, 0, "GET", "/api/2.0/directory", "")
+	if id := rec.Header().Get(HeaderRequestID); len(id) != 32 {
+		t.Errorf("expected a request ID to be generated, got %q", id)
+	}
+}
@@ -2,8 +2,6 @@ package mail
 
 import (
 	"crypto/tls"
-	"errors"
-	"fmt"
 	"strings"
 
 	gomail "github.com/go-mail/mail"
@@ -26,23 +24,50 @@ type SMTPOptions struct {
 	AllowInsecure bool
 }
 
+// SendError is returned if an email could not be sent. The message can be
+// shown to users, the cause is kept for logging.
+type SendError struct {
+	Message string
+	Cause   error
+}
+
+func (e *SendError) Error() string {
+	return e.Message
+}
+
 // SMTPMailer is a Emailer that uses an SMTP Server to send mails
 type SMTPMailer struct {
 	Options *SMTPOptions
 }
 
-// Email satisfies the Emailer interface
-func (m SMTPMailer) Email(recepient, subject, html, text string) error {
-
-	mail := gomail.NewDialer(m.Options.Host, m.Options.Port, m.Options.User, m.Options.Pass)
+func (m SMTPMailer) dialer() *gomail.Dialer {
+	dialer := gomail.NewDialer(m.Options.Host, m.Options.Port, m.Options.User, m.Options.Pass)
 
 	if m.Options.AllowInsecure {
 		// Seems that unencrypted connection are not really supported
 		// https://github.com/go-mail/mail/issues/52
-		mail.TLSConfig = &tls.Config{InsecureSkipVerify: true}
-		mail.SSL = false
+		dialer.TLSConfig = &tls.Config{InsecureSkipVerify: true}
+		dialer.SSL = false
 	}
 
+	return dialer
+}
+
+// Ping connects to the SMTP server, to check that it is reachable and
+// accepts the credentials
+func (m SMTPMailer) Ping() error {
+	closer, err := m.dialer().Dial()
+	if err != nil {
+		return err
+	}
+	return closer.Close()
+}
+
+// Email satisfies the Emailer interface
+func (m SMTPMailer) Email(recepient, subject, html, text string) error {
+
+	mail := m.dialer()
+
 	message := gomail.NewMessage()
 
 	message.SetHeader("From", m.Options.From)
@@ -53,15 +78,11 @@ func (m SMTPMailer) Email(recepient, subject, html, text string) error {
 	err := mail.DialAndSend(message)
 	message.Reset()
 
-	if strings.Contains(err.Error(), "unencrypted connection") {
-
-		return errors.New(MailErrorConnection)
+	if err == nil {
+		return nil
 	} else if strings.Contains(err.Error(), "Recipient address rejected") {
-		return errors.New(MailErrorUnknownRecipient)
+		return &SendError{MailErrorUnknownRecipient, err}
 	} else {
-		fmt.Println("Error seding email message")
-		fmt.Println(recepient)
-		fmt.Println(err)
-		return errors.New(MailErrorConnection)
+		return &SendError{MailErrorConnection, err}
 	}
 }
@@ -0,0 +1,840 @@
+package klinkregistry
+
+import (
+	"database/sql"
+	"sort"
+	"sync"
+)
+
+// memStore is an in-memory Storer used by the handler tests
+type memStore struct {
+	registrants   map[int64]*Registrant
+	applications  map[int64]*Application
+	klinks        map[int64]*Klink
+	members       map[[2]int64]*KlinkMember
+	requests      map[int64]*AccessRequest
+	renewals      map[int64]*RenewalRequest
+	joins         map[int64]*JoinRequest
+	transfers     map[int64]*OwnershipTransfer
+	permissions   map[string]*Permission
+	verifications map[string]*EmailVerification
+	audit         []*AuditEntry
+	healthChecks  []*HealthCheck
+	peers         map[int64]*Peer
+	changes       []*Change
+	webhooks      map[int64]*Webhook
+	deliveries    []*WebhookDelivery
+	events        []*EventRecord
+	eventsMu      sync.Mutex // events are read by the streams while published
+	lastID        int64
+	schemaVersion int64
+	schemaDirty   bool
+	pingErr       error
+}
+
+func newMemStore() *memStore {
+	return &memStore{
+		registrants:   make(map[int64]*Registrant),
+		applications:  make(map[int64]*Application),
+		klinks:        make(map[int64]*Klink),
+		members:       make(map[[2]int64]*KlinkMember),
+		requests:      make(map[int64]*AccessRequest),
+		renewals:      make(map[int64]*RenewalRequest),
+		joins:         make(map[int64]*JoinRequest),
+		transfers:     make(map[int64]*OwnershipTransfer),
+		permissions:   make(map[string]*Permission),
+		verifications: make(map[string]*EmailVerification),
+		peers:         make(map[int64]*Peer),
+		webhooks:      make(map[int64]*Webhook),
+	}
+}
+
+func (m *memStore) nextID() int64 {
+	m.lastID++
+	return m.lastID
+}
+
+func (m *memStore) IsNotFound(err error) bool {
+	return err == sql.ErrNoRows
+}
+
+func (m *memStore) Ping() error {
+	return m.pingErr
+}
+
+func (m *memStore) GetSchemaVersion() (int64, bool, error) {
+	return m.schemaVersion, m.schemaDirty, nil
+}
+
+func (m *memStore) CreateRegistrant(r *Registrant) error {
+	if r.ID == 0 {
+		r.ID = m.nextID()
+	}
+	c := *r
+	m.registrants[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) ListRegistrants() ([]*Registrant, error) {
+	var list []*Registrant
+	for _, r := range m.registrants {
+		c := *r
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetRegistrantByID(id int64) (*Registrant, error) {
+	r, ok := m.registrants[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *r
+	return &c, nil
+}
+
+func (m *memStore) GetRegistrantByEmail(email string) (*Registrant, error) {
+	for _, r := range m.registrants {
+		if r.Email == email {
+			c := *r
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) ReplaceRegistrant(r *Registrant) error {
+	c := *r
+	m.registrants[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) SetRegistrantLastLogin(id, lastLogin int64) error {
+	if r, ok := m.registrants[id]; ok {
+		r.LastLogin = lastLogin
+	}
+	return nil
+}
+
+func (m *memStore) DeleteRegistrant(id int64) error {
+	delete(m.registrants, id)
+	return nil
+}
+
+func (m *memStore) CreateEmailVerification(v *EmailVerification) error {
+	c := *v
+	m.verifications[v.Email] = &c
+	return nil
+}
+
+func (m *memStore) GetEmailVerificationByEmail(email string) (*EmailVerification, error) {
+	v, ok := m.verifications[email]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *v
+	return &c, nil
+}
+
+func (m *memStore) GetEmailVerificationByToken(token string) (*EmailVerification, error) {
+	for _, v := range m.verifications {
+		if v.Token == token {
+			c := *v
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) DeleteEmailVerification(email string) error {
+	delete(m.verifications, email)
+	return nil
+}
+
+// copyApplication returns a copy of the application that does not share the
+// grants and origins with the original
+func copyApplication(app *Application) *Application {
+	c := *app
+	c.Origins = append([]string{}, app.Origins...)
+	c.SetGrants(nil)
+	for _, grant := range app.Grants {
+		c.AddGrant(grant.Klink, append([]string{}, grant.Permissions...))
+	}
+	return &c
+}
+
+func (m *memStore) CreateApplication(app *Application) error {
+	app.ID = m.nextID()
+	m.applications[app.ID] = copyApplication(app)
+	return nil
+}
+
+func (m *memStore) ListApplications() ([]*Application, error) {
+	var list []*Application
+	for _, app := range m.applications {
+		list = append(list, copyApplication(app))
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetApplicationByID(id int64) (*Application, error) {
+	app, ok := m.applications[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	return copyApplication(app), nil
+}
+
+func (m *memStore) GetApplicationByDomain(domain string) (*Application, error) {
+	for _, app := range m.applications {
+		if app.URL == domain {
+			return copyApplication(app), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) GetApplicationByOrigin(candidates []string) (*Application, error) {
+	for _, candidate := range candidates {
+		for _, app := range m.applications {
+			primary, _ := NormalizeOrigin(app.URL)
+			if candidate == primary || stringInSlice(candidate, app.Origins) {
+				return copyApplication(app), nil
+			}
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) GetApplicationByRemoteID(peerID, remoteID int64) (*Application, error) {
+	for _, app := range m.applications {
+		if app.PeerID == peerID && app.RemoteID == remoteID {
+			return copyApplication(app), nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) ReplaceApplication(app *Application) error {
+	m.applications[app.ID] = copyApplication(app)
+	return nil
+}
+
+func (m *memStore) SetApplicationReminder(appID, validUntil int64) error {
+	if app, ok := m.applications[appID]; ok && app.ValidUntil == validUntil {
+		app.ReminderSentFor = validUntil
+	}
+	return nil
+}
+
+func (m *memStore) DeleteApplication(id int64) error {
+	delete(m.applications, id)
+	return nil
+}
+
+func (m *memStore) CreateKlink(k *Klink) error {
+	k.ID = m.nextID()
+	c := *k
+	m.klinks[k.ID] = &c
+	return nil
+}
+
+func (m *memStore) ListKlinks() ([]*Klink, error) {
+	var list []*Klink
+	for _, k := range m.klinks {
+		c := *k
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetKlinkByPrimaryKey(id int64) (*Klink, error) {
+	k, ok := m.klinks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *k
+	return &c, nil
+}
+
+func (m *memStore) GetKlinkByIdentifier(identifier string) (*Klink, error) {
+	for _, k := range m.klinks {
+		if k.Identifier == identifier {
+			c := *k
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) ListKlinksByIdentifier(identifiers []string) ([]*Klink, error) {
+	var list []*Klink
+	for _, k := range m.klinks {
+		if stringInSlice(k.Identifier, identifiers) {
+			c := *k
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetKlinkByRemoteID(peerID, remoteID int64) (*Klink, error) {
+	for _, k := range m.klinks {
+		if k.PeerID == peerID && k.RemoteID == remoteID {
+			c := *k
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) UpdateKlink(k *Klink) error {
+	c := *k
+	// like the database, the health is only changed by SetKlinkHealth
+	if old, ok := m.klinks[k.ID]; ok {
+		c.HealthStatus = old.HealthStatus
+		c.HealthCheckedAt = old.HealthCheckedAt
+	}
+	m.klinks[k.ID] = &c
+	return nil
+}
+
+func (m *memStore) DeleteKlink(id int64) error {
+	delete(m.klinks, id)
+	return nil
+}
+
+func (m *memStore) SetKlinkHealth(klinkID int64, status string, checkedAt int64) error {
+	if k, ok := m.klinks[klinkID]; ok {
+		k.HealthStatus = status
+		k.HealthCheckedAt = checkedAt
+	}
+	return nil
+}
+
+func (m *memStore) CreateHealthCheck(c *HealthCheck) error {
+	c.ID = m.nextID()
+	cp := *c
+	m.healthChecks = append(m.healthChecks, &cp)
+	return nil
+}
+
+func (m *memStore) ListHealthChecks(klinkID int64, limit int) ([]*HealthCheck, error) {
+	var list []*HealthCheck
+	for i := len(m.healthChecks) - 1; i >= 0 && len(list) < limit; i-- {
+		if m.healthChecks[i].KlinkID == klinkID {
+			c := *m.healthChecks[i]
+			list = append(list, &c)
+		}
+	}
+	return list, nil
+}
+
+func (m *memStore) DeleteHealthChecksBefore(checkedAt int64) error {
+	var kept []*HealthCheck
+	for _, c := range m.healthChecks {
+		if c.CheckedAt >= checkedAt {
+			kept = append(kept, c)
+		}
+	}
+	m.healthChecks = kept
+	return nil
+}
+
+func (m *memStore) CountKlinkApplications() (map[int64]int, error) {
+	counts := make(map[int64]int)
+	for _, app := range m.applications {
+		if !app.Active {
+			continue
+		}
+		for _, klink := range m.klinks {
+			if app.GetGrant(klink.Identifier) != nil {
+				counts[klink.ID]++
+			}
+		}
+	}
+	return counts, nil
+}
+
+func (m *memStore) ListKlinkMembers(klinkID int64) ([]*KlinkMember, error) {
+	var list []*KlinkMember
+	for _, member := range m.members {
+		if member.KlinkID == klinkID {
+			c := *member
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].RegistrantID < list[j].RegistrantID })
+	return list, nil
+}
+
+func (m *memStore) ListKlinkMembershipsByRegistrant(registrantID int64) ([]*KlinkMember, error) {
+	var list []*KlinkMember
+	for _, member := range m.members {
+		if member.RegistrantID == registrantID {
+			c := *member
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].KlinkID < list[j].KlinkID })
+	return list, nil
+}
+
+func (m *memStore) GetKlinkMember(klinkID, registrantID int64) (*KlinkMember, error) {
+	member, ok := m.members[[2]int64{klinkID, registrantID}]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *member
+	return &c, nil
+}
+
+func (m *memStore) SaveKlinkMember(member *KlinkMember) error {
+	c := *member
+	m.members[[2]int64{member.KlinkID, member.RegistrantID}] = &c
+	return nil
+}
+
+func (m *memStore) DeleteKlinkMember(klinkID, registrantID int64) error {
+	delete(m.members, [2]int64{klinkID, registrantID})
+	return nil
+}
+
+func (m *memStore) CreateAccessRequest(r *AccessRequest) error {
+	r.ID = m.nextID()
+	c := *r
+	m.requests[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) listAccessRequests(match func(*AccessRequest) bool) ([]*AccessRequest, error) {
+	var list []*AccessRequest
+	for _, r := range m.requests {
+		if match(r) {
+			c := *r
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) ListAccessRequestsByApplication(applicationID int64) ([]*AccessRequest, error) {
+	return m.listAccessRequests(func(r *AccessRequest) bool { return r.ApplicationID == applicationID })
+}
+
+func (m *memStore) ListAccessRequestsByKlink(klinkID int64) ([]*AccessRequest, error) {
+	return m.listAccessRequests(func(r *AccessRequest) bool { return r.KlinkID == klinkID })
+}
+
+func (m *memStore) GetAccessRequestByID(id int64) (*AccessRequest, error) {
+	r, ok := m.requests[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *r
+	return &c, nil
+}
+
+func (m *memStore) UpdateAccessRequest(r *AccessRequest) error {
+	c := *r
+	m.requests[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) CreateRenewalRequest(r *RenewalRequest) error {
+	r.ID = m.nextID()
+	c := *r
+	m.renewals[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) listRenewalRequests(match func(*RenewalRequest) bool) ([]*RenewalRequest, error) {
+	var list []*RenewalRequest
+	for _, r := range m.renewals {
+		if match(r) {
+			c := *r
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) ListRenewalRequests() ([]*RenewalRequest, error) {
+	return m.listRenewalRequests(func(r *RenewalRequest) bool { return true })
+}
+
+func (m *memStore) ListRenewalRequestsByApplication(applicationID int64) ([]*RenewalRequest, error) {
+	return m.listRenewalRequests(func(r *RenewalRequest) bool { return r.ApplicationID == applicationID })
+}
+
+func (m *memStore) GetRenewalRequestByID(id int64) (*RenewalRequest, error) {
+	r, ok := m.renewals[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *r
+	return &c, nil
+}
+
+func (m *memStore) UpdateRenewalRequest(r *RenewalRequest) error {
+	c := *r
+	m.renewals[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) CreateJoinRequest(r *JoinRequest) error {
+	r.ID = m.nextID()
+	c := *r
+	m.joins[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) listJoinRequests(match func(*JoinRequest) bool) ([]*JoinRequest, error) {
+	var list []*JoinRequest
+	for _, r := range m.joins {
+		if match(r) {
+			c := *r
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) ListJoinRequestsByKlink(klinkID int64) ([]*JoinRequest, error) {
+	return m.listJoinRequests(func(r *JoinRequest) bool { return r.KlinkID == klinkID })
+}
+
+func (m *memStore) ListJoinRequestsByRegistrant(registrantID int64) ([]*JoinRequest, error) {
+	return m.listJoinRequests(func(r *JoinRequest) bool { return r.RegistrantID == registrantID })
+}
+
+func (m *memStore) GetJoinRequestByID(id int64) (*JoinRequest, error) {
+	r, ok := m.joins[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *r
+	return &c, nil
+}
+
+func (m *memStore) UpdateJoinRequest(r *JoinRequest) error {
+	c := *r
+	m.joins[r.ID] = &c
+	return nil
+}
+
+func (m *memStore) CreateOwnershipTransfer(t *OwnershipTransfer) error {
+	t.ID = m.nextID()
+	c := *t
+	m.transfers[t.ID] = &c
+	return nil
+}
+
+func (m *memStore) ListOwnershipTransfersByApplication(applicationID int64) ([]*OwnershipTransfer, error) {
+	var list []*OwnershipTransfer
+	for _, t := range m.transfers {
+		if t.ApplicationID == applicationID {
+			c := *t
+			list = append(list, &c)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID > list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetOwnershipTransferByToken(token string) (*OwnershipTransfer, error) {
+	for _, t := range m.transfers {
+		if t.Token == token {
+			c := *t
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) UpdateOwnershipTransfer(t *OwnershipTransfer) error {
+	c := *t
+	m.transfers[t.ID] = &c
+	return nil
+}
+
+func (m *memStore) ListPermissions() ([]*Permission, error) {
+	var list []*Permission
+	for _, p := range m.permissions {
+		c := *p
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list, nil
+}
+
+func (m *memStore) CreatePermission(p *Permission) error {
+	c := *p
+	m.permissions[p.Name] = &c
+	return nil
+}
+
+func (m *memStore) GetPermission(name string) (*Permission, error) {
+	p, ok := m.permissions[name]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *p
+	return &c, nil
+}
+
+func (m *memStore) UpdatePermission(p *Permission) error {
+	c := *p
+	m.permissions[p.Name] = &c
+	return nil
+}
+
+func (m *memStore) DeletePermission(name string) error {
+	delete(m.permissions, name)
+	return nil
+}
+
+func (m *memStore) CountPermissionGrants(name string) (int, error) {
+	count := 0
+	for _, app := range m.applications {
+		if stringInSlice(name, app.Permissions) {
+			count++
+		}
+		for _, grant := range app.Grants {
+			if stringInSlice(name, grant.Permissions) {
+				count++
+			}
+		}
+	}
+	return count, nil
+}
+
+func (m *memStore) CreateAuditEntry(entry *AuditEntry) error {
+	entry.ID = m.nextID()
+	c := *entry
+	m.audit = append(m.audit, &c)
+	return nil
+}
+
+func (m *memStore) CreatePeer(p *Peer) error {
+	p.ID = m.nextID()
+	c := *p
+	m.peers[p.ID] = &c
+	return nil
+}
+
+func (m *memStore) ListPeers() ([]*Peer, error) {
+	var list []*Peer
+	for _, p := range m.peers {
+		c := *p
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetPeerByID(id int64) (*Peer, error) {
+	p, ok := m.peers[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *p
+	return &c, nil
+}
+
+func (m *memStore) GetPeerByKey(key string) (*Peer, error) {
+	for _, p := range m.peers {
+		if p.Key == key {
+			c := *p
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) UpdatePeer(p *Peer) error {
+	c := *p
+	m.peers[p.ID] = &c
+	return nil
+}
+
+func (m *memStore) DeletePeer(id int64) error {
+	for appID, app := range m.applications {
+		if app.PeerID == id {
+			delete(m.applications, appID)
+		}
+	}
+	for klinkID, k := range m.klinks {
+		if k.PeerID == id {
+			delete(m.klinks, klinkID)
+		}
+	}
+	delete(m.peers, id)
+	return nil
+}
+
+func (m *memStore) CreateChange(c *Change) error {
+	c.ID = m.nextID()
+	cp := *c
+	m.changes = append(m.changes, &cp)
+	return nil
+}
+
+func (m *memStore) ListChangesSince(id int64, limit int) ([]*Change, error) {
+	var list []*Change
+	for _, c := range m.changes {
+		if c.ID > id && len(list) < limit {
+			cp := *c
+			list = append(list, &cp)
+		}
+	}
+	return list, nil
+}
+
+func (m *memStore) CreateWebhook(w *Webhook) error {
+	w.ID = m.nextID()
+	c := *w
+	m.webhooks[w.ID] = &c
+	return nil
+}
+
+func (m *memStore) ListWebhooks() ([]*Webhook, error) {
+	var list []*Webhook
+	for _, w := range m.webhooks {
+		c := *w
+		list = append(list, &c)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+func (m *memStore) GetWebhookByID(id int64) (*Webhook, error) {
+	w, ok := m.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	c := *w
+	return &c, nil
+}
+
+func (m *memStore) UpdateWebhook(w *Webhook) error {
+	c := *w
+	m.webhooks[w.ID] = &c
+	return nil
+}
+
+func (m *memStore) DeleteWebhook(id int64) error {
+	var kept []*WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.WebhookID != id {
+			kept = append(kept, d)
+		}
+	}
+	m.deliveries = kept
+	delete(m.webhooks, id)
+	return nil
+}
+
+func (m *memStore) CreateWebhookDelivery(d *WebhookDelivery) error {
+	d.ID = m.nextID()
+	c := *d
+	m.deliveries = append(m.deliveries, &c)
+	return nil
+}
+
+func (m *memStore) ListWebhookDeliveries(webhookID int64, limit int) ([]*WebhookDelivery, error) {
+	var list []*WebhookDelivery
+	for i := len(m.deliveries) - 1; i >= 0 && len(list) < limit; i-- {
+		if m.deliveries[i].WebhookID == webhookID {
+			c := *m.deliveries[i]
+			list = append(list, &c)
+		}
+	}
+	return list, nil
+}
+
+func (m *memStore) ListDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error) {
+	var list []*WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == DeliveryPending && d.NextAttemptAt <= now && len(list) < limit {
+			c := *d
+			list = append(list, &c)
+		}
+	}
+	return list, nil
+}
+
+func (m *memStore) GetWebhookDeliveryByID(id int64) (*WebhookDelivery, error) {
+	for _, d := range m.deliveries {
+		if d.ID == id {
+			c := *d
+			return &c, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (m *memStore) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	for i, stored := range m.deliveries {
+		if stored.ID == d.ID {
+			c := *d
+			m.deliveries[i] = &c
+		}
+	}
+	return nil
+}
+
+func (m *memStore) CreateEvent(e *EventRecord) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	e.Seq = m.nextID()
+	c := *e
+	m.events = append(m.events, &c)
+	return nil
+}
+
+func (m *memStore) ListEventsSince(seq int64, limit int) ([]*EventRecord, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	var list []*EventRecord
+	for _, e := range m.events {
+		if e.Seq > seq && len(list) < limit {
+			c := *e
+			list = append(list, &c)
+		}
+	}
+	return list, nil
+}
+
+func (m *memStore) GetLastEventSeq() (int64, error) {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	if len(m.events) == 0 {
+		return 0, nil
+	}
+	return m.events[len(m.events)-1].Seq, nil
+}
+
+func (m *memStore) DeleteEventsBefore(createdAt int64) error {
+	m.eventsMu.Lock()
+	defer m.eventsMu.Unlock()
+
+	var kept []*EventRecord
+	for _, e := range m.events {
+		if e.CreatedAt >= createdAt {
+			kept = append(kept, e)
+		}
+	}
+	m.events = kept
+	return nil
+}
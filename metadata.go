@@ -0,0 +1,104 @@
+package klinkregistry
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator"
+	"github.com/pkg/errors"
+)
+
+// Environments an application may be deployed to
+const (
+	EnvironmentProduction  = "production"
+	EnvironmentStaging     = "staging"
+	EnvironmentDevelopment = "development"
+	EnvironmentTest        = "test"
+)
+
+// Environments contains all valid environments of an application
+var Environments = []string{
+	EnvironmentProduction,
+	EnvironmentStaging,
+	EnvironmentDevelopment,
+	EnvironmentTest,
+}
+
+// tagPattern restricts tags to lowercase words, so that they can be filtered
+// and stored as comma separated list
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+var metadataValidator = validator.New()
+
+// normalizeMetadata validates the descriptive fields of an application and
+// brings them into their canonical form: tags are lowercased and
+// deduplicated, and the environment defaults to production. The error names
+// the invalid field.
+func normalizeMetadata(app *Application) error {
+	app.Description = strings.TrimSpace(app.Description)
+
+	tags := []string{}
+	for _, tag := range app.Tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || stringInSlice(tag, tags) {
+			continue
+		}
+		if !tagPattern.MatchString(tag) {
+			return errors.Errorf("invalid tag %q", tag)
+		}
+		tags = append(tags, tag)
+	}
+	app.Tags = tags
+
+	app.TechnicalContact = strings.TrimSpace(app.TechnicalContact)
+	if err := metadataValidator.Var(app.TechnicalContact, "omitempty,email"); err != nil {
+		return errors.New("invalid technical_contact")
+	}
+	app.SecurityContact = strings.TrimSpace(app.SecurityContact)
+	if err := metadataValidator.Var(app.SecurityContact, "omitempty,email"); err != nil {
+		return errors.New("invalid security_contact")
+	}
+
+	app.LogoURL = strings.TrimSpace(app.LogoURL)
+	if app.LogoURL != "" {
+		u, err := url.Parse(app.LogoURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("invalid logo_url")
+		}
+	}
+
+	app.Environment = strings.ToLower(strings.TrimSpace(app.Environment))
+	if app.Environment == "" {
+		app.Environment = EnvironmentProduction
+	}
+	if !stringInSlice(app.Environment, Environments) {
+		return errors.Errorf("invalid environment %q", app.Environment)
+	}
+
+	return nil
+}
+
+// matchesFilter returns true if the application matches the filter of the
+// application list: every `tag`, the `environment`, and the search term `q`,
+// which is looked up in the name, description and URL.
+func matchesFilter(app *Application, query url.Values) bool {
+	for _, tag := range query["tag"] {
+		if !stringInSlice(strings.ToLower(tag), app.Tags) {
+			return false
+		}
+	}
+
+	if env := query.Get("environment"); env != "" && !strings.EqualFold(env, app.Environment) {
+		return false
+	}
+
+	if q := strings.ToLower(query.Get("q")); q != "" {
+		text := strings.ToLower(app.Name + "\n" + app.Description + "\n" + app.URL)
+		if !strings.Contains(text, q) {
+			return false
+		}
+	}
+
+	return true
+}
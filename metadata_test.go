@@ -0,0 +1,77 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeMetadata(t *testing.T) {
+	app := &Application{
+		Description:      "  Document management  ",
+		Tags:             []string{"DMS", " research ", "dms", ""},
+		TechnicalContact: "tech@example.com",
+	}
+	if err := normalizeMetadata(app); err != nil {
+		t.Fatal(err)
+	}
+	if app.Description != "Document management" || !reflect.DeepEqual(app.Tags, []string{"dms", "research"}) || app.Environment != EnvironmentProduction {
+		t.Errorf("expected normalised metadata, got %+v", app)
+	}
+
+	invalid := []*Application{
+		{Tags: []string{"two words"}},
+		{TechnicalContact: "nobody"},
+		{SecurityContact: "security.example.com"},
+		{LogoURL: "javascript:alert(1)"},
+		{Environment: "qa"},
+	}
+	for _, app := range invalid {
+		if err := normalizeMetadata(app); err == nil {
+			t.Errorf("expected %+v to be invalid", app)
+		}
+	}
+}
+
+func TestListApplicationsFilter(t *testing.T) {
+	s, store := newTestServer(t)
+
+	store.applications[testAliceAppID].Tags = []string{"dms", "research"}
+	store.applications[testAliceAppID].Environment = EnvironmentProduction
+	store.applications[testBobAppID].Description = "Staging copy of the DMS"
+	store.applications[testBobAppID].Tags = []string{"dms"}
+	store.applications[testBobAppID].Environment = EnvironmentStaging
+
+	cases := []struct {
+		query string
+		want  []int64
+	}{
+		{"", []int64{testAliceAppID, testBobAppID}},
+		{"?tag=dms", []int64{testAliceAppID, testBobAppID}},
+		{"?tag=dms&tag=research", []int64{testAliceAppID}},
+		{"?environment=staging", []int64{testBobAppID}},
+		{"?q=staging+copy", []int64{testBobAppID}},
+		{"?q=alice.example", []int64{testAliceAppID}},
+		{"?tag=unknown", nil},
+	}
+
+	for _, c := range cases {
+		rec := serve(t, s, store, testAdminID, "GET", "/api/2.0/applications/"+c.query, "")
+
+		var apps []ApplicationModel
+		json.Unmarshal(rec.Body.Bytes(), &apps)
+
+		var got []int64
+		for _, app := range apps {
+			got = append(got, app.ID)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Errorf("%q: expected %v, got %v", c.query, c.want, got)
+		}
+	}
+
+	if rec := serve(t, s, store, testAliceID, "PUT", "/api/2.0/applications/5",
+		`{"name":"Alice","app_domain":"https://alice.example.com","token":"alice","active":true,"permissions":["data-search","data-legacy"],"klinks":["k-admin"],"environment":"qa"}`); rec.Code != 422 {
+		t.Errorf("expected an invalid environment to be rejected, got %d", rec.Code)
+	}
+}
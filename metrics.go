@@ -0,0 +1,152 @@
+package klinkregistry
+
+import (
+	"database/sql"
+	"net/http"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/k-box/k-link-registry/mail"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+)
+
+// metrics contains the Prometheus collectors of a Server. Every Server has
+// its own registry, so that several servers can run in one process.
+type metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	authentications *prometheus.CounterVec
+	queryDuration   *prometheus.HistogramVec
+	queryErrors     *prometheus.CounterVec
+	emails          *prometheus.CounterVec
+}
+
+func newMetrics() *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "klinkregistry_http_requests_total",
+			Help: "HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "klinkregistry_http_request_duration_seconds",
+			Help:    "Duration of HTTP requests by method and route.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		authentications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "klinkregistry_authentications_total",
+			Help: "application.authenticate calls by outcome and denial reason.",
+		}, []string{"outcome", "reason"}),
+		queryDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "klinkregistry_db_query_duration_seconds",
+			Help:    "Duration of database queries by store method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"query"}),
+		queryErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "klinkregistry_db_query_errors_total",
+			Help: "Failed database queries by store method.",
+		}, []string{"query"}),
+		emails: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "klinkregistry_emails_total",
+			Help: "Sent emails by result.",
+		}, []string{"result"}),
+	}
+
+	buildInfo := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "klinkregistry_build_info",
+		Help: "Version of the registry, always 1.",
+	}, []string{"version", "goversion"})
+	buildInfo.WithLabelValues(Version, runtime.Version()).Set(1)
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.authentications,
+		m.queryDuration,
+		m.queryErrors,
+		m.emails,
+		buildInfo,
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+	)
+
+	return m
+}
+
+// measureRequests provides a middleware that counts the requests and
+// measures their duration by route pattern, so that paths with IDs are
+// grouped. Requests that match no route are labeled "unmatched".
+func (s *Server) measureRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, req.ProtoMajor)
+
+		next.ServeHTTP(ww, req)
+
+		route := "unmatched"
+		if rctx := chi.RouteContext(req.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		status := ww.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		s.metrics.requests.WithLabelValues(req.Method, route, strconv.Itoa(status)).Inc()
+		s.metrics.requestDuration.WithLabelValues(req.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
+
+// observeAuthentication counts an application.authenticate call. An empty
+// reason means that access was granted.
+func (s *Server) observeAuthentication(reason string) {
+	if reason == "" {
+		s.metrics.authentications.WithLabelValues("granted", "").Inc()
+		return
+	}
+	s.metrics.authentications.WithLabelValues("denied", reason).Inc()
+}
+
+// ObserveQuery records the duration of a database query, it is passed to
+// the store, e.g. with mysql.Database.SetQueryObserver
+func (s *Server) ObserveQuery(query string, duration time.Duration, err error) {
+	s.metrics.queryDuration.WithLabelValues(query).Observe(duration.Seconds())
+	if err != nil && err != sql.ErrNoRows {
+		s.metrics.queryErrors.WithLabelValues(query).Inc()
+	}
+}
+
+// meteredEmailer counts the emails sent by an Emailer, and logs failures
+type meteredEmailer struct {
+	Emailer
+	emails *prometheus.CounterVec
+	logger *logrus.Logger
+}
+
+// Email sends the email and counts the result
+func (m *meteredEmailer) Email(recepient, subject, html, text string) error {
+	err := m.Emailer.Email(recepient, subject, html, text)
+	if err != nil {
+		cause := err
+		if sendErr, ok := err.(*mail.SendError); ok {
+			cause = sendErr.Cause
+		}
+		m.logger.WithError(cause).WithField("recipient", recepient).Error("Error sending email")
+		m.emails.WithLabelValues("failure").Inc()
+	} else {
+		m.emails.WithLabelValues("success").Inc()
+	}
+	return err
+}
+
+// handleMetrics serves the metrics in the Prometheus text format
+func (s *Server) handleMetrics() http.Handler {
+	return promhttp.HandlerFor(s.metrics.registry, promhttp.HandlerOpts{})
+}
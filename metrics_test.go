@@ -0,0 +1,41 @@
+package klinkregistry
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetrics(t *testing.T) {
+	s, store := newTestServer(t)
+
+	authenticate(t, s, store, testKlinkIdentifier, "data-search")
+	authenticate(t, s, store, "k-unknown", "data-search")
+	serve(t, s, store, testAliceID, "GET", "/api/2.0/applications/5", "")
+
+	rec := serve(t, s, store, 0, "GET", "/metrics", "")
+	if rec.Code != 200 {
+		t.Fatalf("expected the metrics to be served, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, metric := range []string{
+		`klinkregistry_authentications_total{outcome="granted",reason=""} 1`,
+		`klinkregistry_authentications_total{outcome="denied",reason="klink_not_granted"} 1`,
+		`klinkregistry_http_requests_total{method="GET",route="/api/2.0/applications/{id}",status="200"} 1`,
+		`klinkregistry_build_info{goversion=`,
+	} {
+		if !strings.Contains(body, metric) {
+			t.Errorf("expected the metrics to contain %s", metric)
+		}
+	}
+}
+
+func TestMetricsListen(t *testing.T) {
+	s, store := newTestServer(t)
+	s.config.MetricsListen = "127.0.0.1:9100"
+	s.initRoutes()
+
+	if rec := serve(t, s, store, 0, "GET", "/metrics", ""); strings.Contains(rec.Body.String(), "klinkregistry_build_info") {
+		t.Error("expected the metrics to be served on the separate address only")
+	}
+}
@@ -1,6 +1,9 @@
 package klinkregistry
 
 import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -42,27 +45,351 @@ func (u *Registrant) CheckPass(password string) error {
 	return err
 }
 
-// Application contains information about a registered Application.
+// Application contains information about a registered Application. The
+// Permissions apply to the application as a whole, while each of the Grants
+// lists the permissions inside a single K-Link. Klinks contains the
+// identifiers of all granted K-Links. Origins contains the normalised origins
+// the application may authenticate from besides its URL, which may be
+// wildcard patterns such as https://*.example.org. The application is only
+// valid between ValidFrom and ValidUntil, where 0 means unbounded.
+// ReminderSentFor contains the ValidUntil for which the owner has been
+// reminded about the expiry. The owner proves the control of the domain of
+// the URL by publishing the ChallengeToken; VerifiedAt is 0 until the domain
+// is verified. The descriptive fields are for the network managers.
+// Applications imported from a peer registry have the PeerID and the RemoteID
+// they have on the peer, and their Token is the hash of the token, see
+// HashToken.
 type Application struct {
-	ID          int64    `db:"application_id"`
-	OwnerID     int64    `db:"registrant_id"`
-	Name        string   `db:"name"`
-	URL         string   `db:"app_domain"`
-	Token       string   `db:"auth_token"`
-	Permissions []string `db:"permissions"`
-	Klinks      []string `db:"klinks"`
-	Active      bool     `db:"status"`
+	ID               int64        `db:"application_id"`
+	OwnerID          int64        `db:"registrant_id"`
+	Name             string       `db:"name"`
+	URL              string       `db:"app_domain"`
+	Origins          []string     `db:"-"`
+	Token            string       `db:"auth_token"`
+	Permissions      []string     `db:"permissions"`
+	Klinks           []string     `db:"klinks"`
+	Grants           []KlinkGrant `db:"-"`
+	Active           bool         `db:"status"`
+	ValidFrom        int64        `db:"valid_from"`
+	ValidUntil       int64        `db:"valid_until"`
+	ReminderSentFor  int64        `db:"reminder_sent_for"`
+	ChallengeToken   string       `db:"challenge_token"`
+	VerifiedAt       int64        `db:"verified_at"`
+	Description      string       `db:"description"`
+	Tags             []string     `db:"tags"`
+	TechnicalContact string       `db:"technical_contact"`
+	SecurityContact  string       `db:"security_contact"`
+	LogoURL          string       `db:"logo_url"`
+	Environment      string       `db:"environment"`
+	PeerID           int64        `db:"peer_id"`
+	RemoteID         int64        `db:"remote_id"`
+}
+
+// HashToken returns the hash of an application token, which is shared with
+// peer registries instead of the token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
 }
 
-// Klink contains information about a registered K-Link instance
+// MatchesSecret returns true if the secret is the token of the application
+func (app *Application) MatchesSecret(secret string) bool {
+	token := secret
+	if app.PeerID != 0 {
+		token = HashToken(secret)
+	}
+	return subtle.ConstantTimeCompare([]byte(app.Token), []byte(token)) == 1
+}
+
+// IsValidAt returns true if the time is inside the validity period of the
+// application
+func (app *Application) IsValidAt(t time.Time) bool {
+	now := t.Unix()
+	if app.ValidFrom != 0 && now < app.ValidFrom {
+		return false
+	}
+	if app.ValidUntil != 0 && now >= app.ValidUntil {
+		return false
+	}
+	return true
+}
+
+// KlinkGrant contains the permissions an Application holds inside a single
+// K-Link, identified by its public identifier.
+type KlinkGrant struct {
+	Klink       string   `db:"identifier" json:"klink"`
+	Permissions []string `db:"permissions" json:"permissions"`
+}
+
+// SetGrants replaces the grants of the application, and updates the list of
+// K-Links accordingly.
+func (app *Application) SetGrants(grants []KlinkGrant) {
+	app.Grants = make([]KlinkGrant, 0, len(grants))
+	app.Klinks = make([]string, 0, len(grants))
+
+	for _, grant := range grants {
+		if grant.Klink == "" || app.GetGrant(grant.Klink) != nil {
+			continue
+		}
+		app.Grants = append(app.Grants, grant)
+		app.Klinks = append(app.Klinks, grant.Klink)
+	}
+}
+
+// GetGrant returns the grant for the K-Link, or nil if the application may
+// not access the K-Link.
+func (app *Application) GetGrant(klink string) *KlinkGrant {
+	for i := range app.Grants {
+		if app.Grants[i].Klink == klink {
+			return &app.Grants[i]
+		}
+	}
+	return nil
+}
+
+// AddGrant grants the permissions inside the K-Link, in addition to the
+// permissions that were already granted.
+func (app *Application) AddGrant(klink string, permissions []string) {
+	if grant := app.GetGrant(klink); grant != nil {
+		for _, permission := range permissions {
+			if !stringInSlice(permission, grant.Permissions) {
+				grant.Permissions = append(grant.Permissions, permission)
+			}
+		}
+		return
+	}
+
+	app.SetGrants(append(app.Grants, KlinkGrant{Klink: klink, Permissions: permissions}))
+}
+
+// Klink contains information about a registered K-Link instance. K-Links
+// imported from a peer registry have the PeerID and the RemoteID they have on
+// the peer.
 type Klink struct {
-	ID          int64  `db:"klink_id"`
-	Identifier  string `db:"identifier"`
-	ManagerID   int64  `db:"manager_id"`
-	Name        string `db:"name"`
-	Website     string `db:"website"`
-	Description string `db:"description"`
-	Active      bool   `db:"active"`
+	ID              int64  `db:"klink_id"`
+	Identifier      string `db:"identifier"`
+	ManagerID       int64  `db:"manager_id"`
+	Name            string `db:"name"`
+	Website         string `db:"website"`
+	Description     string `db:"description"`
+	Active          bool   `db:"active"`
+	HealthURL       string `db:"health_url"`
+	HealthStatus    string `db:"health_status"`
+	HealthCheckedAt int64  `db:"health_checked_at"`
+	PeerID          int64  `db:"peer_id"`
+	RemoteID        int64  `db:"remote_id"`
+}
+
+// Possible health states of a K-Link. A K-Link without health-check URL, or
+// that was not probed yet, has an empty health state.
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+)
+
+// HealthCheck records the result of probing the health-check URL of a
+// K-Link. Latency is in milliseconds.
+type HealthCheck struct {
+	ID         int64  `db:"health_check_id"`
+	KlinkID    int64  `db:"klink_id"`
+	CheckedAt  int64  `db:"checked_at"`
+	Status     string `db:"status"`
+	StatusCode int    `db:"status_code"`
+	Latency    int64  `db:"latency"`
+	Error      string `db:"error"`
+}
+
+// Possible roles of a registrant inside a K-Link
+const (
+	KlinkRoleManager = "manager"
+	KlinkRoleCurator = "curator"
+	KlinkRoleViewer  = "viewer"
+)
+
+// KlinkMember grants a registrant a role inside a single K-Link, independent
+// of the global role of the registrant.
+type KlinkMember struct {
+	KlinkID      int64  `db:"klink_id"`
+	RegistrantID int64  `db:"registrant_id"`
+	Role         string `db:"role"`
+}
+
+// Possible states of requests that need to be approved
+const (
+	RequestPending  = "pending"
+	RequestApproved = "approved"
+	RequestRejected = "rejected"
+)
+
+// AccessRequest is created by the owner of an Application to request access
+// to a K-Link with a set of permissions. The access is granted once a
+// manager of the K-Link approves the request.
+type AccessRequest struct {
+	ID            int64    `db:"access_request_id"`
+	ApplicationID int64    `db:"application_id"`
+	KlinkID       int64    `db:"klink_id"`
+	Permissions   []string `db:"permissions"`
+	Status        string   `db:"status"`
+	Reason        string   `db:"reason"`
+	RequestedBy   int64    `db:"requested_by"`
+	DecidedBy     int64    `db:"decided_by"`
+	CreatedAt     int64    `db:"created_at"`
+	DecidedAt     int64    `db:"decided_at"`
+}
+
+// Outcomes of an audited action
+const (
+	AuditGranted = "granted"
+	AuditDenied  = "denied"
+)
+
+// AuditEntry records a security relevant action. ActorID is the registrant
+// that performed the action, or 0 if it was performed by an application.
+type AuditEntry struct {
+	ID            int64  `db:"audit_id"`
+	CreatedAt     int64  `db:"created_at"`
+	Action        string `db:"action"`
+	ActorID       int64  `db:"actor_id"`
+	ApplicationID int64  `db:"application_id"`
+	Outcome       string `db:"outcome"`
+	Reason        string `db:"reason"`
+	Detail        string `db:"detail"`
+}
+
+// RenewalRequest is created by the owner of an Application to extend its
+// validity period. The validity is extended once an administrator approves
+// the request.
+type RenewalRequest struct {
+	ID            int64  `db:"renewal_request_id"`
+	ApplicationID int64  `db:"application_id"`
+	ValidUntil    int64  `db:"valid_until"`
+	Justification string `db:"justification"`
+	Status        string `db:"status"`
+	Reason        string `db:"reason"`
+	RequestedBy   int64  `db:"requested_by"`
+	DecidedBy     int64  `db:"decided_by"`
+	CreatedAt     int64  `db:"created_at"`
+	DecidedAt     int64  `db:"decided_at"`
+}
+
+// JoinRequest is created by a registrant to become a member of a K-Link. The
+// registrant joins as viewer once a manager of the K-Link approves the
+// request.
+type JoinRequest struct {
+	ID            int64  `db:"join_request_id"`
+	KlinkID       int64  `db:"klink_id"`
+	RegistrantID  int64  `db:"registrant_id"`
+	Justification string `db:"justification"`
+	Status        string `db:"status"`
+	Reason        string `db:"reason"`
+	DecidedBy     int64  `db:"decided_by"`
+	CreatedAt     int64  `db:"created_at"`
+	DecidedAt     int64  `db:"decided_at"`
+}
+
+// OwnershipTransfer proposes a new owner for an Application. The ownership
+// is transferred once the proposed owner accepts with the emailed Token.
+type OwnershipTransfer struct {
+	ID            int64  `db:"transfer_id"`
+	ApplicationID int64  `db:"application_id"`
+	FromID        int64  `db:"from_id"`
+	ToID          int64  `db:"to_id"`
+	Token         string `db:"token"`
+	Status        string `db:"status"`
+	RequestedBy   int64  `db:"requested_by"`
+	CreatedAt     int64  `db:"created_at"`
+	DecidedAt     int64  `db:"decided_at"`
+}
+
+// IsExpired returns true if the transfer can no longer be accepted
+func (t *OwnershipTransfer) IsExpired(now time.Time) bool {
+	return now.Unix() >= t.CreatedAt+int64(OwnershipTransferValidity/time.Second)
+}
+
+// OwnershipTransferValidity is the time a proposed owner has to accept a
+// transfer
+const OwnershipTransferValidity = 7 * 24 * time.Hour
+
+// Peer is another registry of the network. The peer may pull the K-Links
+// and applications of this registry with the shared Key and Secret, and if
+// the URL is set, this registry subscribes to the ones of the peer. Cursor
+// is the last change imported from the peer. Imported records belong to the
+// registrant that added the peer.
+type Peer struct {
+	ID         int64  `db:"peer_id"`
+	Name       string `db:"name"`
+	URL        string `db:"url"`
+	Key        string `db:"peer_key"`
+	Secret     string `db:"secret"`
+	OwnerID    int64  `db:"registrant_id"`
+	Active     bool   `db:"active"`
+	Cursor     int64  `db:"sync_cursor"`
+	LastSyncAt int64  `db:"last_sync_at"`
+	LastError  string `db:"last_error"`
+}
+
+// Kinds of records whose changes are recorded for the peers
+const (
+	ChangeApplication = "application"
+	ChangeKlink       = "klink"
+)
+
+// Change records that a local record was created, updated or deleted, so
+// that peers can pull the changes since their last sync.
+type Change struct {
+	ID        int64  `db:"change_id"`
+	Kind      string `db:"kind"`
+	RecordID  int64  `db:"record_id"`
+	CreatedAt int64  `db:"created_at"`
+}
+
+// Webhook subscribes a URL to registry events. Events lists the subscribed
+// event types, all events are delivered if it is empty. The deliveries are
+// signed with the Secret.
+type Webhook struct {
+	ID        int64    `db:"webhook_id"`
+	URL       string   `db:"url"`
+	Secret    string   `db:"secret"`
+	Events    []string `db:"events"`
+	Active    bool     `db:"active"`
+	CreatedBy int64    `db:"created_by"`
+	CreatedAt int64    `db:"created_at"`
+}
+
+// Possible states of a webhook delivery
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// WebhookDelivery is a single event sent to a Webhook. Pending deliveries
+// are attempted at NextAttemptAt, until they succeed or run out of attempts.
+type WebhookDelivery struct {
+	ID            int64  `db:"delivery_id"`
+	WebhookID     int64  `db:"webhook_id"`
+	EventID       string `db:"event_id"`
+	EventType     string `db:"event_type"`
+	Payload       string `db:"payload"`
+	Status        string `db:"status"`
+	Attempts      int    `db:"attempts"`
+	StatusCode    int    `db:"status_code"`
+	Error         string `db:"error"`
+	CreatedAt     int64  `db:"created_at"`
+	NextAttemptAt int64  `db:"next_attempt_at"`
+	DeliveredAt   int64  `db:"delivered_at"`
+}
+
+// EventRecord is an Event persisted for the event stream. Subscribers resume
+// the stream after the last Seq they received. SubjectID is the ID of the
+// application, K-Link or registrant the event is about.
+type EventRecord struct {
+	Seq       int64  `db:"event_seq"`
+	ID        string `db:"event_id"`
+	Type      string `db:"event_type"`
+	SubjectID int64  `db:"subject_id"`
+	Payload   string `db:"payload"`
+	CreatedAt int64  `db:"created_at"`
 }
 
 // EmailVerification represents a emailVerification in the database On
@@ -94,9 +421,15 @@ type PasswordChangeVerification struct {
 	Timestamp    int64  `db:"timestamp"`
 }
 
-// A Permission describes an action that an Application may perform
+// A Permission describes an action that an Application may perform.
+// Granting a permission also grants the permissions it implies. Deprecated
+// permissions stay valid for existing grants, but can no longer be
+// requested.
 type Permission struct {
-	Name string `db:"name"`
+	Name        string   `db:"name"`
+	Description string   `db:"description"`
+	Implies     []string `db:"implies"`
+	Deprecated  bool     `db:"deprecated"`
 }
 
 // A EmailConfirmation represents a token (sent via email) that a registrant may
@@ -0,0 +1,61 @@
+package klinkregistry
+
+import (
+	"fmt"
+)
+
+// link returns an absolute link to a page of the web application
+func (s *Server) link(format string, a ...interface{}) string {
+	return fmt.Sprintf("http://%s%s/", s.config.HTTPDomain, s.config.HTTPBasePath) +
+		fmt.Sprintf(format, a...)
+}
+
+// notify sends a plain text email. Notifications are sent after the action
+// they describe has succeeded, so failures are logged instead of returned.
+func (s *Server) notify(recipient, subject, text string) {
+	// failures are logged by the emailer
+	s.email.Email(recipient, "K-Link-Registry: "+subject, text, text)
+}
+
+// notifyRegistrant sends a plain text email to a registrant
+func (s *Server) notifyRegistrant(id int64, subject, text string) {
+	registrant, err := s.store.GetRegistrantByID(id)
+	if err != nil {
+		s.logger.WithError(err).WithField("registrant", id).Error("Error sending notification")
+		return
+	}
+
+	s.notify(registrant.Email, subject, text)
+}
+
+// notifyKlinkMembers sends a plain text email to all members of a klink that
+// hold the capability through their membership
+func (s *Server) notifyKlinkMembers(klink *Klink, capability, subject, text string) {
+	members, err := s.store.ListKlinkMembers(klink.ID)
+	if err != nil {
+		s.logger.WithError(err).WithField("klink", klink.Identifier).Error("Error sending notification to members")
+		return
+	}
+
+	for _, member := range members {
+		if s.policy.CanInKlink(member.Role, capability) {
+			s.notifyRegistrant(member.RegistrantID, subject, text)
+		}
+	}
+}
+
+// notifyCapable sends a plain text email to all active registrants whose
+// role holds the capability
+func (s *Server) notifyCapable(capability, subject, text string) {
+	registrants, err := s.store.ListRegistrants()
+	if err != nil {
+		s.logger.WithError(err).WithField("capability", capability).Error("Error sending notification to registrants")
+		return
+	}
+
+	for _, registrant := range registrants {
+		if registrant.Active && s.policy.Can(registrant.Role, capability) {
+			s.notify(registrant.Email, subject, text)
+		}
+	}
+}
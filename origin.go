@@ -0,0 +1,180 @@
+package klinkregistry
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/publicsuffix"
+)
+
+// ErrInvalidOrigin is returned for origins that cannot be normalised
+var ErrInvalidOrigin = errors.New("invalid origin")
+
+// NormalizeOrigin returns the canonical form of an application URL or origin
+// pattern: the scheme defaults to https, scheme and host are lowercased,
+// default ports and trailing slashes are removed. A pattern may start with
+// `*.` to match every subdomain of a registrable domain, such as
+// `*.example.org` or `*.example.co.uk`, but not of a public suffix such as
+// `*.co.uk`, and may not contain a path.
+func NormalizeOrigin(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return "", ErrInvalidOrigin
+	}
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", ErrInvalidOrigin
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", ErrInvalidOrigin
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" || u.User != nil {
+		return "", ErrInvalidOrigin
+	}
+
+	path := strings.TrimRight(u.Path, "/")
+	if strings.Contains(host, "*") {
+		domain := strings.TrimPrefix(host, "*.")
+		if domain == host || strings.Contains(domain, "*") || path != "" {
+			return "", ErrInvalidOrigin
+		}
+		if _, err := publicsuffix.EffectiveTLDPlusOne(domain); err != nil {
+			return "", ErrInvalidOrigin
+		}
+	}
+
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]" // IPv6 address
+	}
+
+	port := u.Port()
+	if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+		port = ""
+	}
+	if port != "" {
+		host += ":" + port
+	}
+
+	return scheme + "://" + host + path, nil
+}
+
+// OriginCandidates returns the origins and patterns that match a normalised
+// origin, from the most to the least specific: the origin itself, the origin
+// with each trailing path segment removed, and then the wildcard patterns of
+// each parent domain.
+func OriginCandidates(origin string) []string {
+	u, err := url.Parse(origin)
+	if err != nil {
+		return []string{origin}
+	}
+
+	base := u.Scheme + "://" + u.Host
+	candidates := []string{origin}
+	for path := u.Path; path != ""; {
+		path = path[:strings.LastIndex(path, "/")]
+		candidates = append(candidates, base+path)
+	}
+
+	port := ""
+	if u.Port() != "" {
+		port = ":" + u.Port()
+	}
+
+	labels := strings.Split(u.Hostname(), ".")
+	for i := 1; i < len(labels)-1; i++ {
+		pattern := u.Scheme + "://*." + strings.Join(labels[i:], ".") + port
+		candidates = append(candidates, pattern)
+	}
+
+	return candidates
+}
+
+// sameDomain returns true if both URLs have the same scheme, host and port
+func sameDomain(a, b string) bool {
+	domain := func(raw string) string {
+		origin, err := NormalizeOrigin(raw)
+		if err != nil {
+			return raw
+		}
+		u, err := url.Parse(origin)
+		if err != nil {
+			return raw
+		}
+		return u.Scheme + "://" + u.Host
+	}
+
+	return domain(a) == domain(b)
+}
+
+// normalizeOrigins normalises a list of origins and removes duplicates, as
+// well as the origin of the application URL itself
+func normalizeOrigins(appURL string, origins []string) ([]string, error) {
+	primary, _ := NormalizeOrigin(appURL)
+
+	normalized := []string{}
+	for _, origin := range origins {
+		n, err := NormalizeOrigin(origin)
+		if err != nil {
+			return nil, err
+		}
+		if n == primary || stringInSlice(n, normalized) {
+			continue
+		}
+		normalized = append(normalized, n)
+	}
+
+	return normalized, nil
+}
+
+// applicationByURL returns the application that is registered for the most
+// specific origin matching the URL. Applications whose URL could not be
+// normalised are still found by their exact URL.
+func (s *Server) applicationByURL(raw string) (*Application, error) {
+	if origin, err := NormalizeOrigin(raw); err == nil {
+		app, err := s.store.GetApplicationByOrigin(OriginCandidates(origin))
+		if !s.store.IsNotFound(err) {
+			return app, err
+		}
+	}
+
+	return s.store.GetApplicationByDomain(raw)
+}
+
+// checkOrigins normalises the origins of an application and verifies that
+// neither its URL nor one of its origins is used by another application.
+// The returned error is nil if the origins are valid.
+func (s *Server) checkOrigins(app *Application) *Error {
+	origins, err := normalizeOrigins(app.URL, app.Origins)
+	if err != nil {
+		return &API2ErrInvalidOrigin
+	}
+	app.Origins = origins
+
+	// URLs that cannot be normalised are only matched exactly
+	if primary, err := NormalizeOrigin(app.URL); err == nil {
+		origins = append([]string{primary}, origins...)
+	}
+
+	for _, origin := range origins {
+		other, err := s.store.GetApplicationByOrigin([]string{origin})
+		if s.store.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return &API2ErrDatabase
+		}
+		if other.ID != app.ID {
+			return &API2ErrOriginTaken
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package klinkregistry
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeOrigin(t *testing.T) {
+	cases := []struct {
+		raw    string
+		origin string
+		valid  bool
+	}{
+		{"https://example.org", "https://example.org", true},
+		{"HTTPS://Example.ORG/", "https://example.org", true},
+		{"example.org", "https://example.org", true},
+		{"https://example.org:443", "https://example.org", true},
+		{"http://example.org:80/", "http://example.org", true},
+		{"http://example.org:8080", "http://example.org:8080", true},
+		{"https://example.org/DMS/", "https://example.org/DMS", true},
+		{"https://[::1]:8443", "https://[::1]:8443", true},
+		{"*.Example.org", "https://*.example.org", true},
+		{"http://*.example.org:8080/", "http://*.example.org:8080", true},
+		{"", "", false},
+		{"ftp://example.org", "", false},
+		{"*.example.co.uk", "https://*.example.co.uk", true},
+		{"*.org", "", false},
+		{"*.co.uk", "", false},
+		{"*.github.io", "", false},
+		{"www.*.example.org", "", false},
+		{"*.example.org/dms", "", false},
+		{"https://user@example.org", "", false},
+	}
+
+	for _, c := range cases {
+		origin, err := NormalizeOrigin(c.raw)
+		if valid := err == nil; valid != c.valid {
+			t.Errorf("%q: expected valid %v, got %v", c.raw, c.valid, err)
+			continue
+		}
+		if origin != c.origin {
+			t.Errorf("%q: expected %q, got %q", c.raw, c.origin, origin)
+		}
+	}
+}
+
+func TestOriginCandidates(t *testing.T) {
+	got := OriginCandidates("https://dms.eu.example.org:8443/a/b")
+	want := []string{
+		"https://dms.eu.example.org:8443/a/b",
+		"https://dms.eu.example.org:8443/a",
+		"https://dms.eu.example.org:8443",
+		"https://*.eu.example.org:8443",
+		"https://*.example.org:8443",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v, got %v", want, got)
+	}
+}
+
+func TestAuthenticateOrigins(t *testing.T) {
+	s, store := newTestServer(t)
+
+	// Bob covers all subdomains, while Alice is more specific
+	app, _ := store.GetApplicationByID(testBobAppID)
+	app.Origins = []string{"https://*.example.com"}
+	store.ReplaceApplication(app)
+	app, _ = store.GetApplicationByID(testAliceAppID)
+	app.Origins = []string{"https://*.alice.example.com", "http://localhost:8080"}
+	store.ReplaceApplication(app)
+
+	cases := []struct {
+		url string
+		app int64
+	}{
+		{"HTTPS://Alice.Example.com:443/", testAliceAppID},
+		{"alice.example.com/dms", testAliceAppID},
+		{"https://dms.alice.example.com", testAliceAppID},
+		{"http://localhost:8080/", testAliceAppID},
+		{"https://dms.example.com", testBobAppID},
+		{"https://example.com", 0},
+		{"http://alice.example.com", 0},
+		{"http://localhost", 0},
+	}
+
+	for _, c := range cases {
+		auth := s.authorize(AuthorizationRequest{AppURL: c.url, SkipSecret: true})
+		var id int64
+		if auth.App != nil {
+			id = auth.App.ID
+		}
+		if id != c.app {
+			t.Errorf("%q: expected application %d, got %d (%s)", c.url, c.app, id, auth.Reason)
+		}
+	}
+}
+
+func TestApplicationOrigins(t *testing.T) {
+	s, store := newTestServer(t)
+
+	rec := serve(t, s, store, testAliceID, "PUT", "/api/2.0/applications/5",
+		`{"name":"Alice","app_domain":"https://alice.example.com","token":"alice","active":true,"permissions":["data-search","data-legacy"],"klinks":["k-admin"],"origins":["*.Alice.example.com/","https://alice.example.com"]}`)
+	if rec.Code != 200 {
+		t.Fatalf("expected the origins to be saved, got %d: %s", rec.Code, rec.Body.String())
+	}
+	app, _ := store.GetApplicationByID(testAliceAppID)
+	if !reflect.DeepEqual(app.Origins, []string{"https://*.alice.example.com"}) {
+		t.Errorf("expected normalised origins without the URL, got %v", app.Origins)
+	}
+
+	rec = serve(t, s, store, testBobID, "PUT", "/api/2.0/applications/6",
+		`{"name":"Bob","app_domain":"https://bob.example.com","token":"bob","active":true,"origins":["https://*.alice.example.com"]}`)
+	if rec.Code != 409 {
+		t.Errorf("expected an origin of another application to be rejected, got %d", rec.Code)
+	}
+
+	rec = serve(t, s, store, testBobID, "PUT", "/api/2.0/applications/6",
+		`{"name":"Bob","app_domain":"https://bob.example.com","token":"bob","active":true,"origins":["*.com"]}`)
+	if rec.Code != 422 {
+		t.Errorf("expected an invalid pattern to be rejected, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,151 @@
+package klinkregistry
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultPermissions contains the built-in permissions handled by the
+// registry. They are created on every start if missing and cannot be
+// deleted.
+var DefaultPermissions = []Permission{
+	{Name: "data-add", Description: "Add new data to a K-Link"},
+	{Name: "data-edit", Description: "Edit data inside a K-Link", Implies: []string{"data-view"}},
+	{Name: "data-remove-all", Description: "Remove any data from a K-Link", Implies: []string{"data-remove-own"}},
+	{Name: "data-remove-own", Description: "Remove data added by the application"},
+	{Name: "data-search", Description: "Search the data of a K-Link"},
+	{Name: "data-view", Description: "View the data of a K-Link"},
+}
+
+// permissionNamePattern matches valid permission names. Names are stored as
+// comma separated lists, so the set of characters is restricted.
+var permissionNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{0,149}$`)
+
+// IsValidPermissionName returns true if the name may be used for a new
+// permission
+func IsValidPermissionName(name string) bool {
+	return permissionNamePattern.MatchString(name)
+}
+
+// CheckImplies returns false if the permission implies itself or any
+// permission that is not part of the catalogue
+func CheckImplies(store Storer, name string, implies []string) (bool, error) {
+	if stringInSlice(name, implies) {
+		return false, nil
+	}
+
+	permissions, err := store.ListPermissions()
+	if err != nil && !store.IsNotFound(err) {
+		return false, err
+	}
+
+	known := make([]string, 0, len(permissions))
+	for _, permission := range permissions {
+		known = append(known, permission.Name)
+	}
+
+	return isSubset(implies, known), nil
+}
+
+// IsBuiltInPermission returns true if the permission is part of the
+// DefaultPermissions
+func IsBuiltInPermission(name string) bool {
+	for _, permission := range DefaultPermissions {
+		if permission.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ReconcilePermissions creates the built-in permissions that do not exist
+// inside the store. Existing permissions keep their settings, except for
+// missing descriptions and implied permissions, which are filled in.
+func ReconcilePermissions(store Storer, permissions []Permission) error {
+	for _, builtIn := range permissions {
+		p := builtIn
+
+		existing, err := store.GetPermission(p.Name)
+		if store.IsNotFound(err) {
+			if err := store.CreatePermission(&p); err != nil {
+				return errors.Wrapf(err, "Error creating permission %s", p.Name)
+			}
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "Error querying for permission %s", p.Name)
+		}
+
+		changed := false
+		if existing.Description == "" && p.Description != "" {
+			existing.Description = p.Description
+			changed = true
+		}
+		if len(existing.Implies) == 0 && len(p.Implies) > 0 {
+			existing.Implies = p.Implies
+			changed = true
+		}
+
+		if changed {
+			if err := store.UpdatePermission(existing); err != nil {
+				return errors.Wrapf(err, "Error updating permission %s", p.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// matchPermission returns true if the granted permission covers the name.
+// Granted permissions ending with `*` match every name with the same prefix,
+// e.g. `data-*` matches `data-add`.
+func matchPermission(granted, name string) bool {
+	if strings.HasSuffix(granted, "*") {
+		return strings.HasPrefix(name, strings.TrimSuffix(granted, "*"))
+	}
+	return granted == name
+}
+
+// ExpandPermissions returns the effective set of the granted permissions.
+// Wildcards are replaced by the matching permissions of the catalogue, and
+// the permissions implied by each permission are added recursively. Granted
+// names that are not part of the catalogue are kept as they are.
+func ExpandPermissions(granted []string, catalogue []*Permission) []string {
+	byName := make(map[string]*Permission, len(catalogue))
+	for _, permission := range catalogue {
+		byName[permission.Name] = permission
+	}
+
+	var pending []string
+	for _, g := range granted {
+		if !strings.HasSuffix(g, "*") {
+			pending = append(pending, g)
+			continue
+		}
+		for _, permission := range catalogue {
+			if matchPermission(g, permission.Name) {
+				pending = append(pending, permission.Name)
+			}
+		}
+	}
+
+	effective := make([]string, 0, len(pending))
+	seen := make(map[string]bool, len(pending))
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		effective = append(effective, name)
+
+		if permission, ok := byName[name]; ok {
+			pending = append(pending, permission.Implies...)
+		}
+	}
+
+	return effective
+}
@@ -0,0 +1,268 @@
+package klinkregistry
+
+import (
+	"sort"
+	"strings"
+)
+
+// Capabilities that can be granted to a role. A capability allows an action
+// on every resource of its kind; registrants may always act on resources
+// they own (their own account or applications) without holding the
+// corresponding capability. The klink capabilities can also be granted by a
+// K-Link role, in which case they only apply to that K-Link.
+const (
+	CapRegistrantCreate = "registrant.create"
+	CapRegistrantView   = "registrant.view"
+	CapRegistrantUpdate = "registrant.update"
+	CapRegistrantDelete = "registrant.delete"
+
+	CapApplicationCreate   = "application.create"
+	CapApplicationView     = "application.view"
+	CapApplicationUpdate   = "application.update"
+	CapApplicationDelete   = "application.delete"
+	CapApplicationSetOwner = "application.set-owner"
+	CapApplicationGrant    = "application.grant"
+	CapApplicationRenew    = "application.renew"
+
+	CapKlinkCreate = "klink.create"
+	CapKlinkView   = "klink.view"
+	CapKlinkUpdate = "klink.update"
+	CapKlinkDelete = "klink.delete"
+	CapKlinkBrowse = "klink.browse"
+	CapKlinkJoin   = "klink.join"
+
+	CapKlinkMemberManage       = "klink.member.manage"
+	CapKlinkApplicationView    = "klink.application.view"
+	CapKlinkApplicationApprove = "klink.application.approve"
+
+	CapPermissionView   = "permission.view"
+	CapPermissionCreate = "permission.create"
+	CapPermissionUpdate = "permission.update"
+	CapPermissionDelete = "permission.delete"
+
+	CapPeerManage    = "peer.manage"
+	CapWebhookManage = "webhook.manage"
+
+	// CapAll grants every capability, including the ones added in the future
+	CapAll = "*"
+)
+
+// DefaultRoles contains the capabilities granted to the built-in roles. The
+// definitions can be overridden in the configuration file.
+var DefaultRoles = map[string][]string{
+	RoleUser: {
+		CapApplicationCreate,
+		CapPermissionView,
+		CapKlinkBrowse,
+		CapKlinkJoin,
+	},
+	RoleAdmin: {
+		CapRegistrantCreate,
+		CapRegistrantView,
+		CapRegistrantUpdate,
+		CapRegistrantDelete,
+		CapApplicationCreate,
+		CapApplicationView,
+		CapApplicationUpdate,
+		CapApplicationDelete,
+		CapApplicationSetOwner,
+		CapApplicationGrant,
+		CapApplicationRenew,
+		CapKlinkCreate,
+		CapKlinkView,
+		CapKlinkUpdate,
+		CapKlinkDelete,
+		CapKlinkBrowse,
+		CapKlinkJoin,
+		CapKlinkMemberManage,
+		CapKlinkApplicationView,
+		CapKlinkApplicationApprove,
+		CapPermissionView,
+		CapPermissionCreate,
+		CapPermissionUpdate,
+		CapPermissionDelete,
+		CapPeerManage,
+		CapWebhookManage,
+	},
+	RoleOwner: {
+		CapAll,
+	},
+}
+
+// DefaultKlinkRoles contains the capabilities granted to the members of a
+// K-Link, depending on their role inside the K-Link.
+var DefaultKlinkRoles = map[string][]string{
+	KlinkRoleManager: {
+		CapKlinkView,
+		CapKlinkUpdate,
+		CapKlinkDelete,
+		CapKlinkMemberManage,
+		CapKlinkApplicationView,
+		CapKlinkApplicationApprove,
+	},
+	KlinkRoleCurator: {
+		CapKlinkView,
+		CapKlinkUpdate,
+		CapKlinkApplicationView,
+	},
+	KlinkRoleViewer: {
+		CapKlinkView,
+	},
+}
+
+// Policy decides which capabilities a role holds. Unknown roles do not hold
+// any capability.
+type Policy struct {
+	roles      map[string]map[string]bool
+	klinkRoles map[string]map[string]bool
+}
+
+// NewPolicy returns a Policy based on the DefaultRoles and
+// DefaultKlinkRoles, where every role definition in the overrides replaces
+// the default definition of that role. The configuration lowercases the
+// keys of maps, so role names are matched case-insensitively.
+func NewPolicy(overrides, klinkOverrides map[string][]string) *Policy {
+	p := &Policy{
+		roles:      make(map[string]map[string]bool),
+		klinkRoles: make(map[string]map[string]bool),
+	}
+
+	for role, capabilities := range DefaultRoles {
+		setRole(p.roles, role, capabilities)
+	}
+	for role, capabilities := range overrides {
+		setRole(p.roles, strings.ToUpper(role), capabilities)
+	}
+
+	for role, capabilities := range DefaultKlinkRoles {
+		setRole(p.klinkRoles, role, capabilities)
+	}
+	for role, capabilities := range klinkOverrides {
+		setRole(p.klinkRoles, strings.ToLower(role), capabilities)
+	}
+
+	return p
+}
+
+func setRole(roles map[string]map[string]bool, role string, capabilities []string) {
+	set := make(map[string]bool, len(capabilities))
+	for _, capability := range capabilities {
+		set[capability] = true
+	}
+	roles[role] = set
+}
+
+// Can returns true if the role holds the capability
+func (p *Policy) Can(role, capability string) bool {
+	capabilities, ok := p.roles[role]
+	if !ok {
+		return false
+	}
+
+	return capabilities[CapAll] || capabilities[capability]
+}
+
+// Covers returns true if the role holds every capability of the other role.
+// It is used to prevent registrants from promoting others to, or removing
+// registrants of, a role that is more privileged than their own.
+func (p *Policy) Covers(role, other string) bool {
+	if p.Can(role, CapAll) {
+		return true
+	}
+
+	for capability := range p.roles[other] {
+		if !p.Can(role, capability) {
+			return false
+		}
+	}
+	return true
+}
+
+// CanInKlink returns true if the K-Link role holds the capability
+func (p *Policy) CanInKlink(klinkRole, capability string) bool {
+	capabilities, ok := p.klinkRoles[klinkRole]
+	if !ok {
+		return false
+	}
+
+	return capabilities[CapAll] || capabilities[capability]
+}
+
+// IsKlinkRole returns true if the K-Link role is defined
+func (p *Policy) IsKlinkRole(klinkRole string) bool {
+	_, ok := p.klinkRoles[klinkRole]
+	return ok
+}
+
+// IsRole returns true if the role is defined
+func (p *Policy) IsRole(role string) bool {
+	_, ok := p.roles[role]
+	return ok
+}
+
+// Capabilities returns a sorted list of all capabilities held by the role
+func (p *Policy) Capabilities(role string) []string {
+	capabilities := make([]string, 0, len(p.roles[role]))
+	for capability := range p.roles[role] {
+		capabilities = append(capabilities, capability)
+	}
+	sort.Strings(capabilities)
+
+	return capabilities
+}
+
+// can returns true if the user of a session holds the capability. A nil
+// user, which is the case for unauthenticated requests, holds nothing.
+func (s *Server) can(u *User, capability string) bool {
+	if u == nil {
+		return false
+	}
+	return s.policy.Can(u.Role, capability)
+}
+
+// canInKlink returns true if the user holds the capability, either through
+// the global role or through the membership inside the klink.
+func (s *Server) canInKlink(u *User, klink *Klink, capability string) bool {
+	if u == nil || klink == nil {
+		return false
+	}
+	if s.policy.Can(u.Role, capability) {
+		return true
+	}
+
+	member, err := s.store.GetKlinkMember(klink.ID, u.ID)
+	if err != nil {
+		// not a member, or the membership could not be determined
+		return false
+	}
+	return s.policy.CanInKlink(member.Role, capability)
+}
+
+// canBrowse returns true if the user may see the klink to request joining it
+func (s *Server) canBrowse(u *User, klink *Klink) bool {
+	return klink.Active && s.can(u, CapKlinkBrowse)
+}
+
+// klinksWith returns the IDs of all klinks in which the user holds the
+// capability through a membership. Capabilities of the global role are not
+// taken into account.
+func (s *Server) klinksWith(u *User, capability string) (map[int64]bool, error) {
+	klinks := make(map[int64]bool)
+	if u == nil {
+		return klinks, nil
+	}
+
+	memberships, err := s.store.ListKlinkMembershipsByRegistrant(u.ID)
+	if s.store.IsNotFound(err) {
+		return klinks, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	for _, member := range memberships {
+		if s.policy.CanInKlink(member.Role, capability) {
+			klinks[member.KlinkID] = true
+		}
+	}
+	return klinks, nil
+}
@@ -0,0 +1,357 @@
+package klinkregistry
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// IDs of the fixtures created by newTestServer
+const (
+	testOwnerID int64 = iota + 1
+	testAdminID
+	testAliceID
+	testBobID
+	testAliceAppID
+	testBobAppID
+	testKlinkID
+	testCarolID
+	testAccessRequestID
+)
+
+const testKlinkIdentifier = "k-admin"
+
+// newTestServer returns a server backed by a memStore, which contains an
+// owner, an admin, two users that own an application each and a K-Link
+// managed by the admin, with a third user as curator. Only the application
+// of Alice publishes to the K-Link, the application of Bob has requested
+// access to it.
+func newTestServer(t *testing.T) (*Server, *memStore) {
+	s, err := NewServer(&Config{HTTPSecret: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store := newMemStore()
+	store.CreateRegistrant(&Registrant{Email: "owner@example.com", Name: "Owner", Role: RoleOwner, Active: true})
+	store.CreateRegistrant(&Registrant{Email: "admin@example.com", Name: "Admin", Role: RoleAdmin, Active: true})
+	store.CreateRegistrant(&Registrant{Email: "alice@example.com", Name: "Alice", Role: RoleUser, Active: true})
+	store.CreateRegistrant(&Registrant{Email: "bob@example.com", Name: "Bob", Role: RoleUser, Active: true})
+	store.CreateApplication(&Application{OwnerID: testAliceID, Name: "Alice", URL: "https://alice.example.com", Token: "alice", Permissions: []string{"data-search", "data-legacy"}, Grants: []KlinkGrant{{Klink: testKlinkIdentifier, Permissions: []string{"data-search"}}}, Active: true, VerifiedAt: 1})
+	store.CreateApplication(&Application{OwnerID: testBobID, Name: "Bob", URL: "https://bob.example.com", Token: "bob", Active: true, VerifiedAt: 1})
+	store.CreateKlink(&Klink{Identifier: testKlinkIdentifier, ManagerID: testAdminID, Name: "K-Link", Active: true})
+	store.CreateRegistrant(&Registrant{Email: "carol@example.com", Name: "Carol", Role: RoleUser, Active: true})
+	store.SaveKlinkMember(&KlinkMember{KlinkID: testKlinkID, RegistrantID: testAdminID, Role: KlinkRoleManager})
+	store.SaveKlinkMember(&KlinkMember{KlinkID: testKlinkID, RegistrantID: testCarolID, Role: KlinkRoleCurator})
+	store.CreateAccessRequest(&AccessRequest{ApplicationID: testBobAppID, KlinkID: testKlinkID, Permissions: []string{"data-search"}, Status: RequestPending, RequestedBy: testBobID})
+	store.CreatePermission(&Permission{Name: "data-search"})
+	store.CreatePermission(&Permission{Name: "data-legacy", Deprecated: true})
+
+	s.SetStore(store)
+	return s, store
+}
+
+// serve sends a request to the server on behalf of the registrant with the
+// given ID. An ID of 0 sends an unauthenticated request.
+func serve(t *testing.T, s *Server, store *memStore, as int64, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+
+	if as != 0 {
+		registrant, err := store.GetRegistrantByID(as)
+		if err != nil {
+			t.Fatalf("unknown registrant %d", as)
+		}
+
+		user := User{ID: registrant.ID, Role: registrant.Role, DisplayName: registrant.Name}
+		token, err := s.sessions.GenerateToken(user, time.Now().Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestRouteAuthorization(t *testing.T) {
+	const (
+		anonymous = 0
+		owner     = testOwnerID
+		admin     = testAdminID
+		alice     = testAliceID
+		bob       = testBobID
+		carol     = testCarolID
+	)
+
+	aliceJSON := `{"name":"Alice","email":"alice@example.com","role":"ROLE_USER","active":true}`
+	appJSON := `{"name":"App","app_domain":"https://app.example.com","permissions":["data-search"],"active":true}`
+	klinkJSON := `{"name":"K-Link","website":"https://klink.example.com","active":true}`
+
+	cases := []struct {
+		as     int64
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{anonymous, "GET", "/auth/session", "", 401},
+		{alice, "GET", "/auth/session", "", 200},
+
+		{anonymous, "GET", "/registrants/", "", 401},
+		{alice, "GET", "/registrants/", "", 200},
+		{admin, "GET", "/registrants/", "", 200},
+
+		{alice, "POST", "/registrants/", `{"email":"new@example.com","role":"ROLE_USER"}`, 403},
+		{admin, "POST", "/registrants/", `{"email":"new@example.com","role":"ROLE_USER"}`, 200},
+		{admin, "POST", "/registrants/", `{"email":"new@example.com","role":"ROLE_OWNER"}`, 422},
+		{owner, "POST", "/registrants/", `{"email":"new@example.com","role":"ROLE_OWNER"}`, 200},
+		{admin, "POST", "/registrants/", `{"email":"new@example.com","role":"ROLE_UNKNOWN"}`, 422},
+
+		{alice, "GET", "/registrants/3", "", 200},
+		{bob, "GET", "/registrants/3", "", 403},
+		{admin, "GET", "/registrants/3", "", 200},
+
+		{alice, "PUT", "/registrants/3", aliceJSON, 200},
+		{bob, "PUT", "/registrants/3", aliceJSON, 403},
+		{admin, "PUT", "/registrants/3", aliceJSON, 200},
+		{admin, "PUT", "/registrants/3", strings.Replace(aliceJSON, "ROLE_USER", "ROLE_OWNER", 1), 422},
+		{admin, "PUT", "/registrants/1", `{"name":"Owner","email":"owner@example.com","role":"ROLE_OWNER","active":true}`, 403},
+		{owner, "PUT", "/registrants/3", strings.Replace(aliceJSON, "ROLE_USER", "ROLE_ADMIN", 1), 200},
+
+		{alice, "DELETE", "/registrants/4", "", 403},
+		{admin, "DELETE", "/registrants/4", "", 200},
+		{admin, "DELETE", "/registrants/1", "", 403},
+		{owner, "DELETE", "/registrants/2", "", 200},
+
+		{anonymous, "GET", "/applications/", "", 401},
+		{alice, "GET", "/applications/", "", 200},
+		{alice, "POST", "/applications/", appJSON, 200},
+		{admin, "POST", "/applications/", appJSON, 200},
+
+		{alice, "GET", "/applications/5", "", 200},
+		{bob, "GET", "/applications/5", "", 403},
+		{admin, "GET", "/applications/5", "", 200},
+
+		{alice, "PUT", "/applications/5", appJSON, 200},
+		{bob, "PUT", "/applications/5", appJSON, 403},
+		{admin, "PUT", "/applications/5", appJSON, 200},
+
+		{carol, "GET", "/applications/5", "", 200},
+		{carol, "GET", "/applications/6", "", 403},
+		{carol, "PUT", "/applications/5", appJSON, 403},
+
+		{bob, "PUT", "/applications/6", `{"name":"Bob","klinks":["k-admin"],"active":true}`, 403},
+		{admin, "PUT", "/applications/6", `{"name":"Bob","klinks":["k-admin"],"active":true}`, 200},
+
+		{bob, "DELETE", "/applications/5", "", 403},
+		{alice, "DELETE", "/applications/5", "", 200},
+		{admin, "DELETE", "/applications/5", "", 200},
+
+		{anonymous, "GET", "/klinks/", "", 401},
+		{alice, "GET", "/klinks/", "", 200},
+		{alice, "POST", "/klinks/", klinkJSON, 403},
+		{admin, "POST", "/klinks/", klinkJSON, 200},
+		{owner, "POST", "/klinks/", klinkJSON, 200},
+
+		{alice, "GET", "/klinks/" + testKlinkIdentifier, "", 200},
+		{carol, "GET", "/klinks/" + testKlinkIdentifier, "", 200},
+		{owner, "GET", "/klinks/" + testKlinkIdentifier, "", 200},
+		{alice, "PUT", "/klinks/" + testKlinkIdentifier, klinkJSON, 403},
+		{carol, "PUT", "/klinks/" + testKlinkIdentifier, klinkJSON, 200},
+		{admin, "PUT", "/klinks/" + testKlinkIdentifier, klinkJSON, 200},
+		{owner, "PUT", "/klinks/" + testKlinkIdentifier, klinkJSON, 200},
+		{alice, "DELETE", "/klinks/" + testKlinkIdentifier, "", 403},
+		{carol, "DELETE", "/klinks/" + testKlinkIdentifier, "", 403},
+		{admin, "DELETE", "/klinks/" + testKlinkIdentifier, "", 200},
+
+		{alice, "GET", "/klinks/" + testKlinkIdentifier + "/members", "", 403},
+		{carol, "GET", "/klinks/" + testKlinkIdentifier + "/members", "", 200},
+		{carol, "POST", "/klinks/" + testKlinkIdentifier + "/members", `{"email":"bob@example.com","role":"viewer"}`, 403},
+		{admin, "POST", "/klinks/" + testKlinkIdentifier + "/members", `{"email":"bob@example.com","role":"viewer"}`, 200},
+		{admin, "POST", "/klinks/" + testKlinkIdentifier + "/members", `{"email":"bob@example.com","role":"king"}`, 422},
+		{admin, "POST", "/klinks/" + testKlinkIdentifier + "/members", `{"registrant_id":2,"role":"viewer"}`, 409},
+		{carol, "DELETE", "/klinks/" + testKlinkIdentifier + "/members/2", "", 403},
+		{carol, "DELETE", "/klinks/" + testKlinkIdentifier + "/members/8", "", 200},
+		{admin, "DELETE", "/klinks/" + testKlinkIdentifier + "/members/8", "", 200},
+		{admin, "DELETE", "/klinks/" + testKlinkIdentifier + "/members/2", "", 409},
+
+		{alice, "GET", "/applications/5/access-requests", "", 200},
+		{bob, "GET", "/applications/5/access-requests", "", 403},
+		{alice, "POST", "/applications/5/access-requests", `{"klink":"k-admin","permissions":["data-search"]}`, 200},
+		{bob, "POST", "/applications/5/access-requests", `{"klink":"k-admin","permissions":["data-search"]}`, 403},
+		{alice, "POST", "/applications/5/access-requests", `{"klink":"k-admin","permissions":["data-destroy"]}`, 422},
+		{alice, "POST", "/applications/5/access-requests", `{"klink":"k-unknown","permissions":["data-search"]}`, 422},
+		{bob, "POST", "/applications/6/access-requests", `{"klink":"k-admin","permissions":["data-search"]}`, 409},
+
+		{alice, "POST", "/applications/5/dry-run", `{"permissions":["data-search"]}`, 200},
+		{carol, "POST", "/applications/5/dry-run", `{"permissions":["data-search"]}`, 403},
+		{admin, "POST", "/applications/5/dry-run", `{"permissions":["data-search"]}`, 200},
+
+		{carol, "GET", "/klinks/" + testKlinkIdentifier + "/access-requests", "", 403},
+		{admin, "GET", "/klinks/" + testKlinkIdentifier + "/access-requests?status=pending", "", 200},
+		{carol, "POST", "/klinks/" + testKlinkIdentifier + "/access-requests/9/approve", "", 403},
+		{admin, "POST", "/klinks/" + testKlinkIdentifier + "/access-requests/9/approve", "", 200},
+		{admin, "POST", "/klinks/" + testKlinkIdentifier + "/access-requests/9/reject", `{"reason":"unknown project"}`, 200},
+		{admin, "POST", "/klinks/" + testKlinkIdentifier + "/access-requests/5/reject", "", 404},
+
+		{anonymous, "GET", "/permissions/", "", 401},
+		{alice, "GET", "/permissions/", "", 200},
+		{alice, "POST", "/permissions/", `{"name":"data-export"}`, 403},
+		{admin, "POST", "/permissions/", `{"name":"data-export","description":"Export data"}`, 200},
+		{admin, "POST", "/permissions/", `{"name":"Data Export"}`, 422},
+		{admin, "POST", "/permissions/", `{"name":"data-search"}`, 409},
+		{alice, "PUT", "/permissions/data-search", `{"description":"Search"}`, 403},
+		{admin, "PUT", "/permissions/data-search", `{"description":"Search"}`, 200},
+		{admin, "PUT", "/permissions/data-unknown", `{"description":"Unknown"}`, 404},
+		{alice, "DELETE", "/permissions/data-unknown", "", 403},
+		{admin, "DELETE", "/permissions/data-unknown", "", 200},
+		{admin, "DELETE", "/permissions/data-search", "", 409},
+		{admin, "DELETE", "/permissions/data-legacy", "", 409},
+		{alice, "POST", "/applications/5/access-requests", `{"klink":"k-admin","permissions":["data-legacy"]}`, 422},
+	}
+
+	for _, c := range cases {
+		s, store := newTestServer(t)
+		rec := serve(t, s, store, c.as, c.method, "/api/2.0"+c.path, c.body)
+		if rec.Code != c.want {
+			t.Errorf("%s %s as %d: expected status %d, got %d: %s",
+				c.method, c.path, c.as, c.want, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestPolicyOverrides(t *testing.T) {
+	p := NewPolicy(map[string][]string{
+		RoleUser: {CapKlinkCreate},
+	}, nil)
+
+	if !p.Can(RoleUser, CapKlinkCreate) {
+		t.Error("expected overridden role to hold the configured capability")
+	}
+	if p.Can(RoleUser, CapApplicationCreate) {
+		t.Error("expected overridden role to lose its default capabilities")
+	}
+	if !p.Can(RoleAdmin, CapKlinkCreate) {
+		t.Error("expected roles without override to keep their defaults")
+	}
+	if !p.Can(RoleOwner, "anything") {
+		t.Error("expected the * capability to grant everything")
+	}
+	if p.Can("ROLE_UNKNOWN", CapKlinkView) {
+		t.Error("expected unknown roles to hold no capability")
+	}
+	if !p.Covers(RoleAdmin, RoleUser) || p.Covers(RoleUser, RoleAdmin) {
+		t.Error("expected admins to cover users, but not the other way round")
+	}
+}
+
+func TestPolicyOverridesFromConfig(t *testing.T) {
+	config := viper.New()
+	config.SetConfigType("yaml")
+	err := config.ReadConfig(strings.NewReader(`
+roles:
+  ROLE_USER:
+    - klink.create
+klink_roles:
+  Viewer:
+    - klink.application.view
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := NewPolicy(config.GetStringMapStringSlice("roles"), config.GetStringMapStringSlice("klink_roles"))
+	if !p.Can(RoleUser, CapKlinkCreate) || p.Can(RoleUser, CapApplicationCreate) {
+		t.Error("expected the role override of the configuration file to apply")
+	}
+	if !p.CanInKlink(KlinkRoleViewer, CapKlinkApplicationView) || p.CanInKlink(KlinkRoleViewer, CapKlinkView) {
+		t.Error("expected the K-Link role override of the configuration file to apply")
+	}
+}
+
+func TestAccessRequestApproval(t *testing.T) {
+	s, store := newTestServer(t)
+
+	path := "/api/2.0/klinks/" + testKlinkIdentifier + "/access-requests/9/approve"
+	if rec := serve(t, s, store, testAdminID, "POST", path, ""); rec.Code != 200 {
+		t.Fatalf("expected approval to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	app, _ := store.GetApplicationByID(testBobAppID)
+	grant := app.GetGrant(testKlinkIdentifier)
+	if grant == nil || !stringInSlice("data-search", grant.Permissions) {
+		t.Errorf("expected the approved access to be granted, got grants %v", app.Grants)
+	}
+	if !stringInSlice("data-search", app.Permissions) {
+		t.Errorf("expected the approved permissions to be kept for clients without klink_id, got %v", app.Permissions)
+	}
+
+	// legacy clients do not pass a klink_id
+	body := `{"id":"1","params":{"app_url":"https://bob.example.com","app_secret":"bob","permissions":["data-search"]}}`
+	if rec := serve(t, s, store, 0, "POST", "/api/1.0/application.authenticate", body); !strings.Contains(rec.Body.String(), `"result"`) {
+		t.Errorf("expected the approved permissions to be granted without klink_id, got %s", rec.Body.String())
+	}
+
+	if rec := serve(t, s, store, testAdminID, "POST", path, ""); rec.Code != 409 {
+		t.Errorf("expected a decided request to be final, got %d", rec.Code)
+	}
+}
+
+func TestReconcilePermissions(t *testing.T) {
+	store := newMemStore()
+	store.CreatePermission(&Permission{Name: "data-search", Description: "Custom", Deprecated: true})
+	store.CreatePermission(&Permission{Name: "data-view"})
+
+	if err := ReconcilePermissions(store, DefaultPermissions); err != nil {
+		t.Fatal(err)
+	}
+
+	permissions, _ := store.ListPermissions()
+	if len(permissions) != len(DefaultPermissions) {
+		t.Errorf("expected %d permissions, got %d", len(DefaultPermissions), len(permissions))
+	}
+
+	search, _ := store.GetPermission("data-search")
+	if search.Description != "Custom" || !search.Deprecated {
+		t.Errorf("expected existing permissions to keep their settings, got %+v", search)
+	}
+
+	view, _ := store.GetPermission("data-view")
+	if view.Description == "" {
+		t.Error("expected missing descriptions to be filled in")
+	}
+}
+
+func TestExpandPermissions(t *testing.T) {
+	catalogue := []*Permission{
+		{Name: "a", Implies: []string{"b"}},
+		{Name: "b", Implies: []string{"c", "a"}},
+		{Name: "c"},
+		{Name: "x-1"},
+		{Name: "x-2"},
+	}
+
+	cases := []struct {
+		granted []string
+		want    []string
+	}{
+		{[]string{"a"}, []string{"a", "b", "c"}},
+		{[]string{"c"}, []string{"c"}},
+		{[]string{"x-*"}, []string{"x-1", "x-2"}},
+		{[]string{"unknown", "c"}, []string{"unknown", "c"}},
+		{[]string{"*"}, []string{"a", "b", "c", "x-1", "x-2"}},
+	}
+
+	for _, c := range cases {
+		got := ExpandPermissions(c.granted, catalogue)
+		if len(got) != len(c.want) || !isSubset(c.want, got) {
+			t.Errorf("expand %v: expected %v, got %v", c.granted, c.want, got)
+		}
+	}
+}
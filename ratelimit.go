@@ -0,0 +1,238 @@
+package klinkregistry
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// rateLimitMaxBody is the maximum size of a request body that is read to
+// determine the rate limit keys
+const rateLimitMaxBody = 64 << 10
+
+// A RateLimitStore holds token buckets by key. The in-memory
+// MemoryRateLimitStore is used by default; a shared store can be configured
+// when several instances of the registry serve the same clients.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of the key, which holds up to
+	// limit tokens and refills limit tokens per period. If the bucket is
+	// empty, false is returned together with the time until the next token
+	// is available.
+	Take(key string, limit int, period time.Duration, now time.Time) (bool, time.Duration)
+}
+
+type tokenBucket struct {
+	tokens    float64
+	period    time.Duration
+	updatedAt time.Time
+}
+
+// MemoryRateLimitStore is an in-process RateLimitStore. Buckets that are full
+// again are removed from time to time.
+type MemoryRateLimitStore struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	sweptAt time.Time
+}
+
+// NewMemoryRateLimitStore returns an empty MemoryRateLimitStore
+func NewMemoryRateLimitStore() *MemoryRateLimitStore {
+	return &MemoryRateLimitStore{buckets: make(map[string]*tokenBucket)}
+}
+
+// Take implements RateLimitStore
+func (m *MemoryRateLimitStore) Take(key string, limit int, period time.Duration, now time.Time) (bool, time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sweep(now)
+
+	rate := float64(limit) / period.Seconds()
+	bucket, ok := m.buckets[key]
+	if !ok {
+		bucket = &tokenBucket{tokens: float64(limit), period: period, updatedAt: now}
+		m.buckets[key] = bucket
+	}
+
+	elapsed := now.Sub(bucket.updatedAt).Seconds()
+	bucket.tokens = math.Min(float64(limit), bucket.tokens+elapsed*rate)
+	bucket.updatedAt = now
+
+	if bucket.tokens < 1 {
+		wait := time.Duration((1 - bucket.tokens) / rate * float64(time.Second))
+		return false, wait
+	}
+
+	bucket.tokens--
+	return true, 0
+}
+
+// sweep removes the buckets that have been refilled completely, at most once
+// per minute
+func (m *MemoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(m.sweptAt) < time.Minute {
+		return
+	}
+	m.sweptAt = now
+
+	for key, bucket := range m.buckets {
+		if now.Sub(bucket.updatedAt) > bucket.period {
+			delete(m.buckets, key)
+		}
+	}
+}
+
+// rateLimit allows limit requests per period for each key of a request. The
+// key function receives the request and its body, and may return an empty
+// key to skip the limit.
+type rateLimit struct {
+	name   string
+	limit  int
+	period time.Duration
+	key    func(req *http.Request, body []byte) string
+}
+
+// clientIP returns the IP address of the client. Proxy headers are only
+// trusted if configured, as clients could send them to evade the limits. Of
+// X-Forwarded-For the last address is taken, which the trusted proxy added;
+// the ones before it are sent by the client.
+func (s *Server) clientIP(req *http.Request) string {
+	if s.config.RateLimitTrustProxy {
+		if forwarded := req.Header.Get("X-Forwarded-For"); forwarded != "" {
+			addresses := strings.Split(forwarded, ",")
+			return strings.TrimSpace(addresses[len(addresses)-1])
+		}
+		if realIP := req.Header.Get("X-Real-IP"); realIP != "" {
+			return realIP
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+// ipRateLimit limits the requests per client IP address to limit per
+// minute. Every route passes its own name, so that its requests do not use
+// up the bucket of another.
+func (s *Server) ipRateLimit(name string, limit int) rateLimit {
+	return rateLimit{
+		name:   name + "-ip",
+		limit:  limit,
+		period: time.Minute,
+		key: func(req *http.Request, _ []byte) string {
+			return s.clientIP(req)
+		},
+	}
+}
+
+// applicationRateLimit limits the application.authenticate calls per
+// application URL and client IP. The URL is sent before the application is
+// authenticated, so the IP is part of the key, so that others cannot block
+// the application by exhausting its bucket.
+func (s *Server) applicationRateLimit() rateLimit {
+	return rateLimit{
+		name:   "application",
+		limit:  s.config.RateLimitPerApplication,
+		period: time.Minute,
+		key: func(req *http.Request, body []byte) string {
+			var request struct {
+				Parameters struct {
+					AppURL string `json:"app_url"`
+				} `json:"params"`
+			}
+			json.Unmarshal(body, &request)
+
+			if request.Parameters.AppURL == "" {
+				return ""
+			}
+			return s.clientIP(req) + ":" + request.Parameters.AppURL
+		},
+	}
+}
+
+// requestEmail returns the normalized email address of a request body
+func requestEmail(body []byte) string {
+	var request struct {
+		Email string `json:"email"`
+	}
+	json.Unmarshal(body, &request)
+	return strings.ToLower(strings.TrimSpace(request.Email))
+}
+
+// emailRateLimit limits the registrations per email address, so that no
+// address can be flooded with verification emails
+func (s *Server) emailRateLimit() rateLimit {
+	return rateLimit{
+		name:   "registration-email",
+		limit:  s.config.RateLimitPerEmail,
+		period: time.Hour,
+		key: func(_ *http.Request, body []byte) string {
+			return requestEmail(body)
+		},
+	}
+}
+
+// loginRateLimit limits the logins per email address and client IP. The IP
+// is part of the key, so that others cannot lock the owner of the address
+// out by exhausting its bucket.
+func (s *Server) loginRateLimit() rateLimit {
+	return rateLimit{
+		name:   "session-email",
+		limit:  s.config.RateLimitPerEmail,
+		period: time.Hour,
+		key: func(req *http.Request, body []byte) string {
+			email := requestEmail(body)
+			if email == "" {
+				return ""
+			}
+			return s.clientIP(req) + ":" + email
+		},
+	}
+}
+
+// limitRate provides a middleware that rejects requests exceeding one of the
+// limits with 429 Too Many Requests and a Retry-After header. Limits of 0
+// are disabled.
+func (s *Server) limitRate(limits ...rateLimit) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, req.Body, rateLimitMaxBody))
+			if err != nil {
+				jsonResponse(w, API2ErrInvalidJSON)
+				return
+			}
+			req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+			now := time.Now()
+			for _, limit := range limits {
+				if limit.limit <= 0 {
+					continue
+				}
+
+				key := limit.key(req, body)
+				if key == "" {
+					continue
+				}
+
+				ok, wait := s.rateLimits.Take(limit.name+":"+key, limit.limit, limit.period, now)
+				if !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					jsonResponse(w, API2ErrRateLimited)
+					return
+				}
+			}
+
+			next.ServeHTTP(w, req)
+		})
+	}
+}
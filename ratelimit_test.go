@@ -0,0 +1,130 @@
+package klinkregistry
+
+import (
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMemoryRateLimitStore(t *testing.T) {
+	store := NewMemoryRateLimitStore()
+	now := time.Now()
+
+	for i := 0; i < 3; i++ {
+		if ok, _ := store.Take("ip:1.2.3.4", 3, time.Minute, now); !ok {
+			t.Fatalf("expected request %d to be allowed", i)
+		}
+	}
+
+	ok, wait := store.Take("ip:1.2.3.4", 3, time.Minute, now)
+	if ok || wait < 19*time.Second || wait > 20*time.Second {
+		t.Errorf("expected to wait 20s for the next token, got %v %s", ok, wait)
+	}
+	if ok, _ := store.Take("ip:5.6.7.8", 3, time.Minute, now); !ok {
+		t.Error("expected other keys to have their own bucket")
+	}
+
+	if ok, _ := store.Take("ip:1.2.3.4", 3, time.Minute, now.Add(21*time.Second)); !ok {
+		t.Error("expected the bucket to refill")
+	}
+}
+
+func TestRateLimitMiddleware(t *testing.T) {
+	s, err := NewServer(&Config{HTTPSecret: "test", RateLimitPerEmail: 2, RateLimitPerIP: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newMemStore()
+	s.SetStore(store)
+
+	register := func(email string) (int, string) {
+		rec := serve(t, s, store, 0, "POST", "/api/2.0/auth/registration", `{"email":"`+email+`","name":"Test"}`)
+		return rec.Code, rec.Header().Get("Retry-After")
+	}
+
+	for i := 0; i < 2; i++ {
+		if code, _ := register("victim@example.com"); code == 429 {
+			t.Fatalf("expected registration %d to pass the limit", i)
+		}
+	}
+	if code, retry := register("Victim@Example.com "); code != 429 || retry != "1800" {
+		t.Errorf("expected the email to be throttled for 1800s, got %d %q", code, retry)
+	}
+	if code, _ := register("other@example.com"); code == 429 {
+		t.Error("expected other emails to pass")
+	}
+
+	// the IP limit applies across emails, including throttled requests
+	for i := 0; i < 6; i++ {
+		if code, _ := register("user" + strconv.Itoa(i) + "@example.com"); code == 429 {
+			t.Fatalf("expected request %d of the IP to pass the limit", i+5)
+		}
+	}
+	if code, _ := register("last@example.com"); code != 429 {
+		t.Errorf("expected the IP to be throttled, got %d", code)
+	}
+
+	// every route has its own buckets
+	if rec := serve(t, s, store, 0, "POST", "/api/2.0/auth/session", `{"email":"victim@example.com","password":"test"}`); rec.Code == 429 {
+		t.Error("expected logins not to be throttled by registrations")
+	}
+
+	// registrations are limited per email across IPs, logins per IP
+	fromOtherIP := func(path, body string) int {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.RemoteAddr = "198.51.100.7:1234"
+		rec := httptest.NewRecorder()
+		s.router.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := fromOtherIP("/api/2.0/auth/registration", `{"email":"victim@example.com","name":"Test"}`); code != 429 {
+		t.Errorf("expected the email to be throttled from another IP, got %d", code)
+	}
+	login := `{"email":"victim@example.com","password":"test"}`
+	for i := 0; i < 2; i++ {
+		serve(t, s, store, 0, "POST", "/api/2.0/auth/session", login)
+	}
+	if code := fromOtherIP("/api/2.0/auth/session", login); code == 429 {
+		t.Error("expected the owner of the email not to be locked out by others")
+	}
+}
+
+func TestApplicationRateLimit(t *testing.T) {
+	s, store := newTestServer(t)
+	s.config.RateLimitPerApplication = 1
+	s.initRoutes()
+
+	body := `{"id":"1","params":{"app_url":"https://alice.example.com","app_secret":"wrong","permissions":[]}}`
+	for i := 0; i < 2; i++ {
+		serve(t, s, store, 0, "POST", "/api/1.0/application.authenticate", body)
+	}
+	if rec := serve(t, s, store, 0, "POST", "/api/1.0/application.authenticate", body); rec.Code != 429 {
+		t.Errorf("expected the application URL to be throttled, got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest("POST", "/api/1.0/application.authenticate", strings.NewReader(body))
+	req.RemoteAddr = "198.51.100.7:1234"
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+	if rec.Code == 429 {
+		t.Error("expected the application not to be blocked by other clients")
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	s, _ := newTestServer(t)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.RemoteAddr = "10.0.0.1:1234"
+	req.Header.Set("X-Forwarded-For", "203.0.113.9, 198.51.100.7")
+
+	if ip := s.clientIP(req); ip != "10.0.0.1" {
+		t.Errorf("expected the proxy headers to be ignored, got %s", ip)
+	}
+
+	s.config.RateLimitTrustProxy = true
+	if ip := s.clientIP(req); ip != "198.51.100.7" {
+		t.Errorf("expected the address added by the proxy, got %s", ip)
+	}
+}
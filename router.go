@@ -1,7 +1,6 @@
 package klinkregistry
 
 import (
-	"fmt"
 	"io/ioutil"
 	"net/http"
 	"path"
@@ -10,7 +9,6 @@ import (
 	"text/template"
 
 	"github.com/go-chi/chi"
-	"github.com/go-chi/chi/middleware"
 	"github.com/pkg/errors"
 	"github.com/rs/cors"
 )
@@ -20,7 +18,8 @@ import (
 func (s *Server) initRoutes() {
 
 	apiV1Router := func(r chi.Router) {
-		r.Post("/application.authenticate", s.handleAuthenticate())
+		r.With(s.limitRate(s.ipRateLimit("authenticate", s.config.RateLimitAuthenticatePerIP), s.applicationRateLimit())).
+			Post("/application.authenticate", s.handleAuthenticate())
 	}
 
 	apiV2Router := func(r chi.Router) {
@@ -28,10 +27,12 @@ func (s *Server) initRoutes() {
 
 		// Authentication Endpoints
 		r.Route("/auth", func(r chi.Router) {
-			r.Post("/session", s.handleCreateSession())
+			r.With(s.limitRate(s.ipRateLimit("session", s.config.RateLimitPerIP), s.loginRateLimit())).
+				Post("/session", s.handleCreateSession())
 			r.Get("/session", s.handleGetSession())
 
-			r.Post("/registration", s.handlePostRegistration())
+			r.With(s.limitRate(s.ipRateLimit("registration", s.config.RateLimitPerIP), s.emailRateLimit())).
+				Post("/registration", s.handlePostRegistration())
 
 			r.Get("/email-verification/{token}", s.handleGetVerifyEmail())
 			r.Post("/email-verification/{token}", s.handlePostVerifyEmail())
@@ -39,6 +40,9 @@ func (s *Server) initRoutes() {
 			r.Post("/change-password/{token}", s.handlePostSetPassword())
 		})
 
+		// Public endpoints
+		r.Get("/directory", s.handleDirectory())
+
 		// Registrant endpoints
 		r.Route("/registrants", func(r chi.Router) {
 			r.Use(s.sessions.RequireAuthorized)
@@ -59,6 +63,33 @@ func (s *Server) initRoutes() {
 			r.Get("/{id}", s.handleGetApplication())
 			r.Put("/{id}", s.handleUpdateApplication())
 			r.Delete("/{id}", s.handleDeleteApplication())
+
+			r.Get("/{id}/access-requests", s.handleListApplicationAccessRequests())
+			r.Post("/{id}/access-requests", s.handleCreateAccessRequest())
+			r.Post("/{id}/dry-run", s.handleApplicationDryRun())
+			r.Post("/{id}/verify", s.handleVerifyApplication())
+
+			r.Get("/{id}/transfers", s.handleListOwnershipTransfers())
+			r.Post("/{id}/transfers", s.handleCreateOwnershipTransfer())
+
+			r.Put("/{id}/validity", s.handleSetApplicationValidity())
+			r.Get("/{id}/renewals", s.handleListApplicationRenewalRequests())
+			r.Post("/{id}/renewals", s.handleCreateRenewalRequest())
+			r.Post("/{id}/renewals/{renewal}/approve", s.handleDecideRenewalRequest(true))
+			r.Post("/{id}/renewals/{renewal}/reject", s.handleDecideRenewalRequest(false))
+		})
+
+		r.Route("/renewals", func(r chi.Router) {
+			r.Use(s.sessions.RequireAuthorized)
+
+			r.Get("/", s.handleListRenewalRequests())
+		})
+
+		r.Route("/transfers", func(r chi.Router) {
+			r.Use(s.sessions.RequireAuthorized)
+
+			r.Post("/{token}/accept", s.handleDecideOwnershipTransfer(true))
+			r.Post("/{token}/reject", s.handleDecideOwnershipTransfer(false))
 		})
 
 		// K-Links endpoints
@@ -70,20 +101,74 @@ func (s *Server) initRoutes() {
 			r.Get("/{id}", s.handleGetKlink())
 			r.Put("/{id}", s.handleUpdateKlink())
 			r.Delete("/{id}", s.handleDeleteKlink())
+			r.Get("/{id}/health", s.handleListHealthChecks())
+
+			r.Get("/{id}/members", s.handleListKlinkMembers())
+			r.Post("/{id}/members", s.handleSaveKlinkMember())
+			r.Delete("/{id}/members/{registrant}", s.handleDeleteKlinkMember())
+
+			r.Get("/{id}/join-requests", s.handleListKlinkJoinRequests())
+			r.Post("/{id}/join-requests", s.handleCreateJoinRequest())
+			r.Post("/{id}/join-requests/{request}/approve", s.handleDecideJoinRequest(true))
+			r.Post("/{id}/join-requests/{request}/reject", s.handleDecideJoinRequest(false))
+
+			r.Get("/{id}/access-requests", s.handleListKlinkAccessRequests())
+			r.Post("/{id}/access-requests/{request}/approve", s.handleDecideAccessRequest(true))
+			r.Post("/{id}/access-requests/{request}/reject", s.handleDecideAccessRequest(false))
 		})
 
+		r.Route("/join-requests", func(r chi.Router) {
+			r.Use(s.sessions.RequireAuthorized)
+
+			r.Get("/", s.handleListOwnJoinRequests())
+		})
+
+		r.Route("/peers", func(r chi.Router) {
+			r.Use(s.sessions.RequireAuthorized)
+
+			r.Get("/", s.handleListPeers())
+			r.Post("/", s.handleCreatePeer())
+			r.Put("/{id}", s.handleUpdatePeer())
+			r.Delete("/{id}", s.handleDeletePeer())
+			r.Post("/{id}/sync", s.handleSyncPeer())
+		})
+
+		r.Route("/webhooks", func(r chi.Router) {
+			r.Use(s.sessions.RequireAuthorized)
+
+			r.Get("/", s.handleListWebhooks())
+			r.Post("/", s.handleCreateWebhook())
+			r.Put("/{id}", s.handleUpdateWebhook())
+			r.Delete("/{id}", s.handleDeleteWebhook())
+			r.Get("/{id}/deliveries", s.handleListWebhookDeliveries())
+			r.Post("/{id}/deliveries/{delivery}/redeliver", s.handleRedeliverWebhook())
+		})
+
+		// signed with the secret of a peer instead of a session
+		r.Get("/federation/changes", s.handleFederationChanges())
+
+		// authenticated with a session or the credentials of an application
+		r.With(s.limitRate(s.ipRateLimit("events", s.config.RateLimitPerIP))).
+			Get("/events", s.handleEventStream())
+
 		r.Route("/permissions", func(r chi.Router) {
+			r.Use(s.sessions.RequireAuthorized)
+
 			r.Get("/", s.handleListPermissions())
+			r.Post("/", s.handleCreatePermission())
+			r.Put("/{name}", s.handleUpdatePermission())
+			r.Delete("/{name}", s.handleDeletePermission())
 		})
 	}
 
 	// apiRouter contains all routes for the API endpoints
 	apiRouter := func(r chi.Router) {
 		// Log all API requests
-		r.Use(middleware.Logger)
+		r.Use(s.logRequests)
 		cors := cors.New(cors.Options{
 			AllowedOrigins:   []string{"*"},
-			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
+			AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "Last-Event-ID", HeaderRequestID},
+			ExposedHeaders:   []string{HeaderRequestID},
 			AllowCredentials: true,
 		})
 		r.Use(cors.Handler)
@@ -117,16 +202,31 @@ func (s *Server) initRoutes() {
 		r.HandleFunc("/static/static/js/manifest.{blob}.js", func(w http.ResponseWriter, req *http.Request) {
 			blob := chi.URLParam(req, "blob")
 			if err := renderFile(w, s.assets, s.config.HTTPBasePath, s.config.NetworkName, s.config.EnableUserRegistration, "/static/static/js/manifest."+blob+".js"); err != nil {
-				fmt.Println(err)
+				s.requestLogger(req).WithError(err).Error("Error rendering the manifest")
 			}
 		})
 
+		r.Get("/directory", s.handleDirectoryPage())
+
 		r.Route("/api", apiRouter)
 
 		r.HandleFunc("/static/*", staticHandler(s.assets, s.config.HTTPBasePath))
 	}
 
 	mux := chi.NewMux()
+	mux.Use(s.identifyRequests)
+	mux.Use(s.measureRequests)
+
+	// metrics are served independent of the base path, unless a separate
+	// listener is configured
+	if s.config.MetricsListen == "" {
+		mux.Method("GET", "/metrics", s.handleMetrics())
+	}
+
+	// probes for orchestrators are served independent of the base path
+	mux.Get("/healthz", s.handleHealthz())
+	mux.Get("/readyz", s.handleReadyz())
+	mux.Get("/version", s.handleVersion())
 
 	// ensure router base path contains at least one slash, and is absolute
 	//with no trailing slashes
@@ -0,0 +1,178 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/k-box/k-link-registry/assets"
+	"github.com/pkg/errors"
+)
+
+// Commit is the git commit of the build. Like Version, it is set on release
+// builds with -ldflags "-X github.com/k-box/k-link-registry.Commit=<hash>".
+var Commit = ""
+
+// ReadinessCheck is the result of a single check of the readiness
+type ReadinessCheck struct {
+	Name   string `json:"name"`
+	Result string `json:"result"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// ReadinessModel is returned by /readyz
+type ReadinessModel struct {
+	Ready  bool             `json:"ready"`
+	Checks []ReadinessCheck `json:"checks"`
+}
+
+// VersionModel is returned by /version
+type VersionModel struct {
+	Version       string `json:"version"`
+	Commit        string `json:"commit,omitempty"`
+	GoVersion     string `json:"go_version"`
+	SchemaVersion *int64 `json:"schema_version,omitempty"`
+	SchemaLatest  int64  `json:"schema_latest"`
+}
+
+// latestSchemaVersion returns the revision of the last migration that is
+// shipped, read from the same migrations as the migrate command
+func (s *Server) latestSchemaVersion() (int64, error) {
+	var fs http.FileSystem = assets.Assets
+	dir := "/migrations/mysql"
+	if s.config.MigrationsDir != "" {
+		fs = http.Dir(s.config.MigrationsDir)
+		dir = "/mysql"
+	}
+
+	f, err := fs.Open(dir)
+	if err != nil {
+		return 0, errors.Wrap(err, "Could not open the migrations")
+	}
+	defer f.Close()
+
+	files, err := f.Readdir(-1)
+	if err != nil {
+		return 0, errors.Wrap(err, "Could not list the migrations")
+	}
+
+	var latest int64
+	for _, file := range files {
+		if !strings.HasSuffix(file.Name(), ".up.sql") {
+			continue
+		}
+		version, err := strconv.ParseInt(strings.SplitN(file.Name(), "_", 2)[0], 10, 64)
+		if err == nil && version > latest {
+			latest = version
+		}
+	}
+	return latest, nil
+}
+
+// pingEmailer checks that the mail server is reachable, if the Emailer
+// supports it
+func pingEmailer(email Emailer) error {
+	switch e := email.(type) {
+	case *meteredEmailer:
+		return pingEmailer(e.Emailer)
+	case interface{ Ping() error }:
+		return e.Ping()
+	}
+	return nil
+}
+
+// writeStatus writes a probe response with the status code
+func writeStatus(w http.ResponseWriter, status int, obj interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(obj)
+}
+
+// handleHealthz reports that the process is alive. It does not check any
+// dependency, so that a database outage does not restart the registry.
+func (s *Server) handleHealthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		writeStatus(w, http.StatusOK, map[string]string{"status": "ok"})
+	}
+}
+
+// handleReadyz reports if the registry can serve requests: the database is
+// reachable and migrated to the latest revision, and, if configured, the
+// mail server is reachable. It answers 503 Service Unavailable otherwise.
+// The probe is public, so errors are only logged, as they may contain
+// internal addresses.
+func (s *Server) handleReadyz() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		response := ReadinessModel{Ready: true}
+
+		pass := func(name string) {
+			response.Checks = append(response.Checks, ReadinessCheck{Name: name, Result: CheckPassed})
+		}
+		fail := func(name, detail string, err error) {
+			logger := s.requestLogger(req).WithField("check", name)
+			if err != nil {
+				logger = logger.WithError(err)
+			}
+			logger.Warn(detail)
+
+			response.Ready = false
+			response.Checks = append(response.Checks, ReadinessCheck{Name: name, Result: CheckFailed, Detail: detail})
+		}
+
+		if err := s.store.Ping(); err != nil {
+			fail("database", "The database is not reachable", err)
+		} else {
+			pass("database")
+		}
+
+		version, dirty, err := s.store.GetSchemaVersion()
+		if err != nil && !s.store.IsNotFound(err) {
+			fail("schema", "The schema version could not be loaded", err)
+		} else if latest, err := s.latestSchemaVersion(); err != nil {
+			fail("schema", "The migrations could not be read", err)
+		} else if dirty {
+			fail("schema", "The migration to revision "+strconv.FormatInt(version, 10)+" failed", nil)
+		} else if version != latest {
+			fail("schema", "The schema is at revision "+strconv.FormatInt(version, 10)+", expected "+strconv.FormatInt(latest, 10), nil)
+		} else {
+			pass("schema")
+		}
+
+		if !s.config.ReadyCheckMailer {
+			response.Checks = append(response.Checks, ReadinessCheck{Name: "mailer", Result: CheckSkipped})
+		} else if err := pingEmailer(s.email); err != nil {
+			fail("mailer", "The mail server is not reachable", err)
+		} else {
+			pass("mailer")
+		}
+
+		status := http.StatusOK
+		if !response.Ready {
+			status = http.StatusServiceUnavailable
+		}
+		writeStatus(w, status, response)
+	}
+}
+
+// handleVersion reports the version of the registry and of the database
+// schema. The schema version is omitted if the database is not available.
+func (s *Server) handleVersion() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		response := VersionModel{
+			Version:   Version,
+			Commit:    Commit,
+			GoVersion: runtime.Version(),
+		}
+
+		version, _, err := s.store.GetSchemaVersion()
+		if err == nil || s.store.IsNotFound(err) {
+			response.SchemaVersion = &version
+		}
+		response.SchemaLatest, _ = s.latestSchemaVersion()
+
+		writeStatus(w, http.StatusOK, response)
+	}
+}
@@ -0,0 +1,64 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	s, store := newTestServer(t)
+
+	latest, err := s.latestSchemaVersion()
+	if err != nil || latest == 0 {
+		t.Fatalf("expected the shipped migrations to be read, got %d %v", latest, err)
+	}
+
+	ready := func() (int, ReadinessModel) {
+		rec := serve(t, s, store, 0, "GET", "/readyz", "")
+		var response ReadinessModel
+		json.Unmarshal(rec.Body.Bytes(), &response)
+		return rec.Code, response
+	}
+
+	if code, _ := ready(); code != 503 {
+		t.Errorf("expected an unmigrated database not to be ready, got %d", code)
+	}
+
+	store.schemaVersion = latest
+	if code, response := ready(); code != 200 || !response.Ready || len(response.Checks) != 3 {
+		t.Errorf("expected the registry to be ready, got %d %+v", code, response)
+	}
+
+	store.schemaDirty = true
+	if code, _ := ready(); code != 503 {
+		t.Errorf("expected a failed migration not to be ready, got %d", code)
+	}
+
+	store.schemaDirty = false
+	store.pingErr = errors.New("dial tcp 10.0.0.1:3306: connection refused")
+	code, response := ready()
+	if code != 503 || response.Checks[0].Result != CheckFailed || response.Checks[0].Detail != "The database is not reachable" {
+		t.Errorf("expected the database check to fail without details, got %d %+v", code, response)
+	}
+}
+
+func TestProbesIgnoreBasePath(t *testing.T) {
+	s, err := NewServer(&Config{HTTPSecret: "test", HTTPBasePath: "/registry"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newMemStore()
+	s.SetStore(store)
+
+	if rec := serve(t, s, store, 0, "GET", "/healthz", ""); rec.Code != 200 {
+		t.Errorf("expected /healthz to be served, got %d", rec.Code)
+	}
+
+	rec := serve(t, s, store, 0, "GET", "/version", "")
+	var version VersionModel
+	json.Unmarshal(rec.Body.Bytes(), &version)
+	if rec.Code != 200 || version.Version != Version || version.SchemaVersion == nil || version.SchemaLatest == 0 {
+		t.Errorf("expected the versions to be reported, got %d %s", rec.Code, rec.Body.String())
+	}
+}
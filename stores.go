@@ -7,6 +7,7 @@ type RegistrantStorer interface {
 	GetRegistrantByID(id int64) (*Registrant, error)
 	GetRegistrantByEmail(email string) (*Registrant, error)
 	ReplaceRegistrant(u *Registrant) error
+	SetRegistrantLastLogin(id, lastLogin int64) error
 	DeleteRegistrant(id int64) error
 }
 
@@ -24,7 +25,10 @@ type ApplicationStorer interface {
 	ListApplications() ([]*Application, error)
 	GetApplicationByID(id int64) (*Application, error)
 	GetApplicationByDomain(domain string) (*Application, error)
+	GetApplicationByOrigin(candidates []string) (*Application, error)
+	GetApplicationByRemoteID(peerID, remoteID int64) (*Application, error)
 	ReplaceApplication(*Application) error
+	SetApplicationReminder(appID, validUntil int64) error
 	DeleteApplication(id int64) error
 }
 
@@ -34,14 +38,131 @@ type KlinkStorer interface {
 	ListKlinks() ([]*Klink, error)
 	GetKlinkByPrimaryKey(id int64) (*Klink, error)
 	GetKlinkByIdentifier(identifier string) (*Klink, error)
+	ListKlinksByIdentifier(identifiers []string) ([]*Klink, error)
+	GetKlinkByRemoteID(peerID, remoteID int64) (*Klink, error)
 	UpdateKlink(*Klink) error
 	DeleteKlink(id int64) error
+	CountKlinkApplications() (map[int64]int, error)
+	SetKlinkHealth(klinkID int64, status string, checkedAt int64) error
+}
+
+// HealthCheckStorer implements all methods to persist the health history of
+// Klinks
+type HealthCheckStorer interface {
+	CreateHealthCheck(*HealthCheck) error
+	ListHealthChecks(klinkID int64, limit int) ([]*HealthCheck, error)
+	DeleteHealthChecksBefore(checkedAt int64) error
+}
+
+// KlinkMemberStorer implements all methods to persist K-Link memberships
+type KlinkMemberStorer interface {
+	ListKlinkMembers(klinkID int64) ([]*KlinkMember, error)
+	ListKlinkMembershipsByRegistrant(registrantID int64) ([]*KlinkMember, error)
+	GetKlinkMember(klinkID, registrantID int64) (*KlinkMember, error)
+	SaveKlinkMember(*KlinkMember) error
+	DeleteKlinkMember(klinkID, registrantID int64) error
+}
+
+// AccessRequestStorer implements all methods to persist AccessRequests
+type AccessRequestStorer interface {
+	CreateAccessRequest(*AccessRequest) error
+	ListAccessRequestsByApplication(applicationID int64) ([]*AccessRequest, error)
+	ListAccessRequestsByKlink(klinkID int64) ([]*AccessRequest, error)
+	GetAccessRequestByID(id int64) (*AccessRequest, error)
+	UpdateAccessRequest(*AccessRequest) error
+}
+
+// JoinRequestStorer implements all methods to persist JoinRequests
+type JoinRequestStorer interface {
+	CreateJoinRequest(*JoinRequest) error
+	ListJoinRequestsByKlink(klinkID int64) ([]*JoinRequest, error)
+	ListJoinRequestsByRegistrant(registrantID int64) ([]*JoinRequest, error)
+	GetJoinRequestByID(id int64) (*JoinRequest, error)
+	UpdateJoinRequest(*JoinRequest) error
+}
+
+// RenewalRequestStorer implements all methods to persist RenewalRequests
+type RenewalRequestStorer interface {
+	CreateRenewalRequest(*RenewalRequest) error
+	ListRenewalRequests() ([]*RenewalRequest, error)
+	ListRenewalRequestsByApplication(applicationID int64) ([]*RenewalRequest, error)
+	GetRenewalRequestByID(id int64) (*RenewalRequest, error)
+	UpdateRenewalRequest(*RenewalRequest) error
+}
+
+// OwnershipTransferStorer implements all methods to persist
+// OwnershipTransfers
+type OwnershipTransferStorer interface {
+	CreateOwnershipTransfer(*OwnershipTransfer) error
+	ListOwnershipTransfersByApplication(applicationID int64) ([]*OwnershipTransfer, error)
+	GetOwnershipTransferByToken(token string) (*OwnershipTransfer, error)
+	UpdateOwnershipTransfer(*OwnershipTransfer) error
 }
 
 // PermissionStorer implements all methods to persist Permissions
 type PermissionStorer interface {
 	ListPermissions() ([]*Permission, error)
+	GetPermission(name string) (*Permission, error)
 	CreatePermission(*Permission) error
+	UpdatePermission(*Permission) error
+	DeletePermission(name string) error
+	CountPermissionGrants(name string) (int, error)
+}
+
+// PeerStorer implements all methods to persist Peers. Deleting a peer also
+// deletes the records imported from it.
+type PeerStorer interface {
+	CreatePeer(*Peer) error
+	ListPeers() ([]*Peer, error)
+	GetPeerByID(id int64) (*Peer, error)
+	GetPeerByKey(key string) (*Peer, error)
+	UpdatePeer(*Peer) error
+	DeletePeer(id int64) error
+}
+
+// ChangeStorer implements all methods to persist the Changes of local
+// records
+type ChangeStorer interface {
+	CreateChange(*Change) error
+	ListChangesSince(id int64, limit int) ([]*Change, error)
+}
+
+// WebhookStorer implements all methods to persist Webhooks and their
+// deliveries. Deleting a webhook also deletes its deliveries.
+type WebhookStorer interface {
+	CreateWebhook(*Webhook) error
+	ListWebhooks() ([]*Webhook, error)
+	GetWebhookByID(id int64) (*Webhook, error)
+	UpdateWebhook(*Webhook) error
+	DeleteWebhook(id int64) error
+
+	CreateWebhookDelivery(*WebhookDelivery) error
+	ListWebhookDeliveries(webhookID int64, limit int) ([]*WebhookDelivery, error)
+	ListDueWebhookDeliveries(now int64, limit int) ([]*WebhookDelivery, error)
+	GetWebhookDeliveryByID(id int64) (*WebhookDelivery, error)
+	UpdateWebhookDelivery(*WebhookDelivery) error
+}
+
+// EventStorer implements all methods to persist the events of the event
+// stream
+type EventStorer interface {
+	CreateEvent(*EventRecord) error
+	ListEventsSince(seq int64, limit int) ([]*EventRecord, error)
+	GetLastEventSeq() (int64, error)
+	DeleteEventsBefore(createdAt int64) error
+}
+
+// AuditStorer implements all methods to persist the audit log
+type AuditStorer interface {
+	CreateAuditEntry(*AuditEntry) error
+}
+
+// SchemaStorer implements the methods to check the state of the database.
+// The schema version is the revision of the last migration, it is dirty if
+// the migration failed.
+type SchemaStorer interface {
+	Ping() error
+	GetSchemaVersion() (version int64, dirty bool, err error)
 }
 
 // A Storer implements all neccessary database methods
@@ -51,5 +172,17 @@ type Storer interface {
 	PermissionStorer
 	EmailVerificationStorer
 	KlinkStorer
+	KlinkMemberStorer
+	HealthCheckStorer
+	AccessRequestStorer
+	JoinRequestStorer
+	RenewalRequestStorer
+	OwnershipTransferStorer
+	PeerStorer
+	ChangeStorer
+	WebhookStorer
+	EventStorer
+	AuditStorer
+	SchemaStorer
 	IsNotFound(error) bool
 }
@@ -0,0 +1,374 @@
+package klinkregistry
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// eventRetention is the age after which events are removed, streams can
+	// only be resumed within this period
+	eventRetention = 7 * 24 * time.Hour
+
+	// eventPruneInterval is the minimum time between two removals of old
+	// events
+	eventPruneInterval = time.Hour
+
+	// eventBatchSize is the number of events read from the store at once
+	eventBatchSize = 100
+
+	// eventKeepAlive is the interval of comments sent on idle streams. The
+	// stream also checks for events of other registry instances then.
+	eventKeepAlive = 15 * time.Second
+
+	// eventRetry is the reconnection delay suggested to clients
+	eventRetry = 2 * time.Second
+
+	// eventStreamDuration is the time after which a stream is closed, so
+	// that clients reconnect and are balanced across the instances
+	eventStreamDuration = 30 * time.Minute
+)
+
+// eventHub wakes the open event streams when an event is published
+type eventHub struct {
+	mu       sync.Mutex
+	streams  map[chan struct{}]bool
+	prunedAt time.Time
+}
+
+func newEventHub() *eventHub {
+	return &eventHub{streams: make(map[chan struct{}]bool)}
+}
+
+// subscribe returns a channel that receives a value after events were
+// published
+func (h *eventHub) subscribe() chan struct{} {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	wake := make(chan struct{}, 1)
+	h.streams[wake] = true
+	return wake
+}
+
+func (h *eventHub) unsubscribe(wake chan struct{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	delete(h.streams, wake)
+}
+
+func (h *eventHub) broadcast() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for wake := range h.streams {
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// shouldPrune returns true at most once per eventPruneInterval
+func (h *eventHub) shouldPrune(now time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if now.Sub(h.prunedAt) < eventPruneInterval {
+		return false
+	}
+	h.prunedAt = now
+	return true
+}
+
+// publish persists an event and wakes the open event streams. Events older
+// than the retention are removed from time to time.
+func (s *Server) publish(record *EventRecord) {
+	if err := s.store.CreateEvent(record); err != nil {
+		s.logger.WithError(err).WithField("event", record.Type).Error("Error storing event")
+		return
+	}
+	s.events.broadcast()
+
+	now := time.Now().UTC()
+	if s.events.shouldPrune(now) {
+		if err := s.store.DeleteEventsBefore(now.Add(-eventRetention).Unix()); err != nil {
+			s.logger.WithError(err).Error("Error removing old events")
+		}
+	}
+}
+
+// eventSubscriber is either a registrant with a session, or an application
+// that authenticated with its URL and token
+type eventSubscriber struct {
+	user *User
+	app  *Application
+}
+
+// appCredentials returns the URL and token an application passes as HTTP
+// basic auth. Unlike req.BasicAuth, the credentials are split at the last
+// colon, as the URL contains colons itself.
+func appCredentials(req *http.Request) (string, string, bool) {
+	const prefix = "Basic "
+
+	header := req.Header.Get("Authorization")
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return "", "", false
+	}
+
+	decoded, err := base64.StdEncoding.DecodeString(header[len(prefix):])
+	if err != nil {
+		return "", "", false
+	}
+
+	credentials := string(decoded)
+	i := strings.LastIndex(credentials, ":")
+	if i < 0 {
+		return "", "", false
+	}
+	return credentials[:i], credentials[i+1:], true
+}
+
+// eventSubscriber returns the subscriber of an event stream request, or nil
+// if neither a session nor valid application credentials are given.
+// Applications pass their URL and token as HTTP basic auth; denied
+// applications are audited like in application.authenticate.
+func (s *Server) eventSubscriber(req *http.Request) *eventSubscriber {
+	if user := s.sessions.GetUser(req); user != nil {
+		return &eventSubscriber{user: user}
+	}
+
+	appURL, secret, ok := appCredentials(req)
+	if !ok {
+		return nil
+	}
+
+	auth := s.authorize(AuthorizationRequest{AppURL: appURL, AppSecret: secret})
+	if !auth.Granted() {
+		s.auditDenial(auth, appURL)
+		return nil
+	}
+	return &eventSubscriber{app: auth.App}
+}
+
+// canSeeEvent returns true if the subscriber may see the record the event is
+// about. Registrants see their own records and the ones they may view
+// through their role or K-Link memberships. Applications see their own
+// events and the events of the K-Links they are granted.
+func (s *Server) canSeeEvent(sub *eventSubscriber, record *EventRecord) bool {
+	var event struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(record.Payload), &event); err != nil {
+		return false
+	}
+
+	switch {
+	case strings.HasPrefix(record.Type, "application."):
+		var app ApplicationEvent
+		if err := json.Unmarshal(event.Data, &app); err != nil {
+			return false
+		}
+		if sub.app != nil {
+			return app.ID == sub.app.ID
+		}
+		if app.OwnerID == sub.user.ID || s.can(sub.user, CapApplicationView) {
+			return true
+		}
+		for _, identifier := range app.Klinks {
+			klink, err := s.store.GetKlinkByIdentifier(identifier)
+			if err == nil && s.canInKlink(sub.user, klink, CapKlinkApplicationView) {
+				return true
+			}
+		}
+		return false
+
+	case strings.HasPrefix(record.Type, "klink."):
+		var klink KlinkEvent
+		if err := json.Unmarshal(event.Data, &klink); err != nil {
+			return false
+		}
+		if sub.app != nil {
+			return sub.app.GetGrant(klink.Identifier) != nil
+		}
+		return s.canInKlink(sub.user, &Klink{ID: record.SubjectID}, CapKlinkView)
+
+	case strings.HasPrefix(record.Type, "registrant."):
+		if sub.app != nil {
+			return false
+		}
+		return record.SubjectID == sub.user.ID || s.can(sub.user, CapRegistrantView)
+	}
+
+	return false
+}
+
+// streamEvents writes all events after the cursor that the subscriber may
+// see, and returns the new cursor
+func (s *Server) streamEvents(w io.Writer, sub *eventSubscriber, cursor int64) (int64, error) {
+	for {
+		records, err := s.store.ListEventsSince(cursor, eventBatchSize)
+		if err != nil && !s.store.IsNotFound(err) {
+			return cursor, err
+		}
+
+		for _, record := range records {
+			cursor = record.Seq
+			if !s.canSeeEvent(sub, record) {
+				continue
+			}
+
+			_, err := fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", record.Seq, record.Type, record.Payload)
+			if err != nil {
+				return cursor, err
+			}
+		}
+
+		if len(records) < eventBatchSize {
+			return cursor, nil
+		}
+	}
+}
+
+// eventStream is the response body of an event stream
+type eventStream struct {
+	io.Writer
+	flush  func() error
+	closed <-chan struct{}
+	close  func()
+}
+
+// openEventStream writes the header of an event stream. HTTP/1 connections
+// are taken over, so that the write timeout of the server, which applies to
+// all other requests, does not cut off the stream. Otherwise, e.g. on
+// HTTP/2, the response is flushed after every write.
+func openEventStream(w http.ResponseWriter, req *http.Request) (*eventStream, error) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok || req.ProtoMajor != 1 {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			return nil, errors.New("the response can not be streamed")
+		}
+
+		w.WriteHeader(http.StatusOK)
+		return &eventStream{
+			Writer: w,
+			flush:  func() error { flusher.Flush(); return nil },
+			closed: req.Context().Done(),
+			close:  func() {},
+		}, nil
+	}
+
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, err
+	}
+	conn.SetWriteDeadline(time.Time{})
+
+	// the body ends when the connection is closed
+	w.Header().Set("Connection", "close")
+	fmt.Fprintf(rw, "HTTP/1.%d 200 OK\r\n", req.ProtoMinor)
+	w.Header().Write(rw)
+	rw.WriteString("\r\n")
+
+	// clients send nothing after the request, so reading only ends once
+	// they close the connection
+	closed := make(chan struct{})
+	go func() {
+		io.Copy(ioutil.Discard, rw)
+		close(closed)
+	}()
+
+	return &eventStream{
+		Writer: rw,
+		flush:  rw.Flush,
+		closed: closed,
+		close:  func() { conn.Close() },
+	}, nil
+}
+
+// handleEventStream provides a Server-Sent Events endpoint that streams the
+// events the subscriber may see. Streams start with the next event, or
+// resume after the event given as Last-Event-ID. The stream is closed after
+// eventStreamDuration, and the client reconnects.
+func (s *Server) handleEventStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		sub := s.eventSubscriber(req)
+		if sub == nil {
+			jsonResponse(w, API2ErrUnauthorized)
+			return
+		}
+
+		var cursor int64
+		var err error
+		if lastEventID := req.Header.Get("Last-Event-ID"); lastEventID != "" {
+			cursor, err = strconv.ParseInt(lastEventID, 10, 64)
+			if err != nil || cursor < 0 {
+				jsonResponse(w, API2ErrInvalidLastEventID)
+				return
+			}
+		} else {
+			cursor, err = s.store.GetLastEventSeq()
+			if err != nil && !s.store.IsNotFound(err) {
+				jsonResponse(w, API2ErrDatabase)
+				return
+			}
+		}
+
+		// subscribe before reading, so that no event is missed
+		wake := s.events.subscribe()
+		defer s.events.unsubscribe(wake)
+
+		stream, err := openEventStream(w, req)
+		if err != nil {
+			s.requestLogger(req).WithError(err).Error("Error opening the event stream")
+			jsonResponse(w, API2ErrGeneric)
+			return
+		}
+		defer stream.close()
+		fmt.Fprintf(stream, "retry: %d\n\n", eventRetry/time.Millisecond)
+
+		ticker := time.NewTicker(eventKeepAlive)
+		defer ticker.Stop()
+
+		closing := time.NewTimer(eventStreamDuration)
+		defer closing.Stop()
+
+		for {
+			cursor, err = s.streamEvents(stream, sub, cursor)
+			if err == nil {
+				err = stream.flush()
+			}
+			if err != nil {
+				s.requestLogger(req).WithError(err).Warn("Error streaming events")
+				return
+			}
+
+			select {
+			case <-stream.closed:
+				return
+			case <-closing.C:
+				return
+			case <-wake:
+			case <-ticker.C:
+				if _, err := io.WriteString(stream, ": keep-alive\n\n"); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package klinkregistry
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanSeeEvent(t *testing.T) {
+	s, store := newTestServer(t)
+
+	s.emitApplication(EventApplicationUpdated, store.applications[testAliceAppID])
+	s.emitKlink(EventKlinkUpdated, store.klinks[testKlinkID])
+	s.emitRegistrant(EventRegistrantDeactivated, store.registrants[testBobID])
+	appEvent, klinkEvent, registrantEvent := store.events[0], store.events[1], store.events[2]
+
+	user := func(id int64) *eventSubscriber {
+		registrant := store.registrants[id]
+		return &eventSubscriber{user: &User{ID: registrant.ID, Role: registrant.Role}}
+	}
+	app := func(id int64) *eventSubscriber {
+		return &eventSubscriber{app: store.applications[id]}
+	}
+
+	tests := []struct {
+		name   string
+		sub    *eventSubscriber
+		record *EventRecord
+		want   bool
+	}{
+		{"owner sees own application", user(testAliceID), appEvent, true},
+		{"user does not see others' applications", user(testBobID), appEvent, false},
+		{"curator sees applications of the K-Link", user(testCarolID), appEvent, true},
+		{"admin sees applications", user(testAdminID), appEvent, true},
+		{"member sees the K-Link", user(testCarolID), klinkEvent, true},
+		{"non-member does not see the K-Link", user(testAliceID), klinkEvent, false},
+		{"registrant sees own events", user(testBobID), registrantEvent, true},
+		{"user does not see other registrants", user(testAliceID), registrantEvent, false},
+		{"application sees itself", app(testAliceAppID), appEvent, true},
+		{"application does not see others", app(testBobAppID), appEvent, false},
+		{"application sees granted K-Link", app(testAliceAppID), klinkEvent, true},
+		{"application does not see other K-Links", app(testBobAppID), klinkEvent, false},
+		{"application does not see registrants", app(testAliceAppID), registrantEvent, false},
+	}
+
+	for _, test := range tests {
+		if got := s.canSeeEvent(test.sub, test.record); got != test.want {
+			t.Errorf("%s: expected %v, got %v", test.name, test.want, got)
+		}
+	}
+}
+
+func TestEventStream(t *testing.T) {
+	s, store := newTestServer(t)
+
+	s.emitApplication(EventApplicationUpdated, store.applications[testBobAppID])
+	s.emitApplication(EventApplicationUpdated, store.applications[testAliceAppID])
+	s.emitRegistrant(EventRegistrantDeactivated, store.registrants[testBobID])
+	s.emitKlink(EventKlinkUpdated, store.klinks[testKlinkID])
+
+	ts := httptest.NewServer(s.router)
+	defer ts.Close()
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	req, _ := http.NewRequest("GET", ts.URL+"/api/2.0/events", nil)
+	if res, err := client.Do(req); err != nil || res.StatusCode != 401 {
+		t.Fatalf("expected anonymous subscribers to be rejected, got %v (%v)", res, err)
+	}
+
+	req.SetBasicAuth("https://alice.example.com", "wrong")
+	if res, err := client.Do(req); err != nil || res.StatusCode != 401 {
+		t.Fatalf("expected invalid credentials to be rejected, got %v (%v)", res, err)
+	}
+	if len(store.audit) != 1 || store.audit[0].Outcome != AuditDenied {
+		t.Errorf("expected the invalid credentials to be audited, got %+v", store.audit)
+	}
+
+	// replay all stored events, of which only two are visible
+	req.SetBasicAuth("https://alice.example.com", "alice")
+	req.Header.Set("Last-Event-ID", "0")
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != 200 || !strings.HasPrefix(res.Header.Get("Content-Type"), "text/event-stream") {
+		t.Fatalf("expected an event stream, got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+
+	var ids, types []string
+	scanner := bufio.NewScanner(res.Body)
+	for len(types) < 2 && scanner.Scan() {
+		line := scanner.Text()
+		if strings.HasPrefix(line, "id: ") {
+			ids = append(ids, strings.TrimPrefix(line, "id: "))
+		} else if strings.HasPrefix(line, "event: ") {
+			types = append(types, strings.TrimPrefix(line, "event: "))
+		}
+	}
+
+	if len(types) != 2 || types[0] != EventApplicationUpdated || types[1] != EventKlinkUpdated {
+		t.Fatalf("expected the own application and the granted K-Link, got %v", types)
+	}
+	if ids[0] != strconv.FormatInt(store.events[1].Seq, 10) || ids[1] != strconv.FormatInt(store.events[3].Seq, 10) {
+		t.Errorf("expected the sequence numbers as event ids, got %v", ids)
+	}
+}
+
+func TestEventStreamInvalidLastEventID(t *testing.T) {
+	s, _ := newTestServer(t)
+
+	req := httptest.NewRequest("GET", "/api/2.0/events", nil)
+	req.SetBasicAuth("https://alice.example.com", "alice")
+	req.Header.Set("Last-Event-ID", "abc")
+	rec := httptest.NewRecorder()
+	s.router.ServeHTTP(rec, req)
+
+	if rec.Code != 400 {
+		t.Errorf("expected an invalid Last-Event-ID to be rejected, got %d", rec.Code)
+	}
+}
+
+func TestEventStreamOutlivesWriteTimeout(t *testing.T) {
+	s, store := newTestServer(t)
+
+	ts := httptest.NewUnstartedServer(s.router)
+	ts.Config.WriteTimeout = 100 * time.Millisecond
+	ts.Start()
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL+"/api/2.0/events", nil)
+	req.SetBasicAuth("https://alice.example.com", "alice")
+	res, err := (&http.Client{Timeout: 5 * time.Second}).Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	time.Sleep(2 * ts.Config.WriteTimeout)
+	s.emitApplication(EventApplicationUpdated, store.applications[testAliceAppID])
+
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if scanner.Text() == "event: "+EventApplicationUpdated {
+			return
+		}
+	}
+	t.Errorf("expected the event after the write timeout, got %v", scanner.Err())
+}
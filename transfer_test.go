@@ -0,0 +1,94 @@
+package klinkregistry
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOwnershipTransfer(t *testing.T) {
+	s, store := newTestServer(t)
+	mailer := &recordingMailer{}
+	s.email = mailer
+
+	if rec := serve(t, s, store, testBobID, "POST", "/api/2.0/applications/5/transfers", `{"email":"bob@example.com"}`); rec.Code != 403 {
+		t.Errorf("expected other registrants to be forbidden, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/transfers", `{"email":"nobody@example.com"}`); rec.Code != 422 {
+		t.Errorf("expected an unknown recipient to be rejected, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/transfers", `{"email":"bob@example.com"}`); rec.Code != 200 {
+		t.Fatalf("expected the transfer to be proposed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/transfers", `{"email":"carol@example.com"}`); rec.Code != 409 {
+		t.Errorf("expected a second pending transfer to be rejected, got %d", rec.Code)
+	}
+	if len(mailer.recipients) != 1 || mailer.recipients[0] != "bob@example.com" {
+		t.Errorf("expected the recipient to be notified, got %v", mailer.recipients)
+	}
+
+	var token string
+	for _, transfer := range store.transfers {
+		token = transfer.Token
+	}
+
+	if rec := serve(t, s, store, testCarolID, "POST", "/api/2.0/transfers/"+token+"/accept", ""); rec.Code != 404 {
+		t.Errorf("expected only the recipient to accept, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testBobID, "POST", "/api/2.0/transfers/"+token+"/accept", ""); rec.Code != 200 {
+		t.Fatalf("expected the transfer to be accepted, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, s, store, testBobID, "POST", "/api/2.0/transfers/"+token+"/accept", ""); rec.Code != 409 {
+		t.Errorf("expected the transfer to be accepted only once, got %d", rec.Code)
+	}
+
+	if owner := store.applications[testAliceAppID].OwnerID; owner != testBobID {
+		t.Errorf("expected bob to own the application, got %d", owner)
+	}
+	if len(mailer.recipients) != 3 || mailer.recipients[1] != "alice@example.com" || mailer.recipients[2] != "bob@example.com" {
+		t.Errorf("expected both owners to be notified, got %v", mailer.recipients)
+	}
+	if len(store.audit) != 1 || store.audit[0].Action != AuditActionTransfer || store.audit[0].ActorID != testBobID {
+		t.Errorf("expected the transfer to be audited, got %+v", store.audit)
+	}
+}
+
+func TestOwnershipTransferExpired(t *testing.T) {
+	s, store := newTestServer(t)
+
+	store.CreateOwnershipTransfer(&OwnershipTransfer{
+		ApplicationID: testAliceAppID,
+		FromID:        testAliceID,
+		ToID:          testBobID,
+		Token:         "expired",
+		Status:        RequestPending,
+		CreatedAt:     time.Now().Add(-OwnershipTransferValidity).Unix(),
+	})
+
+	if rec := serve(t, s, store, testBobID, "POST", "/api/2.0/transfers/expired/accept", ""); rec.Code != 422 {
+		t.Errorf("expected an expired transfer to be rejected, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/transfers", `{"email":"carol@example.com"}`); rec.Code != 200 {
+		t.Errorf("expected a new transfer after expiry, got %d", rec.Code)
+	}
+}
+
+func TestUpdateApplicationOwner(t *testing.T) {
+	s, store := newTestServer(t)
+
+	body := func(owner string) string {
+		return `{"owner_id":` + owner + `,"name":"Alice","app_domain":"https://alice.example.com","token":"alice","active":true,"permissions":["data-search","data-legacy"],"klinks":["k-admin"]}`
+	}
+
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/applications/5", body("999")); rec.Code != 422 {
+		t.Errorf("expected an unknown owner to be rejected, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/applications/5", body("0")); rec.Code != 200 || store.applications[testAliceAppID].OwnerID != testAliceID {
+		t.Errorf("expected a missing owner to keep the owner, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/applications/5", body("4")); rec.Code != 200 || store.applications[testAliceAppID].OwnerID != testBobID {
+		t.Errorf("expected the owner to be changed, got %d", rec.Code)
+	}
+	if len(store.audit) != 1 || store.audit[0].Reason != "direct" {
+		t.Errorf("expected the change to be audited, got %+v", store.audit)
+	}
+}
@@ -0,0 +1,239 @@
+package klinkregistry
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Methods to prove the ownership of a domain
+const (
+	VerifyHTTP = "http"
+	VerifyDNS  = "dns"
+)
+
+// ChallengePath is the path of the file that contains the challenge token
+const ChallengePath = "/.well-known/klink-registry-challenge"
+
+// ChallengeRecordPrefix is prepended to the domain of an application to get
+// the name of the TXT record that contains the challenge token
+const ChallengeRecordPrefix = "_klink-registry-challenge."
+
+// ErrChallengeFailed is returned if the challenge token was not found
+var ErrChallengeFailed = errors.New("challenge token not found")
+
+// errRedirect is returned by clients that do not follow redirects
+var errRedirect = errors.New("redirects are not followed")
+
+// nonPublicNetworks contains the private and reserved networks, besides the
+// loopback, link-local and multicast addresses recognised by net.IP
+var nonPublicNetworks = parseNetworks(
+	"0.0.0.0/8",
+	"10.0.0.0/8",
+	"100.64.0.0/10",
+	"172.16.0.0/12",
+	"192.0.0.0/24",
+	"192.168.0.0/16",
+	"198.18.0.0/15",
+	"240.0.0.0/4",
+	"fc00::/7",
+)
+
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// isPublicIP returns true if the address is reachable on the internet
+func isPublicIP(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// refuseRedirects is the CheckRedirect of clients that must not be sent to
+// another host
+func refuseRedirects(req *http.Request, via []*http.Request) error {
+	return errRedirect
+}
+
+// dialPublic returns a dial function that only connects to public addresses.
+// The host is resolved once and the checked address is dialed, so that the
+// name cannot resolve to another address in between.
+func dialPublic(dialer *net.Dialer) func(ctx context.Context, network, address string) (net.Conn, error) {
+	return func(ctx context.Context, network, address string) (net.Conn, error) {
+		host, port, err := net.SplitHostPort(address)
+		if err != nil {
+			return nil, err
+		}
+
+		addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+		if err != nil {
+			return nil, err
+		}
+		if len(addrs) == 0 {
+			return nil, errors.Errorf("no address found for %s", host)
+		}
+		for _, addr := range addrs {
+			if !isPublicIP(addr.IP) {
+				return nil, errors.Errorf("%s resolves to the non-public address %s", host, addr.IP)
+			}
+		}
+
+		return dialer.DialContext(ctx, network, net.JoinHostPort(addrs[0].IP.String(), port))
+	}
+}
+
+// A Resolver looks up DNS TXT records. It is implemented by *net.Resolver.
+type Resolver interface {
+	LookupTXT(ctx context.Context, name string) ([]string, error)
+}
+
+// DomainVerifier checks that the owner of an application controls its
+// domain, by looking for the challenge token of the application either in
+// the challenge file served by the domain or in a TXT record.
+type DomainVerifier struct {
+	Resolver Resolver
+	Client   *http.Client
+}
+
+// NewDomainVerifier returns a verifier that uses the system resolver and an
+// HTTP client with the given timeout. The domains are chosen by the
+// registrants, so the client only connects to public addresses and does not
+// follow redirects.
+func NewDomainVerifier(timeout time.Duration) *DomainVerifier {
+	return &DomainVerifier{
+		Resolver: net.DefaultResolver,
+		Client: &http.Client{
+			Timeout: timeout,
+			Transport: &http.Transport{
+				DialContext:         dialPublic(&net.Dialer{Timeout: timeout}),
+				TLSHandshakeTimeout: timeout,
+			},
+			CheckRedirect: refuseRedirects,
+		},
+	}
+}
+
+// verificationOrigins returns the origins whose domains the owner has to
+// control: the URL, each additional origin and, for a wildcard pattern, the
+// domain below the wildcard. Origins of the same domain are only listed once.
+func verificationOrigins(app *Application) []string {
+	var origins []string
+	for _, origin := range append([]string{app.URL}, app.Origins...) {
+		origin = strings.Replace(origin, "://*.", "://", 1)
+
+		known := false
+		for _, other := range origins {
+			known = known || sameDomain(origin, other)
+		}
+		if !known {
+			origins = append(origins, origin)
+		}
+	}
+	return origins
+}
+
+// Verify checks the challenge token of the application URL with the given
+// method
+func (v *DomainVerifier) Verify(ctx context.Context, method, appURL, token string) error {
+	origin, err := NormalizeOrigin(appURL)
+	if err != nil {
+		return err
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return err
+	}
+
+	switch method {
+	case VerifyHTTP:
+		return v.verifyHTTP(ctx, u.Scheme+"://"+u.Host+ChallengePath, token)
+	case VerifyDNS:
+		return v.verifyDNS(ctx, ChallengeRecordPrefix+u.Hostname(), token)
+	default:
+		return errors.Errorf("unknown verification method %q", method)
+	}
+}
+
+// verifyOrigins checks the challenge token of the application on the domains
+// of all its verificationOrigins. A domain is verified if one of the methods
+// succeeds. The first origin that could not be verified is returned with the
+// error.
+func (s *Server) verifyOrigins(ctx context.Context, app *Application, methods ...string) (string, error) {
+	for _, origin := range verificationOrigins(app) {
+		var err error
+		for _, method := range methods {
+			if err = s.verifier.Verify(ctx, method, origin, app.ChallengeToken); err == nil {
+				break
+			}
+		}
+		if err != nil {
+			return origin, err
+		}
+	}
+	return "", nil
+}
+
+func (v *DomainVerifier) verifyHTTP(ctx context.Context, challengeURL, token string) error {
+	req, err := http.NewRequest("GET", challengeURL, nil)
+	if err != nil {
+		return err
+	}
+
+	res, err := v.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.Wrap(err, "could not fetch challenge")
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return errors.Wrapf(ErrChallengeFailed, "%s returned %d", challengeURL, res.StatusCode)
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+	if err != nil {
+		return errors.Wrap(err, "could not read challenge")
+	}
+	if strings.TrimSpace(string(body)) != token {
+		return errors.Wrapf(ErrChallengeFailed, "%s does not contain the token", challengeURL)
+	}
+
+	return nil
+}
+
+func (v *DomainVerifier) verifyDNS(ctx context.Context, name, token string) error {
+	records, err := v.Resolver.LookupTXT(ctx, name)
+	if err != nil {
+		return errors.Wrap(err, "could not look up challenge")
+	}
+
+	for _, record := range records {
+		if strings.TrimSpace(record) == token {
+			return nil
+		}
+	}
+
+	return errors.Wrapf(ErrChallengeFailed, "no TXT record %s contains the token", name)
+}
@@ -0,0 +1,177 @@
+package klinkregistry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeResolver returns the TXT records of its map
+type fakeResolver map[string][]string
+
+func (r fakeResolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, ok := r[name]
+	if !ok {
+		return nil, fmt.Errorf("no such host %s", name)
+	}
+	return records, nil
+}
+
+// challengeServer serves the token of the challenge file
+func challengeServer(token *string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path != ChallengePath {
+			http.NotFound(w, req)
+			return
+		}
+		fmt.Fprintln(w, *token)
+	}))
+}
+
+func TestDomainVerifier(t *testing.T) {
+	token := "secret-token"
+	srv := challengeServer(&token)
+	defer srv.Close()
+
+	v := &DomainVerifier{
+		Client: srv.Client(),
+		Resolver: fakeResolver{
+			"_klink-registry-challenge.dms.example.org": {"other", "secret-token"},
+		},
+	}
+
+	cases := []struct {
+		method string
+		url    string
+		token  string
+		valid  bool
+	}{
+		{VerifyHTTP, srv.URL + "/dms/", "secret-token", true},
+		{VerifyHTTP, srv.URL, "wrong-token", false},
+		{VerifyDNS, "https://DMS.example.org/", "secret-token", true},
+		{VerifyDNS, "https://dms.example.org", "wrong-token", false},
+		{VerifyDNS, "https://example.org", "secret-token", false},
+		{"email", "https://dms.example.org", "secret-token", false},
+	}
+
+	for _, c := range cases {
+		err := v.Verify(context.Background(), c.method, c.url, c.token)
+		if valid := err == nil; valid != c.valid {
+			t.Errorf("%s %s with %q: expected valid %v, got %v", c.method, c.url, c.token, c.valid, err)
+		}
+	}
+}
+
+func TestVerifyApplication(t *testing.T) {
+	s, store := newTestServer(t)
+
+	token := ""
+	srv := challengeServer(&token)
+	defer srv.Close()
+	s.verifier = &DomainVerifier{Client: srv.Client(), Resolver: fakeResolver{}}
+
+	// moving the application to another domain requires a new verification
+	rec := serve(t, s, store, testAliceID, "PUT", "/api/2.0/applications/5",
+		`{"name":"Alice","app_domain":"`+srv.URL+`","token":"alice","active":true,"permissions":["data-search","data-legacy"],"klinks":["k-admin"]}`)
+	if rec.Code != 200 {
+		t.Fatalf("expected the URL to be changed, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var app ApplicationModel
+	json.Unmarshal(rec.Body.Bytes(), &app)
+	if app.VerifiedAt != 0 || app.ChallengeToken == "" {
+		t.Fatalf("expected a new challenge, got %+v", app)
+	}
+
+	auth := s.authorize(AuthorizationRequest{AppURL: srv.URL, AppSecret: "alice"})
+	if auth.Reason != DenyUnverifiedDomain {
+		t.Errorf("expected the unverified application to be denied, got %q", auth.Reason)
+	}
+
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/verify", ""); rec.Code != 422 {
+		t.Errorf("expected the verification to fail without the challenge file, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testBobID, "POST", "/api/2.0/applications/5/verify", ""); rec.Code != 403 {
+		t.Errorf("expected other registrants to be forbidden, got %d", rec.Code)
+	}
+
+	token = app.ChallengeToken
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/verify", `{"method":"http"}`); rec.Code != 200 {
+		t.Fatalf("expected the verification to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	auth = s.authorize(AuthorizationRequest{AppURL: srv.URL, AppSecret: "alice"})
+	if !auth.Granted() {
+		t.Errorf("expected the verified application to be granted, got %q", auth.Reason)
+	}
+
+	// changing only the path keeps the verification
+	rec = serve(t, s, store, testAliceID, "PUT", "/api/2.0/applications/5",
+		`{"name":"Alice","app_domain":"`+srv.URL+`/dms","token":"alice","active":true,"permissions":["data-search","data-legacy"],"klinks":["k-admin"]}`)
+	json.Unmarshal(rec.Body.Bytes(), &app)
+	if app.VerifiedAt == 0 {
+		t.Errorf("expected the verification to be kept, got %+v", app)
+	}
+
+	// a new origin requires a new verification of every domain, the domain
+	// below a wildcard included
+	rec = serve(t, s, store, testAliceID, "PUT", "/api/2.0/applications/5",
+		`{"name":"Alice","app_domain":"`+srv.URL+`/dms","origins":["*.dms.example.org"],"token":"alice","active":true,"permissions":["data-search","data-legacy"],"klinks":["k-admin"]}`)
+	json.Unmarshal(rec.Body.Bytes(), &app)
+	if app.VerifiedAt != 0 {
+		t.Fatalf("expected the new origin to require a verification, got %+v", app)
+	}
+
+	resolver := fakeResolver{"_klink-registry-challenge.127.0.0.1": {app.ChallengeToken}}
+	s.verifier.Resolver = resolver
+	rec = serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/verify", `{"method":"dns"}`)
+	if rec.Code != 422 || !strings.Contains(rec.Body.String(), "https://dms.example.org") {
+		t.Errorf("expected the verification of the wildcard domain to fail, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	resolver["_klink-registry-challenge.dms.example.org"] = []string{app.ChallengeToken}
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/applications/5/verify", `{"method":"dns"}`); rec.Code != 200 {
+		t.Errorf("expected the verification of all domains to succeed, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestVerifierRefusesInternalAddresses(t *testing.T) {
+	token := "secret-token"
+	srv := challengeServer(&token)
+	defer srv.Close()
+
+	if err := NewDomainVerifier(time.Second).Verify(context.Background(), VerifyHTTP, srv.URL, token); err == nil {
+		t.Error("expected the loopback address to be refused")
+	}
+
+	redirect := httptest.NewServer(http.RedirectHandler(srv.URL+ChallengePath, http.StatusFound))
+	defer redirect.Close()
+	v := &DomainVerifier{Client: redirect.Client()}
+	v.Client.CheckRedirect = refuseRedirects
+	if err := v.Verify(context.Background(), VerifyHTTP, redirect.URL, token); err == nil {
+		t.Error("expected the redirect not to be followed")
+	}
+
+	cases := map[string]bool{
+		"93.184.216.34":    true,
+		"2606:2800:220::1": true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.20.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"::1":              false,
+		"fd00::1":          false,
+		"::ffff:10.0.0.1":  false,
+	}
+	for ip, public := range cases {
+		if isPublicIP(net.ParseIP(ip)) != public {
+			t.Errorf("%s: expected public %v", ip, public)
+		}
+	}
+}
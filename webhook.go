@@ -0,0 +1,162 @@
+package klinkregistry
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Headers of webhook deliveries, besides HeaderTimestamp and HeaderSignature
+const (
+	HeaderEvent    = "X-Registry-Event"
+	HeaderDelivery = "X-Registry-Delivery"
+)
+
+const (
+	// webhookMaxAttempts is the number of attempts before a delivery
+	// fails
+	webhookMaxAttempts = 8
+
+	// webhookBackoff is the delay before the second attempt, which doubles
+	// with every further attempt
+	webhookBackoff = 30 * time.Second
+
+	// webhookBatchSize is the number of due deliveries attempted at once
+	webhookBatchSize = 100
+)
+
+// signWebhook returns the signature of a webhook delivery, which is the
+// HMAC-SHA256 of the timestamp and the payload
+func signWebhook(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	io.WriteString(mac, timestamp+"\n")
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// webhookDelay returns the delay before the next attempt of a delivery that
+// failed the given number of times
+func webhookDelay(attempts int) time.Duration {
+	return webhookBackoff << uint(attempts-1)
+}
+
+// queueDelivery stores a new pending delivery and wakes the delivery job
+func (s *Server) queueDelivery(delivery *WebhookDelivery) error {
+	now := time.Now().UTC().Unix()
+	delivery.ID = 0
+	delivery.Status = DeliveryPending
+	delivery.Attempts = 0
+	delivery.StatusCode = 0
+	delivery.Error = ""
+	delivery.CreatedAt = now
+	delivery.NextAttemptAt = now
+	delivery.DeliveredAt = 0
+
+	if err := s.store.CreateWebhookDelivery(delivery); err != nil {
+		s.logger.WithError(err).WithFields(logrus.Fields{"event": delivery.EventType, "webhook": delivery.WebhookID}).Error("Error queueing webhook delivery")
+		return err
+	}
+
+	select {
+	case s.webhookWake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// runWebhookDeliveries attempts the due deliveries in the given interval, or
+// right away when a delivery is queued. It is started in the background by
+// Run.
+func (s *Server) runWebhookDeliveries(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.deliverDueWebhooks(time.Now())
+
+		select {
+		case <-ticker.C:
+		case <-s.webhookWake:
+		}
+	}
+}
+
+// deliverDueWebhooks attempts all pending deliveries that are due
+func (s *Server) deliverDueWebhooks(now time.Time) {
+	deliveries, err := s.store.ListDueWebhookDeliveries(now.Unix(), webhookBatchSize)
+	if err != nil && !s.store.IsNotFound(err) {
+		s.logger.WithError(err).Error("Error listing due webhook deliveries")
+		return
+	}
+
+	for _, delivery := range deliveries {
+		webhook, err := s.store.GetWebhookByID(delivery.WebhookID)
+		if err != nil {
+			s.logger.WithError(err).WithField("webhook", delivery.WebhookID).Error("Error loading webhook")
+			continue
+		}
+
+		s.attemptDelivery(webhook, delivery, now)
+		if err := s.store.UpdateWebhookDelivery(delivery); err != nil {
+			s.logger.WithError(err).WithField("delivery", delivery.ID).Error("Error storing webhook delivery")
+		}
+	}
+}
+
+// attemptDelivery posts the payload of the delivery to the webhook. A 2xx
+// response marks the delivery as delivered, otherwise it is retried with
+// exponential backoff until it runs out of attempts.
+func (s *Server) attemptDelivery(webhook *Webhook, delivery *WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	delivery.StatusCode = 0
+	delivery.Error = ""
+
+	if err := s.post(webhook, delivery, now); err != nil {
+		delivery.Error = truncate(err.Error(), 255)
+	} else if delivery.StatusCode < 200 || delivery.StatusCode > 299 {
+		delivery.Error = "unexpected status " + strconv.Itoa(delivery.StatusCode)
+	} else {
+		delivery.Status = DeliveryDelivered
+		delivery.DeliveredAt = now.Unix()
+		return
+	}
+
+	if !webhook.Active || delivery.Attempts >= webhookMaxAttempts {
+		delivery.Status = DeliveryFailed
+		return
+	}
+	delivery.NextAttemptAt = now.Add(webhookDelay(delivery.Attempts)).Unix()
+}
+
+// post sends a signed delivery and stores the status code of the response
+func (s *Server) post(webhook *Webhook, delivery *WebhookDelivery, now time.Time) error {
+	req, err := http.NewRequest("POST", webhook.URL, strings.NewReader(delivery.Payload))
+	if err != nil {
+		return err
+	}
+
+	timestamp := strconv.FormatInt(now.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set(HeaderEvent, delivery.EventType)
+	req.Header.Set(HeaderDelivery, strconv.FormatInt(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, timestamp)
+	req.Header.Set(HeaderSignature, signWebhook(webhook.Secret, timestamp, []byte(delivery.Payload)))
+
+	res, err := s.webhooks.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(res.Body, 1024))
+
+	delivery.StatusCode = res.StatusCode
+	return nil
+}
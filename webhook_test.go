@@ -0,0 +1,170 @@
+package klinkregistry
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// webhookReceiver records the events of valid deliveries and answers with
+// the given status
+type webhookReceiver struct {
+	t      *testing.T
+	secret string
+	status int
+	events []Event
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := ioutil.ReadAll(req.Body)
+
+	timestamp := req.Header.Get(HeaderTimestamp)
+	if req.Header.Get(HeaderSignature) != signWebhook(r.secret, timestamp, body) {
+		r.t.Errorf("expected a valid signature, got %q", req.Header.Get(HeaderSignature))
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event Event
+	if err := json.Unmarshal(body, &event); err != nil || event.Type != req.Header.Get(HeaderEvent) {
+		r.t.Errorf("expected the event to match its header, got %s (%v)", body, err)
+	}
+	r.events = append(r.events, event)
+	w.WriteHeader(r.status)
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	s, store := newTestServer(t)
+
+	receiver := &webhookReceiver{t: t, secret: "hook-secret", status: http.StatusOK}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+	store.CreateWebhook(&Webhook{URL: ts.URL, Secret: "hook-secret", Events: []string{EventApplicationDeleted}, Active: true})
+
+	// the renewal of the validity is not subscribed
+	if rec := serve(t, s, store, testAdminID, "PUT", "/api/2.0/applications/6/validity", `{"valid_from":0,"valid_until":0}`); rec.Code != 200 {
+		t.Fatalf("expected the validity to be updated, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(t, s, store, testBobID, "DELETE", "/api/2.0/applications/6", ""); rec.Code != 200 {
+		t.Fatalf("expected the application to be deleted, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	s.deliverDueWebhooks(time.Now())
+
+	if len(receiver.events) != 1 || receiver.events[0].Type != EventApplicationDeleted {
+		t.Fatalf("expected the deletion to be delivered, got %+v", receiver.events)
+	}
+	if data, _ := receiver.events[0].Data.(map[string]interface{}); data["name"] != "Bob" || data["token"] != nil {
+		t.Errorf("expected the deleted application without its token, got %+v", receiver.events[0].Data)
+	}
+	if len(store.deliveries) != 1 || store.deliveries[0].Status != DeliveryDelivered || store.deliveries[0].StatusCode != 200 {
+		t.Errorf("expected the delivery to be logged, got %+v", store.deliveries)
+	}
+}
+
+func TestWebhookRetry(t *testing.T) {
+	s, store := newTestServer(t)
+
+	receiver := &webhookReceiver{t: t, secret: "hook-secret", status: http.StatusInternalServerError}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+	webhook := &Webhook{URL: ts.URL, Secret: "hook-secret", Active: true}
+	store.CreateWebhook(webhook)
+
+	s.emitRegistrant(EventRegistrantDeactivated, store.registrants[testBobID])
+	now := time.Now()
+
+	s.deliverDueWebhooks(now)
+	delivery := store.deliveries[0]
+	if delivery.Status != DeliveryPending || delivery.Attempts != 1 || delivery.NextAttemptAt != now.Add(webhookBackoff).Unix() {
+		t.Fatalf("expected the delivery to be retried after %s, got %+v", webhookBackoff, delivery)
+	}
+
+	// the retry is not due yet
+	s.deliverDueWebhooks(now.Add(time.Second))
+	if len(receiver.events) != 1 {
+		t.Fatalf("expected no attempt before the backoff, got %d", len(receiver.events))
+	}
+
+	// the backoff doubles with every attempt
+	now = now.Add(webhookBackoff)
+	s.deliverDueWebhooks(now)
+	if delivery := store.deliveries[0]; delivery.NextAttemptAt != now.Add(2*webhookBackoff).Unix() {
+		t.Errorf("expected the backoff to double, got %+v", delivery)
+	}
+
+	receiver.status = http.StatusNoContent
+	s.deliverDueWebhooks(now.Add(2 * webhookBackoff))
+	if delivery := store.deliveries[0]; delivery.Status != DeliveryDelivered || delivery.Attempts != 3 {
+		t.Errorf("expected the third attempt to succeed, got %+v", delivery)
+	}
+
+	// a failing receiver eventually gives up
+	receiver.status = http.StatusBadGateway
+	s.emitRegistrant(EventRegistrantDeleted, store.registrants[testBobID])
+	for i := 0; i < webhookMaxAttempts; i++ {
+		s.deliverDueWebhooks(now.Add(24 * time.Hour * time.Duration(i+1)))
+	}
+	if delivery := store.deliveries[1]; delivery.Status != DeliveryFailed || delivery.Attempts != webhookMaxAttempts {
+		t.Errorf("expected the delivery to fail after %d attempts, got %+v", webhookMaxAttempts, delivery)
+	}
+}
+
+func TestRedeliverWebhook(t *testing.T) {
+	s, store := newTestServer(t)
+
+	receiver := &webhookReceiver{t: t, secret: "hook-secret", status: http.StatusOK}
+	ts := httptest.NewServer(receiver)
+	defer ts.Close()
+	webhook := &Webhook{URL: ts.URL, Secret: "hook-secret", Active: true}
+	store.CreateWebhook(webhook)
+
+	s.emitKlink(EventKlinkUpdated, store.klinks[testKlinkID])
+	s.deliverDueWebhooks(time.Now())
+
+	path := "/api/2.0/webhooks/" + strconv.FormatInt(webhook.ID, 10) + "/deliveries/" + strconv.FormatInt(store.deliveries[0].ID, 10) + "/redeliver"
+	if rec := serve(t, s, store, testAliceID, "POST", path, ""); rec.Code != 403 {
+		t.Errorf("expected users to be unable to redeliver events, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "POST", path, ""); rec.Code != 200 {
+		t.Fatalf("expected the event to be redelivered, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	s.deliverDueWebhooks(time.Now())
+	if len(receiver.events) != 2 || receiver.events[0].ID != receiver.events[1].ID {
+		t.Errorf("expected the same event to be delivered twice, got %+v", receiver.events)
+	}
+
+	rec := serve(t, s, store, testAdminID, "GET", "/api/2.0/webhooks/"+strconv.FormatInt(webhook.ID, 10)+"/deliveries", "")
+	var deliveries []WebhookDeliveryModel
+	json.NewDecoder(rec.Body).Decode(&deliveries)
+	if len(deliveries) != 2 || deliveries[0].ID != store.deliveries[1].ID {
+		t.Errorf("expected the delivery log newest first, got %+v", deliveries)
+	}
+}
+
+func TestCreateWebhook(t *testing.T) {
+	s, store := newTestServer(t)
+
+	if rec := serve(t, s, store, testAliceID, "POST", "/api/2.0/webhooks/", `{"url":"https://hooks.example.com"}`); rec.Code != 403 {
+		t.Errorf("expected users to be unable to add webhooks, got %d", rec.Code)
+	}
+	if rec := serve(t, s, store, testAdminID, "POST", "/api/2.0/webhooks/", `{"url":"https://hooks.example.com","events":["unknown"]}`); rec.Code != 422 {
+		t.Errorf("expected unknown events to be rejected, got %d", rec.Code)
+	}
+
+	rec := serve(t, s, store, testAdminID, "POST", "/api/2.0/webhooks/", `{"url":"https://hooks.example.com","active":true}`)
+	if rec.Code != 200 {
+		t.Fatalf("expected the webhook to be added, got %d: %s", rec.Code, rec.Body.String())
+	}
+
+	var model WebhookModel
+	json.NewDecoder(rec.Body).Decode(&model)
+	if model.Secret == "" || store.webhooks[model.ID].Secret != model.Secret {
+		t.Errorf("expected the generated secret to be returned, got %+v", model)
+	}
+}